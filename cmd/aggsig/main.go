@@ -84,36 +84,31 @@ func CalcK(R, A *cryptobase.ExtendedGroupElement, data []byte) ([32]byte, error)
 }
 
 // CalcS returns Si
-func CalcS(k, si, ri *[32]byte) *cryptobase.FieldElement {
+func CalcS(k, si, ri *[32]byte) [32]byte {
 	var s [32]byte
 	cryptobase.ScMulAdd(&s, k, si, ri)
-
-	var S cryptobase.FieldElement
-	cryptobase.FeFromBytes(&S, &s)
-
-	return &S
+	return s
 }
 
-// SumFE returns a sum of provided FieldElements
-func SumFE(elements ...*cryptobase.FieldElement) cryptobase.FieldElement {
-	var S cryptobase.FieldElement
-	for _, Si := range elements {
-		cryptobase.FeAdd(&S, &S, Si)
+// SumScalars returns a sum of provided scalars modulo the group order
+func SumScalars(scalars ...*[32]byte) [32]byte {
+	var S [32]byte
+	for _, Si := range scalars {
+		cryptobase.ScAdd(&S, &S, Si)
 	}
 	return S
 }
 
 // CurveSigFromEd creates a Curve25519 signature from A, R and S
-func CurveSigFromEd(A, R *cryptobase.ExtendedGroupElement, S *cryptobase.FieldElement) crypto.Signature {
-	var AByte, RByte, SByte [32]byte
+func CurveSigFromEd(A, R *cryptobase.ExtendedGroupElement, S *[32]byte) crypto.Signature {
+	var AByte, RByte [32]byte
 	A.ToBytes(&AByte)
 	R.ToBytes(&RByte)
-	cryptobase.FeToBytes(&SByte, S)
 
 	// this gets us an ed25519 sig, R || S
 	var signature [64]byte
 	copy(signature[:], RByte[:])
-	copy(signature[32:], SByte[:])
+	copy(signature[32:], S[:])
 
 	// this transforms an ed25519 to a Curve25519 sig
 	signBit := AByte[31] & 0x80
@@ -166,7 +161,7 @@ func main() {
 	S1 := CalcS(&k, &sk1, &r1)
 	S2 := CalcS(&k, &sk2, &r2)
 
-	S := SumFE(S1, S2)
+	S := SumScalars(&S1, &S2)
 
 	signatureCurve := CurveSigFromEd(&A, &R, &S)
 	publicKeyCurve := CurvePKFromEdPK(&A)
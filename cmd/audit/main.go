@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dvshur/distributed-signature/pkg/audit"
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+)
+
+const usage = `usage:
+  audit keygen [-out ops-key]                                     create an ops key, print its public key
+  audit verify [-log audit.log] [-heads audit.log.heads] -ops-key <public keys>
+                                                                  check the log's chain and its signed heads`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	out := flags.String("out", "ops-key", "file to write the ops secret key to")
+	logFile := flags.String("log", "audit.log", "audit log")
+	headsFile := flags.String("heads", "", "signed heads of the log, <log>.heads if empty")
+	opsKeys := flags.String("ops-key", "", "comma separated base58 public keys the heads have to be signed with")
+	_ = flags.Parse(os.Args[2:])
+
+	switch os.Args[1] {
+	case "keygen":
+		seed := make([]byte, 32)
+		if _, err := rand.Read(seed); err != nil {
+			log.Fatal(err)
+		}
+		sk, pk, err := crypto.GenerateKeyPair(seed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(*out, []byte(sk.String()+"\n"), 0600); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(pk)
+	case "verify":
+		if *opsKeys == "" {
+			fmt.Fprintln(os.Stderr, "-ops-key is required, the heads are only as trusted as the key they are checked against")
+			os.Exit(2)
+		}
+		var keys []crypto.PublicKey
+		for _, s := range strings.Split(*opsKeys, ",") {
+			pk, err := crypto.NewPublicKeyFromBase58(s)
+			if err != nil {
+				log.Fatalf("ops key %s: %v", s, err)
+			}
+			keys = append(keys, pk)
+		}
+		heads := *headsFile
+		if heads == "" {
+			heads = *logFile + ".heads"
+		}
+		report, err := audit.Verify(*logFile, heads, keys...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *logFile, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: %d entries, %d signed heads\n", *logFile, report.Entries, report.Heads)
+		if report.LastHead != nil {
+			fmt.Printf("last head: entry %d signed by %s at %s\n", report.LastHead.Seq, report.LastHead.Signer, report.LastHead.Time)
+			if unsigned := report.Entries - report.LastHead.Seq; unsigned > 0 {
+				fmt.Printf("%d entries after the last head are not covered by a signature yet\n", unsigned)
+			}
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/pki"
+)
+
+const usage = `usage:
+  ca init [-dir certs] [-days 3650]          create ca.pem and ca-key.pem
+  ca issue [-dir certs] [-days 365] <name>   issue <name>.pem and <name>-key.pem, e.g. coordinator, peer1`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	dir := flags.String("dir", "certs", "directory with the CA and issued certificates")
+	defaultDays := 365
+	if os.Args[1] == "init" {
+		defaultDays = 3650
+	}
+	days := flags.Int("days", defaultDays, "validity in days")
+	_ = flags.Parse(os.Args[2:])
+	validFor := time.Duration(*days) * 24 * time.Hour
+
+	switch os.Args[1] {
+	case "init":
+		if err := os.MkdirAll(*dir, 0700); err != nil {
+			log.Fatal(err)
+		}
+		ca, err := pki.NewAuthority("distributed-signature ca", validFor)
+		if err != nil {
+			log.Fatal(err)
+		}
+		certPEM, keyPEM, err := ca.PEM()
+		if err != nil {
+			log.Fatal(err)
+		}
+		write(*dir, "ca", certPEM, keyPEM)
+	case "issue":
+		if flags.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		name := flags.Arg(0)
+		caPEM, err := ioutil.ReadFile(filepath.Join(*dir, "ca.pem"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		caKeyPEM, err := ioutil.ReadFile(filepath.Join(*dir, "ca-key.pem"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		ca, err := pki.LoadAuthority(caPEM, caKeyPEM)
+		if err != nil {
+			log.Fatal(err)
+		}
+		certPEM, keyPEM, err := ca.Issue(name, validFor)
+		if err != nil {
+			log.Fatal(err)
+		}
+		write(*dir, name, certPEM, keyPEM)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func write(dir, name string, certPEM, keyPEM []byte) {
+	certPath := filepath.Join(dir, name+".pem")
+	keyPath := filepath.Join(dir, name+"-key.pem")
+	if err := ioutil.WriteFile(certPath, certPEM, 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %s and %s", certPath, keyPath)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/api"
+	"github.com/dvshur/distributed-signature/pkg/audit"
+	"github.com/dvshur/distributed-signature/pkg/metrics"
+	"github.com/dvshur/distributed-signature/pkg/peer"
+	"github.com/dvshur/distributed-signature/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address of the HTTP API")
+	addrs := flag.String("peers", "", "comma separated name@address of peerd daemons, in-process peers if empty")
+	caFile := flag.String("ca", "certs/ca.pem", "CA certificate")
+	certFile := flag.String("cert", "certs/coordinator.pem", "coordinator certificate, issued by the CA")
+	keyFile := flag.String("key", "certs/coordinator-key.pem", "coordinator key")
+	registryDir := flag.String("registry", "", "directory to keep client public keys in, lost on restart if empty")
+	recoverIDs := flag.String("recover", "", "comma separated client ids to recover from the peers' public shares on start")
+	phaseTimeout := flag.Duration("phase-timeout", peer.DefaultPhaseTimeout, "how long every round waits for the peers")
+	approvalTTL := flag.Duration("approval-ttl", 0, "how long a message waits for approvals the peers' policies require, such messages fail if 0")
+	metricsOn := flag.Bool("metrics", true, "serve Prometheus metrics on /metrics of the API address")
+	traceFile := flag.String("trace-file", "", "file to append OpenTelemetry spans to as JSON, no tracing if empty")
+	auditFile := flag.String("audit", "", "file to keep the audit log in, no log if empty")
+	opsKeyFile := flag.String("ops-key-file", "", "file with the ops key the audit log head is signed with, see cmd/audit")
+	headInterval := flag.Duration("head-interval", time.Minute, "how often the audit log head is signed")
+	flag.Parse()
+
+	var peers []peer.Peer
+	if *addrs == "" {
+		peers = []peer.Peer{peer.NewLocalPeer(), peer.NewLocalPeer(), peer.NewLocalPeer()}
+	} else {
+		remotes, err := peer.DialRemotePeers(strings.Split(*addrs, ","), *caFile, *certFile, *keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, p := range remotes {
+			defer p.Close()
+			peers = append(peers, p)
+		}
+	}
+
+	opts := []peer.Option{peer.WithPhaseTimeout(*phaseTimeout), peer.WithApprovals(*approvalTTL)}
+	if *auditFile != "" {
+		auditLog, err := audit.OpenSigned(*auditFile, *opsKeyFile, *headInterval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, peer.WithAudit(auditLog))
+	}
+	if *traceFile != "" {
+		tp, err := tracing.NewFile(*traceFile, "coordinatord")
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, peer.WithTracer(tp))
+	}
+	reg := prometheus.NewRegistry()
+	if *metricsOn {
+		reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+		opts = append(opts, peer.WithMetrics(metrics.New(reg)))
+	}
+	c, err := newCoordinator(peers, *registryDir, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *recoverIDs != "" {
+		for _, clientID := range strings.Split(*recoverIDs, ",") {
+			pk, err := c.(*peer.CoordinatorImpl).Recover(context.Background(), clientID)
+			if err != nil {
+				log.Fatalf("recover %s: %v", clientID, err)
+			}
+			log.Printf("recovered %s with public key %s", clientID, pk)
+		}
+	}
+
+	log.Printf("coordinator with %d peers listening on %s", len(peers), *addr)
+	mux := http.NewServeMux()
+	mux.Handle("/", api.NewHandler(c))
+	if *metricsOn {
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	}
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// newCoordinator loads the coordinator from the registry in registryDir, a coordinator without registryDir
+// keeps the client keys in memory
+func newCoordinator(peers []peer.Peer, registryDir string, opts []peer.Option) (peer.Coordinator, error) {
+	if registryDir == "" {
+		return peer.NewCoordinator(peers, opts...), nil
+	}
+	registry, err := peer.NewFileStore(registryDir)
+	if err != nil {
+		return nil, err
+	}
+	return peer.LoadCoordinator(peers, registry, opts...)
+}
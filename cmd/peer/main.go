@@ -1,27 +1,50 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"log"
+	"strings"
+
 	"github.com/dvshur/distributed-signature/pkg/crypto"
 	"github.com/dvshur/distributed-signature/pkg/peer"
 )
 
 func main() {
-	p1 := peer.NewLocalPeer()
-	p2 := peer.NewLocalPeer()
-	// p3 := peer.NewLocalPeer()
+	addrs := flag.String("peers", "", "comma separated name@address of peerd daemons, in-process peers if empty")
+	caFile := flag.String("ca", "certs/ca.pem", "CA certificate")
+	certFile := flag.String("cert", "certs/coordinator.pem", "coordinator certificate, issued by the CA")
+	keyFile := flag.String("key", "certs/coordinator-key.pem", "coordinator key")
+	phaseTimeout := flag.Duration("phase-timeout", peer.DefaultPhaseTimeout, "how long every round waits for the peers")
+	flag.Parse()
+
+	var peers []peer.Peer
+	if *addrs == "" {
+		peers = []peer.Peer{peer.NewLocalPeer(), peer.NewLocalPeer(), peer.NewLocalPeer()}
+	} else {
+		remotes, err := peer.DialRemotePeers(strings.Split(*addrs, ","), *caFile, *certFile, *keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, p := range remotes {
+			defer p.Close()
+			peers = append(peers, p)
+		}
+	}
 
-	c := peer.NewCoordinator([]peer.Peer{p1, p2})
+	c := peer.NewCoordinator(peers, peer.WithPhaseTimeout(*phaseTimeout))
 
 	clientID := "vasya"
+	ctx := context.Background()
 
-	pk, err := c.Keygen(clientID)
+	pk, err := c.Keygen(ctx, clientID, (len(peers)+2)/2, len(peers))
 	if err != nil {
 		panic(err)
 	}
 
 	message := []byte{1, 2, 3}
 
-	sig, err := c.Sign(clientID, message)
+	sig, err := c.Sign(ctx, clientID, message)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/audit"
+	"github.com/dvshur/distributed-signature/pkg/metrics"
+	"github.com/dvshur/distributed-signature/pkg/peer"
+	"github.com/dvshur/distributed-signature/pkg/peer/peerpb"
+	"github.com/dvshur/distributed-signature/pkg/pki"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+	"github.com/dvshur/distributed-signature/pkg/tracing"
+	"github.com/mr-tron/base58/base58"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:7001", "address to serve the peer on")
+	caFile := flag.String("ca", "certs/ca.pem", "CA certificate")
+	certFile := flag.String("cert", "", "this peer's certificate, issued by the CA")
+	keyFile := flag.String("key", "", "this peer's key")
+	allow := flag.String("allow", "coordinator", "comma separated names of clients allowed to call the peer")
+	dataDir := flag.String("data", "", "directory to keep key shares in, shares are lost on restart if empty")
+	sessionTTL := flag.Duration("session-ttl", peer.DefaultSessionTTL, "how long a signing session can be used after commit")
+	maxSessions := flag.Int("max-sessions", peer.DefaultMaxSessions, "how many signing sessions can be open at once")
+	nonceTTL := flag.Duration("nonce-ttl", peer.DefaultNonceTTL, "how long a preprocessed FROST or MuSig nonce can be used")
+	maxNonces := flag.Int("max-nonces", peer.DefaultMaxNonces, "how many preprocessed FROST or MuSig nonces of a client can be stored at once")
+	passphraseFile := flag.String("passphrase-file", "", "file with the passphrase the shares are sealed with, $PEERD_PASSPHRASE if empty")
+	peerKeys := flag.String("peer-keys", "", "comma separated base58 box keys of the other peers, shares are dealt only to them")
+	unpinned := flag.Bool("unpinned", false, "start without -peer-keys, shares are dealt to any box keys the coordinator sends")
+	printBoxKey := flag.Bool("box-key", false, "print this peer's box key to pin on the other peers and exit, requires -data")
+	policyFile := flag.String("policy", "", "JSON file with the rules messages have to pass to be signed, see package policy")
+	metricsAddr := flag.String("metrics-addr", "", "address to serve Prometheus metrics on at /metrics, no metrics if empty")
+	traceFile := flag.String("trace-file", "", "file to append OpenTelemetry spans to as JSON, no tracing if empty")
+	auditFile := flag.String("audit", "", "file to keep the audit log in, no log if empty")
+	opsKeyFile := flag.String("ops-key-file", "", "file with the ops key the audit log head is signed with, see cmd/audit")
+	headInterval := flag.Duration("head-interval", time.Minute, "how often the audit log head is signed")
+	flag.Parse()
+
+	if *printBoxKey && *dataDir == "" {
+		log.Fatal("-box-key needs -data, the box key of a peer without a store changes on restart")
+	}
+	opts := []peer.PeerOption{peer.WithSessionTTL(*sessionTTL), peer.WithMaxSessions(*maxSessions),
+		peer.WithNonceTTL(*nonceTTL), peer.WithMaxNonces(*maxNonces)}
+	switch {
+	case *peerKeys != "":
+		keys, err := parseBoxKeys(*peerKeys)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, peer.WithPeerKeys(keys...))
+	case !*printBoxKey && !*unpinned:
+		log.Fatal("no -peer-keys, pin the box keys of the other peers (see -box-key) or start with -unpinned")
+	}
+	if *policyFile != "" {
+		pol, err := policy.Load(*policyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, peer.WithPolicy(pol))
+	}
+	if *auditFile != "" {
+		auditLog, err := audit.OpenSigned(*auditFile, *opsKeyFile, *headInterval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, peer.WithPeerAudit(auditLog))
+	}
+	if *metricsAddr != "" {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+		opts = append(opts, peer.WithPeerMetrics(metrics.New(reg)))
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
+	p, err := newPeer(*dataDir, *passphraseFile, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	boxKey, err := p.BoxKey(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *printBoxKey {
+		fmt.Println(base58.Encode(boxKey[:]))
+		return
+	}
+	log.Printf("box key %s", base58.Encode(boxKey[:]))
+
+	caPEM, err := ioutil.ReadFile(*caFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	certPEM, err := ioutil.ReadFile(*certFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyPEM, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config, err := pki.ServerConfig(caPEM, certPEM, keyPEM, strings.Split(*allow, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	serverOpts := []grpc.ServerOption{grpc.Creds(credentials.NewTLS(config))}
+	if *traceFile != "" {
+		tp, err := tracing.NewFile(*traceFile, "peerd")
+		if err != nil {
+			log.Fatal(err)
+		}
+		serverOpts = append(serverOpts, peer.TraceServerOption(tp))
+	}
+	server := grpc.NewServer(serverOpts...)
+	peerpb.RegisterPeerServer(server, peer.NewPeerServer(p))
+
+	log.Printf("serving peer on %s", listener.Addr())
+	if err := server.Serve(listener); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseBoxKeys decodes comma separated base58 box keys
+func parseBoxKeys(s string) ([][32]byte, error) {
+	var keys [][32]byte
+	for _, encoded := range strings.Split(s, ",") {
+		b, err := base58.Decode(encoded)
+		if err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("invalid box key %q", encoded)
+		}
+		var key [32]byte
+		copy(key[:], b)
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// newPeer loads the peer from its sealed store in dataDir, a peer without dataDir keeps its shares in memory
+func newPeer(dataDir, passphraseFile string, opts []peer.PeerOption) (*peer.PeerLocal, error) {
+	if dataDir == "" {
+		return peer.NewLocalPeer(opts...), nil
+	}
+	files, err := peer.NewFileStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := peer.ReadPassphrase(passphraseFile, "PEERD_PASSPHRASE")
+	if err != nil {
+		return nil, err
+	}
+	store, err := peer.OpenSealedStore(files, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return peer.LoadLocalPeer(store, opts...)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dvshur/distributed-signature/pkg/peer"
+)
+
+const usage = `usage:
+  shares seal -data <dir> [-passphrase-file f]                             encrypt the plaintext shares of a peer
+  shares rotate -data <dir> [-passphrase-file f] [-new-passphrase-file f]  change the passphrase the shares are sealed with
+
+passphrases are read from $PEERD_PASSPHRASE and $PEERD_NEW_PASSPHRASE if no file is given`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	dataDir := flags.String("data", "", "directory with the peer's key shares")
+	passphraseFile := flags.String("passphrase-file", "", "file with the current passphrase")
+	newPassphraseFile := flags.String("new-passphrase-file", "", "file with the new passphrase")
+	_ = flags.Parse(os.Args[2:])
+	if *dataDir == "" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	files, err := peer.NewFileStore(*dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	passphrase, err := peer.ReadPassphrase(*passphraseFile, "PEERD_PASSPHRASE")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch os.Args[1] {
+	case "seal":
+		if _, err := peer.SealStore(files, passphrase); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("sealed shares in %s", *dataDir)
+	case "rotate":
+		newPassphrase, err := peer.ReadPassphrase(*newPassphraseFile, "PEERD_NEW_PASSPHRASE")
+		if err != nil {
+			log.Fatal(err)
+		}
+		store, err := peer.OpenSealedStore(files, passphrase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := store.Rotate(newPassphrase); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("changed the passphrase of %s", *dataDir)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
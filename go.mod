@@ -3,9 +3,17 @@ module github.com/dvshur/distributed-signature
 go 1.14
 
 require (
+	github.com/golang/protobuf v1.4.3
 	github.com/mr-tron/base58 v1.1.2
-	github.com/pkg/errors v0.8.1
-	github.com/stretchr/testify v1.5.1
+	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.8.0
+	github.com/stretchr/testify v1.7.0
 	github.com/wavesplatform/gowaves v0.6.0
-	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	google.golang.org/grpc v1.33.2
+	google.golang.org/protobuf v1.25.0
 )
@@ -0,0 +1,315 @@
+// Package api serves a Coordinator over HTTP with JSON bodies:
+//
+//	POST /keys/{clientID}       {"threshold": t, "peers": n} -> {"publicKey": "..."}
+//	GET  /keys/{clientID}                                   -> {"publicKey": "..."}
+//	POST /keys/{clientID}/sign  {"message": "..."}           -> {"signature": "..."}
+//
+// A message that waits for approvals is answered with 202 and the signing request, the request is signed off with
+//
+//	GET    /keys/{clientID}/requests                                          -> {"requests": [...]}
+//	POST   /keys/{clientID}/requests/{id}/approve {"approver": "...", "signature": "..."} -> {"request": {...}}
+//	DELETE /keys/{clientID}/requests/{id}
+//
+// and signed by posting the message to /keys/{clientID}/sign again once it is approved.
+//
+// Public keys, signatures and messages are base58 strings. Errors are returned as
+// {"error": {"code": "...", "message": "..."}} with one of the codes below.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/peer"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+	"github.com/mr-tron/base58/base58"
+)
+
+// Error codes
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUnknownClient    = "unknown_client"
+	CodeClientExists     = "client_exists"
+	CodeUnknownRequest   = "unknown_request"
+	CodePeerMisbehavior  = "peer_misbehavior"
+	CodePolicyViolation  = "policy_violation"
+	CodePeerFailure      = "peer_failure"
+	CodeTimeout          = "timeout"
+	CodeCancelled        = "cancelled"
+)
+
+// KeygenRequest is the body of POST /keys/{clientID}
+type KeygenRequest struct {
+	Threshold int `json:"threshold"`
+	Peers     int `json:"peers"`
+}
+
+// KeyResponse is returned by POST and GET /keys/{clientID}
+type KeyResponse struct {
+	PublicKey crypto.PublicKey `json:"publicKey"`
+}
+
+// SignRequest is the body of POST /keys/{clientID}/sign, the message is base58
+type SignRequest struct {
+	Message string `json:"message"`
+}
+
+// SignResponse is returned by POST /keys/{clientID}/sign
+type SignResponse struct {
+	Signature crypto.Signature `json:"signature"`
+}
+
+// Request is a signing request waiting for approvals. Approvers sign ApprovalMessage, both are base58.
+type Request struct {
+	ID              string             `json:"id"`
+	ClientID        string             `json:"clientId"`
+	Message         string             `json:"message"`
+	ApprovalMessage string             `json:"approvalMessage"`
+	Expires         time.Time          `json:"expires"`
+	Approvers       []crypto.PublicKey `json:"approvers"`
+	Approved        bool               `json:"approved"`
+}
+
+// RequestResponse is returned by POST /keys/{clientID}/sign for a message that waits for approvals
+// and by POST /keys/{clientID}/requests/{id}/approve
+type RequestResponse struct {
+	Request Request `json:"request"`
+}
+
+// RequestsResponse is returned by GET /keys/{clientID}/requests
+type RequestsResponse struct {
+	Requests []Request `json:"requests"`
+}
+
+// ApproveRequest is the body of POST /keys/{clientID}/requests/{id}/approve
+type ApproveRequest struct {
+	Approver  crypto.PublicKey `json:"approver"`
+	Signature crypto.Signature `json:"signature"`
+}
+
+// Error is the body of every failed request
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Peer is the index of the misbehaving peer for CodePeerMisbehavior
+	Peer int `json:"peer,omitempty"`
+	// Rule is the rule of a peer's signing policy that refused the message for CodePolicyViolation
+	Rule string `json:"rule,omitempty"`
+}
+
+// ErrorResponse ..
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+type handler struct {
+	coordinator peer.Coordinator
+}
+
+// approvals is implemented by coordinators that hold messages for approval, such as peer.CoordinatorImpl
+type approvals interface {
+	Requests(clientID string) []peer.SigningRequest
+	Approve(ctx context.Context, requestID string, approval peer.Approval) (*peer.SigningRequest, error)
+	Cancel(ctx context.Context, requestID string) error
+}
+
+// NewHandler returns the HTTP handler of the coordinator API
+func NewHandler(c peer.Coordinator) http.Handler {
+	h := &handler{coordinator: c}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys/", h.keys)
+	return mux
+}
+
+// keys routes /keys/{clientID}, /keys/{clientID}/sign and /keys/{clientID}/requests
+func (h *handler) keys(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/keys/"), "/")
+	clientID := parts[0]
+	approvals, hasApprovals := h.coordinator.(approvals)
+	var route string
+	switch {
+	case clientID == "":
+	case len(parts) == 1:
+		route = "key"
+	case len(parts) == 2 && parts[1] == "sign":
+		route = "sign"
+	case !hasApprovals || parts[1] != "requests":
+	case len(parts) == 2:
+		route = "requests"
+	case len(parts) == 3 && parts[2] != "":
+		route = "request"
+	case len(parts) == 4 && parts[2] != "" && parts[3] == "approve":
+		route = "approve"
+	}
+
+	switch {
+	case route == "":
+		writeError(w, http.StatusNotFound, Error{Code: CodeNotFound, Message: "no such endpoint " + r.URL.Path})
+	case route == "sign" && r.Method == http.MethodPost:
+		h.sign(w, r, clientID)
+	case route == "key" && r.Method == http.MethodPost:
+		h.keygen(w, r, clientID)
+	case route == "key" && r.Method == http.MethodGet:
+		h.publicKey(w, clientID)
+	case route == "requests" && r.Method == http.MethodGet:
+		h.requests(w, approvals, clientID)
+	case route == "request" && r.Method == http.MethodDelete:
+		h.cancel(w, r, approvals, clientID, parts[2])
+	case route == "approve" && r.Method == http.MethodPost:
+		h.approve(w, r, approvals, clientID, parts[2])
+	default:
+		writeError(w, http.StatusMethodNotAllowed, Error{Code: CodeMethodNotAllowed, Message: r.Method + " is not allowed on " + r.URL.Path})
+	}
+}
+
+func (h *handler) keygen(w http.ResponseWriter, r *http.Request, clientID string) {
+	var req KeygenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, Error{Code: CodeInvalidRequest, Message: err.Error()})
+		return
+	}
+	pk, err := h.coordinator.Keygen(r.Context(), clientID, req.Threshold, req.Peers)
+	if err != nil {
+		writeCoordinatorError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, KeyResponse{PublicKey: pk})
+}
+
+func (h *handler) publicKey(w http.ResponseWriter, clientID string) {
+	pk, ok := h.coordinator.GetPublicKey(clientID)
+	if !ok {
+		writeError(w, http.StatusNotFound, Error{Code: CodeUnknownClient, Message: "client id " + clientID + " does not exist"})
+		return
+	}
+	writeJSON(w, http.StatusOK, KeyResponse{PublicKey: pk})
+}
+
+func (h *handler) sign(w http.ResponseWriter, r *http.Request, clientID string) {
+	var req SignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, Error{Code: CodeInvalidRequest, Message: err.Error()})
+		return
+	}
+	message, err := base58.Decode(req.Message)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, Error{Code: CodeInvalidRequest, Message: "message is not base58: " + err.Error()})
+		return
+	}
+	sig, err := h.coordinator.Sign(r.Context(), clientID, message)
+	var pending *peer.PendingApprovalError
+	if errors.As(err, &pending) {
+		writeJSON(w, http.StatusAccepted, RequestResponse{Request: newRequest(&pending.Request)})
+		return
+	}
+	if err != nil {
+		writeCoordinatorError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SignResponse{Signature: sig})
+}
+
+func (h *handler) requests(w http.ResponseWriter, a approvals, clientID string) {
+	requests := a.Requests(clientID)
+	resp := RequestsResponse{Requests: make([]Request, len(requests))}
+	for i := range requests {
+		resp.Requests[i] = newRequest(&requests[i])
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) approve(w http.ResponseWriter, r *http.Request, a approvals, clientID, requestID string) {
+	var req ApproveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, Error{Code: CodeInvalidRequest, Message: err.Error()})
+		return
+	}
+	if !hasRequest(a, clientID, requestID) {
+		writeError(w, http.StatusNotFound, Error{Code: CodeUnknownRequest, Message: "request id " + requestID + " does not exist"})
+		return
+	}
+	approved, err := a.Approve(r.Context(), requestID, peer.Approval{Approver: req.Approver, Signature: req.Signature})
+	if err != nil {
+		writeCoordinatorError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RequestResponse{Request: newRequest(approved)})
+}
+
+func (h *handler) cancel(w http.ResponseWriter, r *http.Request, a approvals, clientID, requestID string) {
+	if !hasRequest(a, clientID, requestID) {
+		writeError(w, http.StatusNotFound, Error{Code: CodeUnknownRequest, Message: "request id " + requestID + " does not exist"})
+		return
+	}
+	if err := a.Cancel(r.Context(), requestID); err != nil {
+		writeCoordinatorError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// hasRequest tells if the request is a pending request of the client
+func hasRequest(a approvals, clientID, requestID string) bool {
+	for _, req := range a.Requests(clientID) {
+		if req.ID == requestID {
+			return true
+		}
+	}
+	return false
+}
+
+func newRequest(req *peer.SigningRequest) Request {
+	return Request{
+		ID:              req.ID,
+		ClientID:        req.ClientID,
+		Message:         base58.Encode(req.Message),
+		ApprovalMessage: base58.Encode(req.ApprovalMessage()),
+		Expires:         req.Expires,
+		Approvers:       append([]crypto.PublicKey{}, req.Approvers...),
+		Approved:        req.Approved,
+	}
+}
+
+// writeCoordinatorError maps an error of the coordinator to a status and a code,
+// anything not recognized is a failure of the peers
+func writeCoordinatorError(w http.ResponseWriter, err error) {
+	var misbehavior *peer.MisbehaviorError
+	var violation *policy.Violation
+	switch {
+	case errors.Is(err, peer.ErrUnknownClient):
+		writeError(w, http.StatusNotFound, Error{Code: CodeUnknownClient, Message: err.Error()})
+	case errors.Is(err, peer.ErrUnknownRequest):
+		writeError(w, http.StatusNotFound, Error{Code: CodeUnknownRequest, Message: err.Error()})
+	case errors.Is(err, peer.ErrClientExists):
+		writeError(w, http.StatusConflict, Error{Code: CodeClientExists, Message: err.Error()})
+	case errors.Is(err, peer.ErrInvalidParameters):
+		writeError(w, http.StatusBadRequest, Error{Code: CodeInvalidRequest, Message: err.Error()})
+	case errors.As(err, &violation):
+		writeError(w, http.StatusForbidden, Error{Code: CodePolicyViolation, Message: err.Error(), Rule: violation.Rule})
+	case errors.As(err, &misbehavior):
+		writeError(w, http.StatusBadGateway, Error{Code: CodePeerMisbehavior, Message: err.Error(), Peer: misbehavior.Index})
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, Error{Code: CodeTimeout, Message: err.Error()})
+	case errors.Is(err, context.Canceled):
+		writeError(w, http.StatusServiceUnavailable, Error{Code: CodeCancelled, Message: err.Error()})
+	default:
+		writeError(w, http.StatusBadGateway, Error{Code: CodePeerFailure, Message: err.Error()})
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, e Error) {
+	writeJSON(w, status, ErrorResponse{Error: e})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
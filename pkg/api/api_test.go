@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/peer"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+	"github.com/mr-tron/base58/base58"
+)
+
+// failingPeer fails every signing request
+type failingPeer struct {
+	peer.Peer
+}
+
+func (p failingPeer) Commit(ctx context.Context, clientID string, sessionID string, message []byte) (crypto.Digest, error) {
+	return crypto.Digest{}, fmt.Errorf("peer is offline")
+}
+
+func do(t *testing.T, server *httptest.Server, method, path string, body interface{}, status int, response interface{}) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, server.URL+path, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		t.Errorf("%s %s: status %d, want %d", method, path, resp.StatusCode, status)
+	}
+	if response != nil {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			t.Errorf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+func TestKeygenAndSign(t *testing.T) {
+	server := httptest.NewServer(NewHandler(peer.NewCoordinator([]peer.Peer{peer.NewLocalPeer(), peer.NewLocalPeer(), peer.NewLocalPeer()})))
+	defer server.Close()
+
+	var created KeyResponse
+	do(t, server, http.MethodPost, "/keys/vasya", KeygenRequest{Threshold: 2, Peers: 3}, http.StatusCreated, &created)
+
+	var got KeyResponse
+	do(t, server, http.MethodGet, "/keys/vasya", nil, http.StatusOK, &got)
+	if got.PublicKey != created.PublicKey {
+		t.Errorf("public key %s, created %s", got.PublicKey, created.PublicKey)
+	}
+
+	message := []byte("wallet transaction")
+	var signed SignResponse
+	do(t, server, http.MethodPost, "/keys/vasya/sign", SignRequest{Message: base58.Encode(message)}, http.StatusOK, &signed)
+	if !crypto.Verify(created.PublicKey, signed.Signature, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	peers := []peer.Peer{peer.NewLocalPeer(), peer.NewLocalPeer(), peer.NewLocalPeer()}
+	server := httptest.NewServer(NewHandler(peer.NewCoordinator([]peer.Peer{peers[0], failingPeer{peers[1]}, failingPeer{peers[2]}})))
+	defer server.Close()
+
+	do(t, server, http.MethodPost, "/keys/vasya", KeygenRequest{Threshold: 2, Peers: 3}, http.StatusCreated, nil)
+
+	cases := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/keys/petya", nil, http.StatusNotFound, CodeUnknownClient},
+		{http.MethodPost, "/keys/petya/sign", SignRequest{Message: "2"}, http.StatusNotFound, CodeUnknownClient},
+		{http.MethodPost, "/keys/vasya", KeygenRequest{Threshold: 2, Peers: 3}, http.StatusConflict, CodeClientExists},
+		{http.MethodPost, "/keys/petya", KeygenRequest{Threshold: 4, Peers: 3}, http.StatusBadRequest, CodeInvalidRequest},
+		{http.MethodPost, "/keys/vasya/sign", SignRequest{Message: "0OIl"}, http.StatusBadRequest, CodeInvalidRequest},
+		{http.MethodPost, "/keys/vasya/sign", SignRequest{Message: "2"}, http.StatusBadGateway, CodePeerFailure},
+		{http.MethodDelete, "/keys/vasya", nil, http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{http.MethodGet, "/keys/vasya/verify", nil, http.StatusNotFound, CodeNotFound},
+	}
+	for _, tc := range cases {
+		var resp ErrorResponse
+		do(t, server, tc.method, tc.path, tc.body, tc.status, &resp)
+		if resp.Error.Code != tc.code {
+			t.Errorf("%s %s: code %s, want %s", tc.method, tc.path, resp.Error.Code, tc.code)
+		}
+	}
+}
+
+func TestPolicyViolation(t *testing.T) {
+	pol, err := policy.Parse([]byte(`{"clients": {"vasya": {"messagePrefixes": ["` + base58.Encode([]byte("wallet")) + `"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []peer.Peer{peer.NewLocalPeer(peer.WithPolicy(pol)), peer.NewLocalPeer(peer.WithPolicy(pol))}
+	server := httptest.NewServer(NewHandler(peer.NewCoordinator(peers)))
+	defer server.Close()
+
+	do(t, server, http.MethodPost, "/keys/vasya", KeygenRequest{Threshold: 2, Peers: 2}, http.StatusCreated, nil)
+	do(t, server, http.MethodPost, "/keys/vasya/sign", SignRequest{Message: base58.Encode([]byte("wallet transaction"))}, http.StatusOK, nil)
+
+	var resp ErrorResponse
+	do(t, server, http.MethodPost, "/keys/vasya/sign", SignRequest{Message: base58.Encode([]byte("anything else"))}, http.StatusForbidden, &resp)
+	if resp.Error.Code != CodePolicyViolation || resp.Error.Rule != policy.RuleMessagePrefixes {
+		t.Errorf("error %+v, want a violation of %s", resp.Error, policy.RuleMessagePrefixes)
+	}
+}
+
+func TestApprovals(t *testing.T) {
+	sk, pk, err := crypto.GenerateKeyPair([]byte("approver"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pol, err := policy.Parse([]byte(`{"default": {"approvers": ["` + pk.String() + `"], "approvals": 1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []peer.Peer{peer.NewLocalPeer(peer.WithPolicy(pol)), peer.NewLocalPeer(peer.WithPolicy(pol))}
+	server := httptest.NewServer(NewHandler(peer.NewCoordinator(peers, peer.WithApprovals(time.Minute))))
+	defer server.Close()
+
+	var created KeyResponse
+	do(t, server, http.MethodPost, "/keys/vasya", KeygenRequest{Threshold: 2, Peers: 2}, http.StatusCreated, &created)
+	message := base58.Encode([]byte("treasury transfer"))
+	var pending RequestResponse
+	do(t, server, http.MethodPost, "/keys/vasya/sign", SignRequest{Message: message}, http.StatusAccepted, &pending)
+
+	var listed RequestsResponse
+	do(t, server, http.MethodGet, "/keys/vasya/requests", nil, http.StatusOK, &listed)
+	if len(listed.Requests) != 1 || listed.Requests[0].ID != pending.Request.ID {
+		t.Fatalf("requests %+v, expected %s", listed.Requests, pending.Request.ID)
+	}
+	do(t, server, http.MethodGet, "/keys/petya/requests", nil, http.StatusOK, &listed)
+	if len(listed.Requests) != 0 {
+		t.Errorf("listed requests of another client: %+v", listed.Requests)
+	}
+
+	approvalMessage, err := base58.Decode(pending.Request.ApprovalMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(sk, approvalMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var approved RequestResponse
+	do(t, server, http.MethodPost, "/keys/vasya/requests/"+pending.Request.ID+"/approve", ApproveRequest{Approver: pk, Signature: sig}, http.StatusOK, &approved)
+	if !approved.Request.Approved {
+		t.Errorf("request is not approved")
+	}
+
+	var signed SignResponse
+	do(t, server, http.MethodPost, "/keys/vasya/sign", SignRequest{Message: message}, http.StatusOK, &signed)
+	if !crypto.Verify(created.PublicKey, signed.Signature, []byte("treasury transfer")) {
+		t.Errorf("signature is not valid")
+	}
+
+	do(t, server, http.MethodPost, "/keys/vasya/sign", SignRequest{Message: message}, http.StatusAccepted, &pending)
+	do(t, server, http.MethodDelete, "/keys/petya/requests/"+pending.Request.ID, nil, http.StatusNotFound, nil)
+	do(t, server, http.MethodDelete, "/keys/vasya/requests/"+pending.Request.ID, nil, http.StatusNoContent, nil)
+	var resp ErrorResponse
+	do(t, server, http.MethodDelete, "/keys/vasya/requests/"+pending.Request.ID, nil, http.StatusNotFound, &resp)
+	if resp.Error.Code != CodeUnknownRequest {
+		t.Errorf("code %s, want %s", resp.Error.Code, CodeUnknownRequest)
+	}
+}
@@ -0,0 +1,305 @@
+// Package audit keeps an append-only, hash-chained log of the key generation and signing operations of a
+// coordinator or a peer. Every entry is a line of JSON holding the hash of the line before it, so an edited or
+// deleted entry breaks the chain at the next one. The head of the log, the hash of its last line, is signed
+// with an ops key from time to time into a separate file of heads: a log cut below a signed head, or edited
+// before it, is detected by Verify. Keep the heads file, or a copy of it, where the log's host can't change it.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+)
+
+// Operations
+const (
+	OpKeygen  = "keygen"
+	OpRefresh = "refresh"
+	OpReshare = "reshare"
+	OpRetire  = "retire"
+	OpRecover = "recover"
+	OpSign    = "sign"
+	OpPropose = "propose"
+	OpApprove = "approve"
+	OpCancel  = "cancel"
+	// OpRollback is a key share restored to the one before an unconfirmed keygen, refresh or reshare
+	OpRollback = "rollback"
+)
+
+// Results
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+const headPrefix = "distributed-signature audit head"
+
+// Entry is a line of the log
+type Entry struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Operation string    `json:"op"`
+	ClientID  string    `json:"clientId"`
+	SessionID string    `json:"sessionId,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+	// MessageDigest is crypto.FastHash of the message signed
+	MessageDigest *crypto.Digest `json:"messageDigest,omitempty"`
+	// Peers are the indices of the peers taking part
+	Peers    []int  `json:"peers,omitempty"`
+	Approver string `json:"approver,omitempty"`
+	Result   string `json:"result"`
+	Error    string `json:"error,omitempty"`
+	// Prev is the hash of the line before, zero for the first one
+	Prev crypto.Digest `json:"prev"`
+
+	// Message is hashed into MessageDigest by Append
+	Message []byte `json:"-"`
+}
+
+// Head is a signature of the hash of the log's line Seq by the ops key Signer
+type Head struct {
+	Seq       uint64           `json:"seq"`
+	Hash      crypto.Digest    `json:"hash"`
+	Time      time.Time        `json:"time"`
+	Signer    crypto.PublicKey `json:"signer"`
+	Signature crypto.Signature `json:"signature"`
+}
+
+// HeadMessage is what the ops key signs: prefix || seq || hash || time in unix nanoseconds
+func (h *Head) HeadMessage() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(headPrefix)
+	_ = binary.Write(&buf, binary.BigEndian, h.Seq)
+	buf.Write(h.Hash[:])
+	_ = binary.Write(&buf, binary.BigEndian, h.Time.UnixNano())
+	return buf.Bytes()
+}
+
+// Log appends entries to a file, path, and signed heads to path + ".heads"
+type Log struct {
+	file  *os.File
+	heads *os.File
+	seq   uint64
+	head  crypto.Digest
+	mux   sync.Mutex
+}
+
+// Open opens the log at path, creating it if it doesn't exist. The chain is verified, and a last line
+// without its newline, left by a crash in the middle of an append, is removed.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if torn := len(data) - (bytes.LastIndexByte(data, '\n') + 1); torn > 0 {
+		log.Printf("audit: removing a torn entry of %d bytes from %s", torn, path)
+		data = data[:len(data)-torn]
+		if err := file.Truncate(int64(len(data))); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	hashes, err := verifyChain(data)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, err
+	}
+	heads, err := os.OpenFile(path+".heads", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l := &Log{file: file, heads: heads, seq: uint64(len(hashes))}
+	if len(hashes) > 0 {
+		l.head = hashes[len(hashes)-1]
+	}
+	return l, nil
+}
+
+// Close closes the log files
+func (l *Log) Close() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if err := l.heads.Close(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// Append chains the entry to the log and syncs it to disk, Seq, Time, Prev and MessageDigest are set by the log
+func (l *Log) Append(e Entry) error {
+	if e.Message != nil {
+		digest, err := crypto.FastHash(e.Message)
+		if err != nil {
+			return err
+		}
+		e.MessageDigest = &digest
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	e.Seq = l.seq + 1
+	e.Time = time.Now().UTC()
+	e.Prev = l.head
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	hash, err := crypto.FastHash(line)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(line); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.seq, l.head = e.Seq, hash
+	return nil
+}
+
+// Record appends an entry for an operation that ended with err, a failure to write the log is only logged
+// so that it doesn't fail the operation
+func (l *Log) Record(e Entry, err error) {
+	e.Result = ResultOK
+	if err != nil {
+		e.Result = ResultError
+		e.Error = err.Error()
+	}
+	if err := l.Append(e); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+// SignHead signs the current head of the log with the ops key and appends it to the heads file
+func (l *Log) SignHead(sk crypto.SecretKey) (*Head, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	h := &Head{Seq: l.seq, Hash: l.head, Time: time.Now().UTC(), Signer: crypto.GeneratePublicKey(sk)}
+	sig, err := crypto.Sign(sk, h.HeadMessage())
+	if err != nil {
+		return nil, err
+	}
+	h.Signature = sig
+	line, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.heads.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	return h, l.heads.Sync()
+}
+
+// SignHeads signs the head every interval until stop is called, once more when it stops
+func (l *Log) SignHeads(sk crypto.SecretKey, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	sign := func() {
+		if _, err := l.SignHead(sk); err != nil {
+			log.Printf("audit: signing the head: %v", err)
+		}
+	}
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sign()
+			case <-done:
+				sign()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// LoadOpsKey reads an ops secret key kept in a file in base58
+func LoadOpsKey(path string) (crypto.SecretKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return crypto.SecretKey{}, err
+	}
+	return crypto.NewSecretKeyFromBase58(string(bytes.TrimSpace(data)))
+}
+
+// OpenSigned opens the log at path and signs its head every interval with the ops key kept in opsKeyFile,
+// without opsKeyFile the log is kept unsigned
+func OpenSigned(path, opsKeyFile string, interval time.Duration) (*Log, error) {
+	l, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if opsKeyFile == "" {
+		log.Printf("audit log %s is not signed, there is no ops key", path)
+		return l, nil
+	}
+	sk, err := LoadOpsKey(opsKeyFile)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	l.SignHeads(sk, interval)
+	return l, nil
+}
+
+// verifyChain checks the sequence numbers and the hash chain of the lines of a log and returns the hash of every line
+func verifyChain(data []byte) ([]crypto.Digest, error) {
+	var hashes []crypto.Digest
+	var prev crypto.Digest
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := append(append([]byte{}, scanner.Bytes()...), '\n')
+		seq := uint64(len(hashes) + 1)
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("entry %d: %v", seq, err)
+		}
+		if e.Seq != seq {
+			return nil, fmt.Errorf("entry %d has sequence number %d", seq, e.Seq)
+		}
+		if e.Prev != prev {
+			return nil, fmt.Errorf("entry %d does not follow entry %d, an entry was edited or removed", seq, seq-1)
+		}
+		hash, err := crypto.FastHash(line)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+		prev = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempLog(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "audit.log")
+}
+
+func opsKey(t *testing.T, seed string) (crypto.SecretKey, crypto.PublicKey) {
+	sk, pk, err := crypto.GenerateKeyPair([]byte(seed))
+	require.NoError(t, err)
+	return sk, pk
+}
+
+// writeLog appends n sign entries and signs the head after each of them
+func writeLog(t *testing.T, path string, sk crypto.SecretKey, n int) {
+	l, err := Open(path)
+	require.NoError(t, err)
+	defer l.Close()
+	for i := 0; i < n; i++ {
+		l.Record(Entry{Operation: OpSign, ClientID: "vasya", SessionID: "session", Message: []byte("message"), Peers: []int{1, 2}}, nil)
+		_, err := l.SignHead(sk)
+		require.NoError(t, err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	path := tempLog(t)
+	sk, pk := opsKey(t, "ops")
+	writeLog(t, path, sk, 2)
+
+	// a reopened log continues the chain
+	l, err := Open(path)
+	require.NoError(t, err)
+	l.Record(Entry{Operation: OpKeygen, ClientID: "petya", Peers: []int{1, 2, 3}}, errors.New("peer 3: offline"))
+	require.NoError(t, l.Close())
+
+	report, err := Verify(path, path+".heads", pk)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), report.Entries)
+	assert.Equal(t, 2, report.Heads)
+	assert.Equal(t, uint64(2), report.LastHead.Seq)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	digest, err := crypto.FastHash([]byte("message"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), digest.String())
+	assert.Contains(t, string(data), `"result":"error","error":"peer 3: offline"`)
+
+	_, err = Verify(path, path+".heads")
+	assert.Error(t, err, "heads without a trusted key")
+	_, other := opsKey(t, "other")
+	_, err = Verify(path, path+".heads", other)
+	assert.Error(t, err, "heads signed by another key")
+}
+
+func TestVerifyDetectsEdits(t *testing.T) {
+	path := tempLog(t)
+	sk, pk := opsKey(t, "ops")
+	writeLog(t, path, sk, 3)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+
+	// an entry edited in place
+	edited := bytes.Replace(data, []byte(`"clientId":"vasya"`), []byte(`"clientId":"petya"`), 1)
+	require.NoError(t, ioutil.WriteFile(path, edited, 0600))
+	_, err = Verify(path, "")
+	assert.Error(t, err)
+
+	// an entry removed
+	require.NoError(t, ioutil.WriteFile(path, append(append([]byte{}, lines[0]...), lines[2]...), 0600))
+	_, err = Verify(path, "")
+	assert.Error(t, err)
+
+	// the log cut below a signed head
+	require.NoError(t, ioutil.WriteFile(path, bytes.Join(lines[:2], nil), 0600))
+	_, err = Verify(path, "")
+	assert.NoError(t, err, "the chain alone can't tell a cut")
+	_, err = Verify(path, path+".heads", pk)
+	assert.Error(t, err)
+
+	// the last entry rewritten is caught by its signed head
+	last := bytes.Replace(lines[2], []byte(`"result":"ok"`), []byte(`"result":"error"`), 1)
+	require.NoError(t, ioutil.WriteFile(path, append(bytes.Join(lines[:2], nil), last...), 0600))
+	_, err = Verify(path, path+".heads", pk)
+	assert.Error(t, err)
+}
+
+func TestOpenRemovesTornEntry(t *testing.T) {
+	path := tempLog(t)
+	sk, pk := opsKey(t, "ops")
+	writeLog(t, path, sk, 2)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":3,"op":"si`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = Verify(path, "")
+	assert.Error(t, err)
+
+	writeLog(t, path, sk, 1)
+	report, err := Verify(path, path+".heads", pk)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), report.Entries)
+}
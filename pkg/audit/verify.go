@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+)
+
+// Report is what Verify found in a log that is intact
+type Report struct {
+	Entries uint64
+	// Heads is the number of signed heads checked, LastHead the last of them
+	Heads    int
+	LastHead *Head
+}
+
+// Verify checks the hash chain of the log at path and every head signed in headsPath against it, a head has to be
+// signed by one of opsKeys. The key a head names itself is not trusted, anyone able to rewrite the log could sign
+// with one. It fails for an edited entry, for a log cut below a signed head and for a head that is not signed by
+// an ops key. Entries appended after the last signed head can be cut undetected.
+func Verify(path, headsPath string, opsKeys ...crypto.PublicKey) (*Report, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		return nil, fmt.Errorf("the last entry is incomplete")
+	}
+	hashes, err := verifyChain(data)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Entries: uint64(len(hashes))}
+	if headsPath == "" {
+		return report, nil
+	}
+
+	if len(opsKeys) == 0 {
+		return nil, fmt.Errorf("no ops key to check the heads against")
+	}
+	heads, err := ioutil.ReadFile(headsPath)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(heads))
+	for scanner.Scan() {
+		var h Head
+		if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+			return nil, fmt.Errorf("head %d: %v", report.Heads+1, err)
+		}
+		if !signedBy(&h, opsKeys) {
+			return nil, fmt.Errorf("head of entry %d is not signed by the ops key", h.Seq)
+		}
+		if report.LastHead != nil && h.Seq < report.LastHead.Seq {
+			return nil, fmt.Errorf("head of entry %d is signed after the head of entry %d", h.Seq, report.LastHead.Seq)
+		}
+		if h.Seq > report.Entries {
+			return nil, fmt.Errorf("the log was cut: a head is signed at entry %d, the log has %d entries", h.Seq, report.Entries)
+		}
+		var hash crypto.Digest
+		if h.Seq > 0 {
+			hash = hashes[h.Seq-1]
+		}
+		if hash != h.Hash {
+			return nil, fmt.Errorf("entry %d is not the one signed, the log was rewritten", h.Seq)
+		}
+		report.Heads++
+		report.LastHead = &h
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func signedBy(h *Head, opsKeys []crypto.PublicKey) bool {
+	if !crypto.Verify(h.Signer, h.Signature, h.HeadMessage()) {
+		return false
+	}
+	for _, pk := range opsKeys {
+		if pk == h.Signer {
+			return true
+		}
+	}
+	return false
+}
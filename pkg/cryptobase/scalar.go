@@ -0,0 +1,49 @@
+package cryptobase
+
+// Scalars are canonical little-endian integers modulo the group order,
+// as produced by ScReduce and ScMulAdd. Outputs may overlap with inputs.
+
+var scZero [32]byte
+
+var scOne = [32]byte{1}
+
+var lMinus2 = [32]byte{0xeb, 0xd3, 0xf5, 0x5c, 0x1a, 0x63, 0x12, 0x58,
+	0xd6, 0x9c, 0xf7, 0xa2, 0xde, 0xf9, 0xde, 0x14,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10}
+
+// ScAdd computes:
+// s = a + b (mod l)
+//  where l = 2^252 + 27742317777372353535851937790883648493.
+func ScAdd(s, a, b *[32]byte) {
+	ScMulAdd(s, &scOne, a, b)
+}
+
+// ScSub computes:
+// s = a - b (mod l)
+//  where l = 2^252 + 27742317777372353535851937790883648493.
+func ScSub(s, a, b *[32]byte) {
+	ScMulAdd(s, &lMinus1, b, a)
+}
+
+// ScMul computes:
+// s = a * b (mod l)
+//  where l = 2^252 + 27742317777372353535851937790883648493.
+func ScMul(s, a, b *[32]byte) {
+	ScMulAdd(s, a, b, &scZero)
+}
+
+// ScInvert computes:
+// s = a^(l-2) = 1/a (mod l) for a != 0
+//  where l = 2^252 + 27742317777372353535851937790883648493.
+func ScInvert(s, a *[32]byte) {
+	res := scOne
+	x := *a
+	for i := 255; i >= 0; i-- {
+		ScMul(&res, &res, &res)
+		if (lMinus2[i>>3]>>(uint(i)&7))&1 == 1 {
+			ScMul(&res, &res, &x)
+		}
+	}
+	*s = res
+}
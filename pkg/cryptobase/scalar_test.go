@@ -0,0 +1,95 @@
+package cryptobase
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var groupOrder, _ = new(big.Int).SetString("7237005577332262213973186563042994240857116359379907606001950938285454250989", 10)
+
+func randomScalar(t *testing.T) [32]byte {
+	var random [64]byte
+	_, err := rand.Read(random[:])
+	require.NoError(t, err)
+	var s [32]byte
+	ScReduce(&s, &random)
+	return s
+}
+
+func scalarToInt(s *[32]byte) *big.Int {
+	be := make([]byte, 32)
+	for i := range s {
+		be[31-i] = s[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
+
+func intToScalar(i *big.Int) [32]byte {
+	var s [32]byte
+	be := i.Bytes()
+	for j := range be {
+		s[j] = be[len(be)-1-j]
+	}
+	return s
+}
+
+func TestScalarArithmetic(t *testing.T) {
+	ops := []struct {
+		name     string
+		sc       func(s, a, b *[32]byte)
+		expected func(a, b *big.Int) *big.Int
+	}{
+		{"add", ScAdd, func(a, b *big.Int) *big.Int { return new(big.Int).Add(a, b) }},
+		{"sub", ScSub, func(a, b *big.Int) *big.Int { return new(big.Int).Sub(a, b) }},
+		{"mul", ScMul, func(a, b *big.Int) *big.Int { return new(big.Int).Mul(a, b) }},
+	}
+	edges := [][32]byte{{}, {1}, intToScalar(new(big.Int).Sub(groupOrder, big.NewInt(1)))}
+	for _, op := range ops {
+		for i := 0; i < 256; i++ {
+			a, b := randomScalar(t), randomScalar(t)
+			if i < len(edges)*len(edges) {
+				a, b = edges[i/len(edges)], edges[i%len(edges)]
+			}
+			expected := op.expected(scalarToInt(&a), scalarToInt(&b))
+			expected.Mod(expected, groupOrder)
+
+			var s [32]byte
+			op.sc(&s, &a, &b)
+			assert.True(t, ScMinimal(&s), "%s result is not canonical", op.name)
+			assert.Equal(t, intToScalar(expected), s, op.name)
+
+			// outputs may overlap with inputs
+			op.sc(&a, &a, &b)
+			assert.Equal(t, s, a, "%s in place", op.name)
+		}
+	}
+}
+
+func TestScInvert(t *testing.T) {
+	for i := 0; i < 32; i++ {
+		a := randomScalar(t)
+		var inv, one [32]byte
+		ScInvert(&inv, &a)
+		assert.Equal(t, intToScalar(new(big.Int).ModInverse(scalarToInt(&a), groupOrder)), inv)
+		ScMul(&one, &a, &inv)
+		assert.Equal(t, [32]byte{1}, one)
+	}
+}
+
+func TestScalarSumManyTerms(t *testing.T) {
+	for n := 2; n <= 64; n++ {
+		var sum [32]byte
+		expected := new(big.Int)
+		for i := 0; i < n; i++ {
+			s := randomScalar(t)
+			ScAdd(&sum, &sum, &s)
+			expected.Add(expected, scalarToInt(&s))
+		}
+		expected.Mod(expected, groupOrder)
+		assert.Equal(t, intToScalar(expected), sum, "%d terms", n)
+	}
+}
@@ -0,0 +1,93 @@
+// Package metrics reports the operations of a coordinator and the sessions of a peer to Prometheus,
+// it implements peer.Metrics and peer.PeerMetrics.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "distsig"
+
+// Prometheus keeps the collectors, one value serves both a coordinator and a peer in the same process
+type Prometheus struct {
+	operations *prometheus.HistogramVec
+	phases     *prometheus.HistogramVec
+	peerCalls  *prometheus.CounterVec
+	peerErrors *prometheus.CounterVec
+	clients    prometheus.Gauge
+	sessions   prometheus.Gauge
+}
+
+// New registers the collectors with reg
+func New(reg prometheus.Registerer) *Prometheus {
+	m := &Prometheus{
+		operations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of keygen, refresh, reshare, recover and sign operations of the coordinator.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"operation", "result"}),
+		phases: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "phase_duration_seconds",
+			Help:      "Duration of the rounds of an operation that every peer it waited for completed.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"operation", "phase"}),
+		peerCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "peer_calls_total",
+			Help:      "Calls of the coordinator to a peer.",
+		}, []string{"peer", "call"}),
+		peerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "peer_errors_total",
+			Help:      "Calls of the coordinator to a peer that failed.",
+		}, []string{"peer", "call"}),
+		clients: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "clients",
+			Help:      "Clients with a key registered on the coordinator.",
+		}),
+		sessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "peer_sessions",
+			Help:      "Signing sessions open on the peer.",
+		}),
+	}
+	reg.MustRegister(m.operations, m.phases, m.peerCalls, m.peerErrors, m.clients, m.sessions)
+	return m
+}
+
+// Operation ..
+func (m *Prometheus) Operation(op string, d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.operations.WithLabelValues(op, result).Observe(d.Seconds())
+}
+
+// Phase ..
+func (m *Prometheus) Phase(op, phase string, d time.Duration) {
+	m.phases.WithLabelValues(op, phase).Observe(d.Seconds())
+}
+
+// PeerCall ..
+func (m *Prometheus) PeerCall(peer string, call string, err error) {
+	m.peerCalls.WithLabelValues(peer, call).Inc()
+	if err != nil {
+		m.peerErrors.WithLabelValues(peer, call).Inc()
+	}
+}
+
+// Clients ..
+func (m *Prometheus) Clients(n int) {
+	m.clients.Set(float64(n))
+}
+
+// Sessions ..
+func (m *Prometheus) Sessions(n int) {
+	m.sessions.Set(float64(n))
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/peer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type offlinePeer struct {
+	peer.Peer
+}
+
+func (p offlinePeer) Commit(ctx context.Context, clientID string, sessionID string, message []byte) (crypto.Digest, error) {
+	return crypto.Digest{}, errors.New("peer is offline")
+}
+
+// histogramCount returns the number of observations of the histogram with the labels
+func histogramCount(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) uint64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] != l.GetValue() {
+					continue metrics
+				}
+			}
+			return m.GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestCoordinatorMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+	peerReg := prometheus.NewRegistry()
+	sessions := New(peerReg)
+
+	local := peer.NewLocalPeer(peer.WithPeerMetrics(sessions))
+	peers := []peer.Peer{local, peer.NewLocalPeer(), offlinePeer{peer.NewLocalPeer()}}
+	c := peer.NewCoordinator(peers, peer.WithMetrics(m))
+
+	_, err := c.Keygen(context.Background(), "client", 2, 3)
+	require.NoError(t, err)
+	_, err = c.Sign(context.Background(), "client", []byte("message"))
+	require.NoError(t, err)
+	_, err = c.Sign(context.Background(), "unknown", []byte("message"))
+	require.Error(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.clients))
+	assert.Equal(t, uint64(1), histogramCount(t, reg, "distsig_operation_duration_seconds", map[string]string{"operation": "keygen", "result": "ok"}))
+	assert.Equal(t, uint64(1), histogramCount(t, reg, "distsig_operation_duration_seconds", map[string]string{"operation": "sign", "result": "ok"}))
+	assert.Equal(t, uint64(1), histogramCount(t, reg, "distsig_operation_duration_seconds", map[string]string{"operation": "sign", "result": "error"}))
+	for _, phase := range []string{"deal", "verify", "finalize"} {
+		assert.Equal(t, uint64(1), histogramCount(t, reg, "distsig_phase_duration_seconds", map[string]string{"operation": "keygen", "phase": phase}), phase)
+	}
+	for _, phase := range []string{"commit", "ri", "si"} {
+		assert.Equal(t, uint64(1), histogramCount(t, reg, "distsig_phase_duration_seconds", map[string]string{"operation": "sign", "phase": phase}), phase)
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.peerCalls.WithLabelValues(local.Name(), "Si")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.peerErrors.WithLabelValues(local.Name(), "Si")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.peerCalls.WithLabelValues(peers[2].Name(), "Commit")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.peerErrors.WithLabelValues(peers[2].Name(), "Commit")))
+
+	// the peer keeps its label with another index in the new committee
+	require.NoError(t, c.Reshare(context.Background(), "client", []peer.Peer{peers[1], local}, 2))
+	_, err = c.Sign(context.Background(), "client", []byte("message"))
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.peerCalls.WithLabelValues(local.Name(), "Si")))
+
+	// the session is closed by Si
+	assert.Equal(t, 0.0, testutil.ToFloat64(sessions.sessions))
+	_, err = local.Commit(context.Background(), "client", "session", []byte("message"))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(sessions.sessions))
+}
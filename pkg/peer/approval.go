@@ -0,0 +1,512 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/audit"
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+	"github.com/mr-tron/base58/base58"
+)
+
+// Signing a message of a client whose peers' policy names approvers is a request held by the peers until enough
+// approvers sign it off. The peers don't start a signing session for the message before that, and an approved
+// request signs once. Pending requests are kept in memory by the peers and the coordinator, until they expire.
+
+const approvalPrefix = "distributed-signature approval"
+
+// SigningRequest is a message of a client waiting for approvals
+type SigningRequest struct {
+	ID       string
+	ClientID string
+	Message  []byte
+	Expires  time.Time
+	// Approvers that signed the request off so far
+	Approvers []crypto.PublicKey
+	// Approved is set once a threshold of the peers holding the request have the approvals they need
+	Approved bool
+}
+
+// ApprovalMessage is what an approver signs with crypto.Sign to approve the request:
+// prefix || request id || client id || expiry in unix seconds || message, the ids are length prefixed
+func (r *SigningRequest) ApprovalMessage() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(approvalPrefix)
+	for _, s := range []string{r.ID, r.ClientID} {
+		_ = binary.Write(&buf, binary.BigEndian, uint16(len(s)))
+		buf.WriteString(s)
+	}
+	_ = binary.Write(&buf, binary.BigEndian, r.Expires.Unix())
+	buf.Write(r.Message)
+	return buf.Bytes()
+}
+
+// Approval is an approver's signature of SigningRequest.ApprovalMessage
+type Approval struct {
+	Approver  crypto.PublicKey
+	Signature crypto.Signature
+}
+
+func randomRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base58.Encode(b), nil
+}
+
+// heldRequest is a signing request held by a peer and the approvers that signed it off
+type heldRequest struct {
+	request    SigningRequest
+	approvedBy map[crypto.PublicKey]bool
+}
+
+// Hold keeps the request until it expires, approved or not. Only clients that need approvals have requests.
+func (p *PeerLocal) Hold(ctx context.Context, req *SigningRequest) error {
+	err := p.hold(req)
+	p.record(audit.Entry{Operation: audit.OpPropose, ClientID: req.ClientID, RequestID: req.ID, Message: req.Message}, err)
+	return err
+}
+
+func (p *PeerLocal) hold(req *SigningRequest) error {
+	p.mux.RLock()
+	_, clientExists := p.keys[req.ClientID]
+	p.mux.RUnlock()
+
+	if !clientExists {
+		return fmt.Errorf("client id %s does not exist", req.ClientID)
+	}
+	if p.policy == nil {
+		return fmt.Errorf("client id %s needs no approvals", req.ClientID)
+	}
+	if _, quorum := p.policy.Approvers(req.ClientID); quorum == 0 {
+		return fmt.Errorf("client id %s needs no approvals", req.ClientID)
+	}
+
+	now := time.Now()
+	if req.ID == "" || !now.Before(req.Expires) {
+		return fmt.Errorf("request id %q is empty or expired", req.ID)
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if _, exists := p.requests[req.ID]; exists {
+		return fmt.Errorf("request id %s already exists", req.ID)
+	}
+	for id, h := range p.requests {
+		if !now.Before(h.request.Expires) {
+			delete(p.requests, id)
+		}
+	}
+	if len(p.requests) >= p.maxSessions {
+		return fmt.Errorf("too many signing requests, %d are pending", len(p.requests))
+	}
+	p.requests[req.ID] = heldRequest{
+		request: SigningRequest{
+			ID:       req.ID,
+			ClientID: req.ClientID,
+			Message:  append([]byte{}, req.Message...),
+			Expires:  time.Unix(req.Expires.Unix(), 0),
+		},
+		approvedBy: make(map[crypto.PublicKey]bool),
+	}
+	return nil
+}
+
+// Approve checks the approval with crypto.Verify against the approvers of the client's policy
+// and returns whether the request has all the approvals it needs
+func (p *PeerLocal) Approve(ctx context.Context, clientID string, requestID string, approval Approval) (bool, error) {
+	approved, err := p.approve(clientID, requestID, approval)
+	p.record(audit.Entry{Operation: audit.OpApprove, ClientID: clientID, RequestID: requestID, Approver: approval.Approver.String()}, err)
+	return approved, err
+}
+
+func (p *PeerLocal) approve(clientID string, requestID string, approval Approval) (bool, error) {
+	if p.policy == nil {
+		return false, fmt.Errorf("client id %s needs no approvals", clientID)
+	}
+	approvers, quorum := p.policy.Approvers(clientID)
+	known := false
+	for _, pk := range approvers {
+		if pk == approval.Approver {
+			known = true
+		}
+	}
+	if !known {
+		return false, fmt.Errorf("%s is not an approver of client id %s", approval.Approver, clientID)
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	h, exists := p.requests[requestID]
+	if !exists || h.request.ClientID != clientID {
+		return false, fmt.Errorf("request id %s does not exist", requestID)
+	}
+	if !time.Now().Before(h.request.Expires) {
+		delete(p.requests, requestID)
+		return false, fmt.Errorf("request id %s expired", requestID)
+	}
+	if !crypto.Verify(approval.Approver, approval.Signature, h.request.ApprovalMessage()) {
+		return false, fmt.Errorf("invalid approval of request id %s by %s", requestID, approval.Approver)
+	}
+	h.approvedBy[approval.Approver] = true
+	return len(h.approvedBy) >= quorum, nil
+}
+
+// Cancel drops the request, a request that doesn't exist is already cancelled
+func (p *PeerLocal) Cancel(ctx context.Context, clientID string, requestID string) error {
+	p.mux.Lock()
+	h, exists := p.requests[requestID]
+	dropped := exists && h.request.ClientID == clientID
+	if dropped {
+		delete(p.requests, requestID)
+	}
+	p.mux.Unlock()
+	if dropped {
+		p.record(audit.Entry{Operation: audit.OpCancel, ClientID: clientID, RequestID: requestID}, nil)
+	}
+	return nil
+}
+
+// checkApproval returns a *policy.Violation if the client needs approvals and the message has no approved request,
+// with consume the request is used up
+func (p *PeerLocal) checkApproval(clientID string, message []byte, consume bool) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.approved(clientID, message, consume)
+}
+
+// approved is checkApproval with p.mux locked
+func (p *PeerLocal) approved(clientID string, message []byte, consume bool) error {
+	if p.policy == nil {
+		return nil
+	}
+	_, quorum := p.policy.Approvers(clientID)
+	if quorum == 0 {
+		return nil
+	}
+	now := time.Now()
+	for id, h := range p.requests {
+		if h.request.ClientID == clientID && bytes.Equal(h.request.Message, message) &&
+			now.Before(h.request.Expires) && len(h.approvedBy) >= quorum {
+			if consume {
+				delete(p.requests, id)
+			}
+			return nil
+		}
+	}
+	return &policy.Violation{ClientID: clientID, Rule: policy.RuleApprovals, Reason: fmt.Sprintf("message has no approval of %d approvers", quorum)}
+}
+
+// refuseApprovals returns a *policy.Violation if the client needs approvals, for keys that can't be approved
+func (p *PeerLocal) refuseApprovals(clientID string) error {
+	if p.policy == nil {
+		return nil
+	}
+	if _, quorum := p.policy.Approvers(clientID); quorum > 0 {
+		return &policy.Violation{ClientID: clientID, Rule: policy.RuleApprovals, Reason: "musig keys can't be approved"}
+	}
+	return nil
+}
+
+// WithApprovals makes Sign hold a message the peers refuse for lack of approvals in a request that expires after ttl,
+// instead of failing with the *policy.Violation
+func WithApprovals(ttl time.Duration) Option {
+	return func(o *options) {
+		o.approvalTTL = ttl
+	}
+}
+
+// pendingRequest is a signing request and the members holding it
+type pendingRequest struct {
+	SigningRequest
+	holders []member
+}
+
+func (r *pendingRequest) clone() SigningRequest {
+	req := r.SigningRequest
+	req.Message = append([]byte{}, r.Message...)
+	req.Approvers = append([]crypto.PublicKey{}, r.Approvers...)
+	return req
+}
+
+// withApprovals runs sign unless the message waits for approvals. A message the peers refuse for lack of approvals
+// is proposed for approval, once the request is approved sign runs and the request is done. Signers may have used up
+// their approvals in a sign that failed, so the request is cancelled then and has to be proposed again.
+func (c *CoordinatorImpl) withApprovals(ctx context.Context, clientID string, message []byte, sign func() (crypto.Signature, error)) (crypto.Signature, error) {
+	var signature crypto.Signature
+	if c.approvalTTL == 0 {
+		return sign()
+	}
+
+	req, snapshot := c.findRequest(clientID, message)
+	if req != nil && !snapshot.Approved {
+		return signature, &PendingApprovalError{Request: snapshot}
+	}
+
+	signature, err := sign()
+	var violation *policy.Violation
+	switch {
+	case err == nil && req != nil:
+		// signers used up their approvals, the rest of the holders drop theirs
+		c.dropRequest(ctx, req)
+	case req != nil:
+		c.dropRequest(ctx, req)
+		return signature, &RequestFailedError{RequestID: req.ID, Err: err}
+	case req == nil && errors.As(err, &violation) && violation.Rule == policy.RuleApprovals:
+		proposed, err := c.Propose(ctx, clientID, message, c.approvalTTL)
+		if err != nil {
+			return signature, err
+		}
+		return signature, &PendingApprovalError{Request: *proposed}
+	}
+	return signature, err
+}
+
+// findRequest returns the pending request of the client for the message and a copy of it, nil if there is none
+func (c *CoordinatorImpl) findRequest(clientID string, message []byte) (*pendingRequest, SigningRequest) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.expireRequests(time.Now())
+	for _, req := range c.requests {
+		if req.ClientID == clientID && bytes.Equal(req.Message, message) {
+			return req, req.clone()
+		}
+	}
+	return nil, SigningRequest{}
+}
+
+// expireRequests deletes the requests past their expiry, c.mux has to be locked
+func (c *CoordinatorImpl) expireRequests(now time.Time) {
+	for id, req := range c.requests {
+		if !now.Before(req.Expires) {
+			delete(c.requests, id)
+		}
+	}
+}
+
+// Propose asks the members of the client's committee to hold a request to sign the message until it expires after ttl.
+// Approvers sign the request's ApprovalMessage, Sign signs the message once the request is approved.
+func (c *CoordinatorImpl) Propose(ctx context.Context, clientID string, message []byte, ttl time.Duration) (*SigningRequest, error) {
+	req, err := c.propose(ctx, clientID, message, ttl)
+	e := audit.Entry{Operation: audit.OpPropose, ClientID: clientID, Message: message}
+	if req != nil {
+		e.RequestID = req.ID
+	}
+	c.record(e, err)
+	return req, err
+}
+
+func (c *CoordinatorImpl) propose(ctx context.Context, clientID string, message []byte, ttl time.Duration) (*SigningRequest, error) {
+	c.mux.RLock()
+	_, clientExists := c.pubKeysEd[clientID]
+	cm := c.committees[clientID]
+	c.mux.RUnlock()
+	if !clientExists {
+		return nil, fmt.Errorf("client id %s: %w", clientID, ErrUnknownClient)
+	}
+
+	id, err := randomRequestID()
+	if err != nil {
+		return nil, err
+	}
+	req := &pendingRequest{SigningRequest: SigningRequest{
+		ID:       id,
+		ClientID: clientID,
+		Message:  append([]byte{}, message...),
+		Expires:  time.Unix(time.Now().Add(ttl).Unix(), 0),
+	}}
+
+	holdCtx, cancelHold := c.phase(ctx)
+	defer cancelHold()
+	holdErrors := make(chan error, len(cm.members))
+	HH := make(chan member, len(cm.members))
+	for _, m := range cm.members {
+		go func(m member) {
+			callCtx, done := c.peerCall(holdCtx, m.index, m.peer, "Hold")
+			err := m.peer.Hold(callCtx, &req.SigningRequest)
+			done(err)
+			if err != nil {
+				holdErrors <- err
+				return
+			}
+			HH <- m
+		}(m)
+	}
+	var lastErr error
+holding:
+	for range cm.members {
+		select {
+		case m := <-HH:
+			req.holders = append(req.holders, m)
+		case err := <-holdErrors:
+			lastErr = err
+		case <-holdCtx.Done():
+			if ctx.Err() != nil {
+				return nil, phaseError("hold", holdCtx)
+			}
+			break holding
+		}
+	}
+	if len(req.holders) < cm.threshold {
+		c.dropRequest(ctx, req)
+		return nil, fmt.Errorf("request id %s: %d peers hold the request, threshold is %d: %v", id, len(req.holders), cm.threshold, lastErr)
+	}
+
+	c.mux.Lock()
+	c.requests[id] = req
+	proposed := req.clone()
+	c.mux.Unlock()
+	return &proposed, nil
+}
+
+// Requests returns the pending requests of the client, of all clients if clientID is empty
+func (c *CoordinatorImpl) Requests(clientID string) []SigningRequest {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.expireRequests(time.Now())
+	requests := make([]SigningRequest, 0, len(c.requests))
+	for _, req := range c.requests {
+		if clientID == "" || req.ClientID == clientID {
+			requests = append(requests, req.clone())
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].Expires.Equal(requests[j].Expires) {
+			return requests[i].Expires.Before(requests[j].Expires)
+		}
+		return requests[i].ID < requests[j].ID
+	})
+	return requests
+}
+
+// Approve passes an approval of the request to the peers holding it, each of them checks it against its policy.
+// The request is approved once a threshold of them have all the approvals they need.
+func (c *CoordinatorImpl) Approve(ctx context.Context, requestID string, approval Approval) (*SigningRequest, error) {
+	req, err := c.approve(ctx, requestID, approval)
+	e := audit.Entry{Operation: audit.OpApprove, RequestID: requestID, Approver: approval.Approver.String()}
+	if req != nil {
+		e.ClientID = req.ClientID
+	}
+	c.record(e, err)
+	return req, err
+}
+
+func (c *CoordinatorImpl) approve(ctx context.Context, requestID string, approval Approval) (*SigningRequest, error) {
+	c.mux.Lock()
+	c.expireRequests(time.Now())
+	req, exists := c.requests[requestID]
+	var approvalMessage []byte
+	var cm committee
+	if exists {
+		approvalMessage = req.ApprovalMessage()
+		cm = c.committees[req.ClientID]
+	}
+	c.mux.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("request id %s: %w", requestID, ErrUnknownRequest)
+	}
+	if !crypto.Verify(approval.Approver, approval.Signature, approvalMessage) {
+		return nil, fmt.Errorf("invalid approval of request id %s by %s: %w", requestID, approval.Approver, ErrInvalidParameters)
+	}
+
+	approveCtx, cancelApprove := c.phase(ctx)
+	defer cancelApprove()
+	approveErrors := make(chan error, len(req.holders))
+	AA := make(chan bool, len(req.holders))
+	for _, m := range req.holders {
+		go func(m member) {
+			callCtx, done := c.peerCall(approveCtx, m.index, m.peer, "Approve")
+			approved, err := m.peer.Approve(callCtx, req.ClientID, requestID, approval)
+			done(err)
+			if err != nil {
+				approveErrors <- err
+				return
+			}
+			AA <- approved
+		}(m)
+	}
+	accepted, approved := 0, 0
+	var lastErr error
+approving:
+	for range req.holders {
+		select {
+		case ok := <-AA:
+			accepted++
+			if ok {
+				approved++
+			}
+		case err := <-approveErrors:
+			lastErr = err
+		case <-approveCtx.Done():
+			if ctx.Err() != nil {
+				return nil, phaseError("approve", approveCtx)
+			}
+			break approving
+		}
+	}
+	if accepted < cm.threshold {
+		return nil, fmt.Errorf("request id %s: %d peers accepted the approval, threshold is %d: %v", requestID, accepted, cm.threshold, lastErr)
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	known := false
+	for _, pk := range req.Approvers {
+		if pk == approval.Approver {
+			known = true
+		}
+	}
+	if !known {
+		req.Approvers = append(req.Approvers, approval.Approver)
+	}
+	if approved >= cm.threshold {
+		req.Approved = true
+	}
+	approvedReq := req.clone()
+	return &approvedReq, nil
+}
+
+// Cancel drops the request on the coordinator and on the peers holding it,
+// a peer that can't be reached drops it when it expires
+func (c *CoordinatorImpl) Cancel(ctx context.Context, requestID string) error {
+	c.mux.Lock()
+	req, exists := c.requests[requestID]
+	c.mux.Unlock()
+	if !exists {
+		err := fmt.Errorf("request id %s: %w", requestID, ErrUnknownRequest)
+		c.record(audit.Entry{Operation: audit.OpCancel, RequestID: requestID}, err)
+		return err
+	}
+	c.dropRequest(ctx, req)
+	c.record(audit.Entry{Operation: audit.OpCancel, ClientID: req.ClientID, RequestID: requestID}, nil)
+	return nil
+}
+
+// dropRequest deletes the request and asks its holders to cancel it
+func (c *CoordinatorImpl) dropRequest(ctx context.Context, req *pendingRequest) {
+	c.mux.Lock()
+	delete(c.requests, req.ID)
+	c.mux.Unlock()
+
+	cancelCtx, cancel := c.phase(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, m := range req.holders {
+		wg.Add(1)
+		go func(m member) {
+			defer wg.Done()
+			callCtx, done := c.peerCall(cancelCtx, m.index, m.peer, "Cancel")
+			done(m.peer.Cancel(callCtx, req.ClientID, req.ID))
+		}(m)
+	}
+	wg.Wait()
+}
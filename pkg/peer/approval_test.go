@@ -0,0 +1,213 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+)
+
+type approver struct {
+	sk crypto.SecretKey
+	pk crypto.PublicKey
+}
+
+func newApprover(t *testing.T, seed string) approver {
+	sk, pk, err := crypto.GenerateKeyPair([]byte(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return approver{sk, pk}
+}
+
+func (a approver) approve(t *testing.T, req SigningRequest) Approval {
+	sig, err := crypto.Sign(a.sk, req.ApprovalMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Approval{Approver: a.pk, Signature: sig}
+}
+
+// approvalPeers serves three peers over gRPC that need two of the approvers to sign for "client"
+func approvalPeers(t *testing.T, approvers ...approver) ([]*PeerLocal, []Peer) {
+	pol, err := policy.Parse([]byte(`{"clients": {"client": {"approvers": ["` + approvers[0].pk.String() + `", "` + approvers[1].pk.String() + `"], "approvals": 2}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	locals := make([]*PeerLocal, 3)
+	peers := make([]Peer, 3)
+	for i := range peers {
+		locals[i] = NewLocalPeer(WithPolicy(pol))
+		peers[i] = servePeer(t, locals[i])
+	}
+	return locals, peers
+}
+
+func TestSignWaitsForApprovals(t *testing.T) {
+	alice, bob, eve := newApprover(t, "alice"), newApprover(t, "bob"), newApprover(t, "eve")
+	locals, peers := approvalPeers(t, alice, bob)
+	c := NewCoordinator(peers, WithApprovals(time.Minute)).(*CoordinatorImpl)
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	message := []byte("treasury transfer")
+	_, err = c.Sign(context.Background(), "client", message)
+	var pending *PendingApprovalError
+	if !errors.As(err, &pending) || !errors.Is(err, ErrPendingApproval) {
+		t.Fatalf("expected a pending request, got %v", err)
+	}
+	req := pending.Request
+	for i, p := range locals {
+		if n := len(p.sessionsRi); n != 0 {
+			t.Errorf("peer %d opened %d sessions before approval", i, n)
+		}
+	}
+	if requests := c.Requests("client"); len(requests) != 1 || requests[0].ID != req.ID {
+		t.Errorf("requests %v, expected %s", requests, req.ID)
+	}
+
+	if _, err := c.Approve(context.Background(), req.ID, eve.approve(t, req)); err == nil {
+		t.Errorf("approved by someone who is not an approver")
+	}
+	forged := alice.approve(t, req)
+	forged.Approver = bob.pk
+	if _, err := c.Approve(context.Background(), req.ID, forged); !errors.Is(err, ErrInvalidParameters) {
+		t.Errorf("accepted a forged approval: %v", err)
+	}
+
+	approved, err := c.Approve(context.Background(), req.ID, alice.approve(t, req))
+	if err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+	if approved.Approved {
+		t.Errorf("approved by one of two approvers")
+	}
+	if _, err := c.Sign(context.Background(), "client", message); !errors.As(err, &pending) || pending.Request.ID != req.ID {
+		t.Errorf("expected request %s to be pending, got %v", req.ID, err)
+	}
+
+	if approved, err = c.Approve(context.Background(), req.ID, bob.approve(t, req)); err != nil || !approved.Approved {
+		t.Fatalf("request is not approved: %v", err)
+	}
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+
+	// the approval is used up
+	if requests := c.Requests(""); len(requests) != 0 {
+		t.Errorf("requests left after signing: %v", requests)
+	}
+	if _, err := c.Sign(context.Background(), "client", message); !errors.As(err, &pending) || pending.Request.ID == req.ID {
+		t.Errorf("expected a new pending request, got %v", err)
+	}
+}
+
+func TestFailedSignCancelsRequest(t *testing.T) {
+	alice, bob := newApprover(t, "alice"), newApprover(t, "bob")
+	locals, peers := approvalPeers(t, alice, bob)
+	c := NewCoordinator(peers, WithApprovals(time.Minute)).(*CoordinatorImpl)
+	if _, err := c.Keygen(context.Background(), "client", 3, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	c.committees["client"].members[1].peer = cheatingPeer{peers[1]}
+
+	message := []byte("treasury transfer")
+	_, err := c.Sign(context.Background(), "client", message)
+	var pending *PendingApprovalError
+	if !errors.As(err, &pending) {
+		t.Fatalf("expected a pending request, got %v", err)
+	}
+	req := pending.Request
+	for _, a := range []approver{alice, bob} {
+		if _, err := c.Approve(context.Background(), req.ID, a.approve(t, req)); err != nil {
+			t.Fatalf("approve failed: %v", err)
+		}
+	}
+
+	// the signers used up their approvals in the failed sign, the request can't be signed with again
+	_, err = c.Sign(context.Background(), "client", message)
+	var failed *RequestFailedError
+	var misbehavior *MisbehaviorError
+	if !errors.As(err, &failed) || failed.RequestID != req.ID || !errors.As(err, &misbehavior) {
+		t.Fatalf("expected request %s to fail with the misbehavior, got %v", req.ID, err)
+	}
+	if requests := c.Requests(""); len(requests) != 0 {
+		t.Errorf("requests left after a failed sign: %v", requests)
+	}
+	for i, p := range locals {
+		if n := len(p.requests); n != 0 {
+			t.Errorf("peer %d holds %d requests after a failed sign", i, n)
+		}
+	}
+	if _, err := c.Sign(context.Background(), "client", message); !errors.As(err, &pending) || pending.Request.ID == req.ID {
+		t.Errorf("expected a new pending request, got %v", err)
+	}
+}
+
+func TestCancelRequest(t *testing.T) {
+	alice, bob := newApprover(t, "alice"), newApprover(t, "bob")
+	locals, peers := approvalPeers(t, alice, bob)
+	c := NewCoordinator(peers).(*CoordinatorImpl)
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	// without WithApprovals the peers' refusal is returned as is
+	_, err := c.Sign(context.Background(), "client", []byte("message"))
+	var violation *policy.Violation
+	if !errors.As(err, &violation) || violation.Rule != policy.RuleApprovals {
+		t.Errorf("expected a violation of %s, got %v", policy.RuleApprovals, err)
+	}
+
+	req, err := c.Propose(context.Background(), "client", []byte("message"), time.Minute)
+	if err != nil {
+		t.Fatalf("propose failed: %v", err)
+	}
+	if err := c.Cancel(context.Background(), req.ID); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	for i, p := range locals {
+		if n := len(p.requests); n != 0 {
+			t.Errorf("peer %d holds %d requests after cancel", i, n)
+		}
+	}
+	if _, err := c.Approve(context.Background(), req.ID, alice.approve(t, *req)); !errors.Is(err, ErrUnknownRequest) {
+		t.Errorf("approved a cancelled request: %v", err)
+	}
+	if err := c.Cancel(context.Background(), req.ID); !errors.Is(err, ErrUnknownRequest) {
+		t.Errorf("cancelled a request twice: %v", err)
+	}
+}
+
+func TestRequestExpires(t *testing.T) {
+	alice, bob := newApprover(t, "alice"), newApprover(t, "bob")
+	_, peers := approvalPeers(t, alice, bob)
+	c := NewCoordinator(peers).(*CoordinatorImpl)
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	req, err := c.Propose(context.Background(), "client", []byte("message"), 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("propose failed: %v", err)
+	}
+	time.Sleep(time.Until(req.Expires))
+	if _, err := c.Approve(context.Background(), req.ID, alice.approve(t, *req)); !errors.Is(err, ErrUnknownRequest) {
+		t.Errorf("approved an expired request: %v", err)
+	}
+	if requests := c.Requests("client"); len(requests) != 0 {
+		t.Errorf("expired requests are listed: %v", requests)
+	}
+	if _, err := peers[0].Approve(context.Background(), "client", req.ID, alice.approve(t, *req)); err == nil {
+		t.Errorf("peer approved an expired request")
+	}
+}
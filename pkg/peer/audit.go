@@ -0,0 +1,69 @@
+package peer
+
+import (
+	"sort"
+
+	"github.com/dvshur/distributed-signature/pkg/audit"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+)
+
+// WithAudit makes the coordinator record its key generation, signing and approval operations in the log
+func WithAudit(l *audit.Log) Option {
+	return func(o *options) {
+		o.auditLog = l
+	}
+}
+
+// WithPeerAudit makes the peer record the key shares it makes, the partial signatures it releases
+// and the signing requests it holds in the log
+func WithPeerAudit(l *audit.Log) PeerOption {
+	return func(p *PeerLocal) {
+		p.auditLog = l
+	}
+}
+
+// record appends an entry to the audit log, if there is one
+func (o options) record(e audit.Entry, err error) {
+	if o.auditLog != nil {
+		o.auditLog.Record(e, err)
+	}
+}
+
+// record appends an entry to the audit log, if there is one
+func (p *PeerLocal) record(e audit.Entry, err error) {
+	if p.auditLog != nil {
+		p.auditLog.Record(e, err)
+	}
+}
+
+// committeeIndices returns the indices of the members of the client's committee, none if err is set
+func (c *CoordinatorImpl) committeeIndices(clientID string, err error) []int {
+	if err != nil {
+		return nil
+	}
+	c.mux.RLock()
+	cm := c.committees[clientID]
+	c.mux.RUnlock()
+	return memberIndices(cm.members)
+}
+
+func memberIndices(members []member) []int {
+	if len(members) == 0 {
+		return nil
+	}
+	indices := make([]int, len(members))
+	for i, m := range members {
+		indices[i] = m.index
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+func nonceIndices(nonces map[int]cryptobase.ExtendedGroupElement) []int {
+	indices := make([]int, 0, len(nonces))
+	for i := range nonces {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	return indices
+}
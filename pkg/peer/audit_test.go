@@ -0,0 +1,110 @@
+package peer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dvshur/distributed-signature/pkg/audit"
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+)
+
+func openAuditLog(t *testing.T, path string) *audit.Log {
+	l, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func readAuditLog(t *testing.T, path string) []audit.Entry {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []audit.Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e audit.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	dir := tempDir(t)
+	ops, _, err := crypto.GenerateKeyPair([]byte("ops"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := make([]Peer, 3)
+	for i := range peers {
+		peers[i] = NewLocalPeer(WithPeerAudit(openAuditLog(t, filepath.Join(dir, fmt.Sprintf("peer%d.log", i+1)))))
+	}
+	peers[2] = offlinePeer{peers[2]}
+	coordinatorLog := openAuditLog(t, filepath.Join(dir, "coordinator.log"))
+	c := NewCoordinator(peers, WithAudit(coordinatorLog))
+
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	message := []byte("audited")
+	if _, err := c.Sign(context.Background(), "client", message); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if _, err := c.Sign(context.Background(), "unknown", message); err == nil {
+		t.Fatalf("signed for an unknown client")
+	}
+	if _, err := coordinatorLog.SignHead(ops); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := crypto.FastHash(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := readAuditLog(t, filepath.Join(dir, "coordinator.log"))
+	if len(entries) != 3 {
+		t.Fatalf("coordinator logged %d entries, expected 3", len(entries))
+	}
+	if e := entries[0]; e.Operation != audit.OpKeygen || e.Result != audit.ResultOK || !reflect.DeepEqual(e.Peers, []int{1, 2, 3}) {
+		t.Errorf("unexpected keygen entry %+v", e)
+	}
+	sign := entries[1]
+	if sign.Operation != audit.OpSign || sign.Result != audit.ResultOK || sign.SessionID == "" ||
+		sign.MessageDigest == nil || *sign.MessageDigest != digest || !reflect.DeepEqual(sign.Peers, []int{1, 2}) {
+		t.Errorf("unexpected sign entry %+v", sign)
+	}
+	if e := entries[2]; e.ClientID != "unknown" || e.Result != audit.ResultError || e.Error == "" {
+		t.Errorf("unexpected failed sign entry %+v", e)
+	}
+
+	// every signer logs the session it signed in
+	for i := 1; i <= 2; i++ {
+		entries := readAuditLog(t, filepath.Join(dir, fmt.Sprintf("peer%d.log", i)))
+		if len(entries) != 2 || entries[0].Operation != audit.OpKeygen {
+			t.Fatalf("peer %d logged %+v", i, entries)
+		}
+		if e := entries[1]; e.Operation != audit.OpSign || e.SessionID != sign.SessionID || *e.MessageDigest != digest || !reflect.DeepEqual(e.Peers, []int{1, 2}) {
+			t.Errorf("peer %d: unexpected sign entry %+v", i, e)
+		}
+	}
+
+	report, err := audit.Verify(filepath.Join(dir, "coordinator.log"), filepath.Join(dir, "coordinator.log.heads"), crypto.GeneratePublicKey(ops))
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if report.Entries != 3 || report.LastHead.Seq != 3 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,126 @@
+package peer
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+	"github.com/mr-tron/base58/base58"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Shares dealt by a keygen, refresh or reshare are sealed to the box key (X25519) of their recipient with an anonymous NaCl box,
+// the coordinator relays the sealed shares and the commitments but can't open a share.
+// A peer's box key is generated on first use and kept in its store. Pinned with WithPeerKeys,
+// a peer deals only to the keys of the other peers it was set up with, not to keys chosen by the coordinator.
+
+// boxKeyPair is the key pair shares dealt to a peer are sealed to
+type boxKeyPair struct {
+	Public [32]byte
+	Secret [32]byte
+}
+
+// WithPeerKeys pins the box keys of the other peers, shares are sealed to these keys and this peer's own only
+func WithPeerKeys(keys ...[32]byte) PeerOption {
+	return func(p *PeerLocal) {
+		p.peerKeys = make(map[[32]byte]bool, len(keys))
+		for _, key := range keys {
+			p.peerKeys[key] = true
+		}
+	}
+}
+
+// BoxKey returns the public key the shares dealt to this peer are sealed to
+func (p *PeerLocal) BoxKey(ctx context.Context) (*[32]byte, error) {
+	kp, err := p.boxKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	return &kp.Public, nil
+}
+
+// Name is the base58 box key of the peer, it is kept in the store so it stays the same on restart
+func (p *PeerLocal) Name() string {
+	kp, err := p.boxKeyPair()
+	if err != nil {
+		return ""
+	}
+	return base58.Encode(kp.Public[:])
+}
+
+// boxKeyPair returns the box key pair of the peer, generating and storing it if there's none yet
+func (p *PeerLocal) boxKeyPair() (*boxKeyPair, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.boxKey != nil {
+		return p.boxKey, nil
+	}
+	public, secret, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kp := &boxKeyPair{Public: *public, Secret: *secret}
+	if p.store != nil {
+		if err := p.store.Put(boxKeyName, kp.Secret[:]); err != nil {
+			return nil, err
+		}
+	}
+	p.boxKey = kp
+	return kp, nil
+}
+
+// loadBoxKey restores the key pair from the secret key kept in the store
+func loadBoxKey(secret []byte) (*boxKeyPair, error) {
+	var kp boxKeyPair
+	if len(secret) != len(kp.Secret) {
+		return nil, fmt.Errorf("box key has %d bytes", len(secret))
+	}
+	copy(kp.Secret[:], secret)
+	curve25519.ScalarBaseMult(&kp.Public, &kp.Secret)
+	return &kp, nil
+}
+
+// sealShares seals the share of every participant to the participant's box key,
+// no two participants can have the same key or one peer would get the shares of both
+func (p *PeerLocal) sealShares(shares map[int][32]byte, keys map[int][32]byte) (map[int][]byte, error) {
+	own, err := p.boxKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	sealed := make(map[int][]byte, len(shares))
+	participants := make(map[[32]byte]int, len(shares))
+	for j, share := range shares {
+		key, ok := keys[j]
+		if !ok {
+			return nil, fmt.Errorf("no box key of participant %d", j)
+		}
+		if p.peerKeys != nil && !p.peerKeys[key] && key != own.Public {
+			return nil, fmt.Errorf("box key of participant %d is not pinned", j)
+		}
+		if other, ok := participants[key]; ok {
+			return nil, fmt.Errorf("participants %d and %d have the same box key", other, j)
+		}
+		participants[key] = j
+		if sealed[j], err = box.SealAnonymous(nil, share[:], &key, rand.Reader); err != nil {
+			return nil, err
+		}
+	}
+	return sealed, nil
+}
+
+// openShare opens a share sealed to this peer, p.mux has to be locked
+func (p *PeerLocal) openShare(sealed []byte) ([32]byte, bool) {
+	var share [32]byte
+	if p.boxKey == nil {
+		return share, false
+	}
+	opened, ok := box.OpenAnonymous(nil, sealed, &p.boxKey.Public, &p.boxKey.Secret)
+	if !ok || len(opened) != len(share) {
+		return share, false
+	}
+	copy(share[:], opened)
+	return share, cryptobase.ScMinimal(&share)
+}
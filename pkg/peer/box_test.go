@@ -0,0 +1,229 @@
+package peer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+)
+
+// relayRecorder keeps everything the coordinator relays between the dealers and the receivers
+type relayRecorder struct {
+	mux      sync.Mutex
+	dealings []*Dealing
+	shares   []DealtShare
+}
+
+type recordingPeer struct {
+	Peer
+	recorder *relayRecorder
+}
+
+func (p recordingPeer) Deal(ctx context.Context, clientID string, index int, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	d, err := p.Peer.Deal(ctx, clientID, index, threshold, participants, keys)
+	if err == nil {
+		p.recorder.mux.Lock()
+		p.recorder.dealings = append(p.recorder.dealings, d)
+		p.recorder.mux.Unlock()
+	}
+	return d, err
+}
+
+func (p recordingPeer) Refresh(ctx context.Context, clientID string, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	d, err := p.Peer.Refresh(ctx, clientID, participants, keys)
+	if err == nil {
+		p.recorder.mux.Lock()
+		p.recorder.dealings = append(p.recorder.dealings, d)
+		p.recorder.mux.Unlock()
+	}
+	return d, err
+}
+
+func (p recordingPeer) Reshare(ctx context.Context, clientID string, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	d, err := p.Peer.Reshare(ctx, clientID, threshold, participants, keys)
+	if err == nil {
+		p.recorder.mux.Lock()
+		p.recorder.dealings = append(p.recorder.dealings, d)
+		p.recorder.mux.Unlock()
+	}
+	return d, err
+}
+
+func (p recordingPeer) Verify(ctx context.Context, clientID string, shares map[int]DealtShare) ([]int, error) {
+	p.recorder.mux.Lock()
+	for _, s := range shares {
+		p.recorder.shares = append(p.recorder.shares, s)
+	}
+	p.recorder.mux.Unlock()
+	return p.Peer.Verify(ctx, clientID, shares)
+}
+
+// checkNoShareInClear fails if any 32 bytes the coordinator relayed are a valid share of a participant
+func checkNoShareInClear(t *testing.T, recorder *relayRecorder, participants []int) {
+	var relayed [][]byte
+	for _, d := range recorder.dealings {
+		for _, sealed := range d.Sealed {
+			relayed = append(relayed, sealed)
+		}
+	}
+	for _, s := range recorder.shares {
+		if s.Share != ([32]byte{}) {
+			t.Errorf("receiver was sent a share in clear")
+		}
+		relayed = append(relayed, s.Sealed)
+	}
+	if len(relayed) == 0 {
+		t.Fatal("no shares were relayed")
+	}
+	// the public shares f_i(j)·B of every dealer i and participant j
+	var public []cryptobase.ExtendedGroupElement
+	for _, d := range recorder.dealings {
+		for _, j := range participants {
+			public = append(public, evaluateCommitments(d.Commitments, j))
+		}
+	}
+	for _, b := range relayed {
+		for offset := 0; offset+32 <= len(b); offset++ {
+			var candidate [32]byte
+			copy(candidate[:], b[offset:])
+			if !cryptobase.ScMinimal(&candidate) {
+				continue
+			}
+			var P cryptobase.ExtendedGroupElement
+			cryptobase.GeScalarMultBase(&P, &candidate)
+			for i := range public {
+				if geEqual(&P, &public[i]) {
+					t.Fatalf("a share is relayed in clear")
+				}
+			}
+		}
+	}
+}
+
+func TestKeygenSealsShares(t *testing.T) {
+	recorder := &relayRecorder{}
+	peers := make([]Peer, 3)
+	for i := range peers {
+		peers[i] = recordingPeer{Peer: NewLocalPeer(), recorder: recorder}
+	}
+	keygenAndSign(t, peers, 2)
+
+	if len(recorder.dealings) != 3 || len(recorder.shares) != 9 {
+		t.Fatalf("recorded %d dealings and %d shares", len(recorder.dealings), len(recorder.shares))
+	}
+	checkNoShareInClear(t, recorder, []int{1, 2, 3})
+}
+
+func TestRefreshSealsShares(t *testing.T) {
+	recorder := &relayRecorder{}
+	peers := make([]Peer, 3)
+	for i := range peers {
+		peers[i] = recordingPeer{Peer: NewLocalPeer(), recorder: recorder}
+	}
+	c := NewCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	recorder.dealings, recorder.shares = nil, nil
+	if err := c.Refresh(context.Background(), "client"); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	checkNoShareInClear(t, recorder, []int{1, 2, 3})
+}
+
+func TestReshareSealsShares(t *testing.T) {
+	recorder := &relayRecorder{}
+	peers := make([]Peer, 5)
+	for i := range peers {
+		peers[i] = recordingPeer{Peer: NewLocalPeer(), recorder: recorder}
+	}
+	c := NewCoordinator(peers[:3])
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	recorder.dealings, recorder.shares = nil, nil
+	if err := c.Reshare(context.Background(), "client", peers[1:], 3); err != nil {
+		t.Fatalf("reshare failed: %v", err)
+	}
+	if len(recorder.dealings) != 3 || len(recorder.shares) != 12 {
+		t.Fatalf("recorded %d dealings and %d shares", len(recorder.dealings), len(recorder.shares))
+	}
+	checkNoShareInClear(t, recorder, []int{1, 2, 3, 4})
+}
+
+// swappedKeyPeer answers with a box key of the coordinator's choosing
+type swappedKeyPeer struct {
+	Peer
+	key [32]byte
+}
+
+func (p swappedKeyPeer) BoxKey(ctx context.Context) (*[32]byte, error) {
+	return &p.key, nil
+}
+
+func TestPinnedPeerKeys(t *testing.T) {
+	others := []*PeerLocal{NewLocalPeer(), NewLocalPeer()}
+	var pinned [][32]byte
+	for _, p := range others {
+		key, err := p.BoxKey(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pinned = append(pinned, *key)
+	}
+	dealer := NewLocalPeer(WithPeerKeys(pinned...))
+	keygenAndSign(t, []Peer{dealer, others[0], others[1]}, 2)
+
+	coordinatorKey, err := NewLocalPeer().BoxKey(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []Peer{NewLocalPeer(WithPeerKeys(pinned...)), others[0], swappedKeyPeer{Peer: others[1], key: *coordinatorKey}}
+	_, err = NewCoordinator(peers).Keygen(context.Background(), "swapped", 2, 3)
+	if err == nil || !strings.Contains(err.Error(), "not pinned") {
+		t.Errorf("keygen dealt a share to a key that is not pinned: %v", err)
+	}
+}
+
+func TestDuplicateBoxKeys(t *testing.T) {
+	receiver := NewLocalPeer()
+	key, err := receiver.BoxKey(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the coordinator gives a second participant the key of the first one
+	peers := []Peer{NewLocalPeer(), receiver, swappedKeyPeer{Peer: NewLocalPeer(), key: *key}}
+	_, err = NewCoordinator(peers).Keygen(context.Background(), "duplicate", 2, 3)
+	if err == nil || !strings.Contains(err.Error(), "same box key") {
+		t.Errorf("keygen dealt two shares to one box key: %v", err)
+	}
+}
+
+func TestBoxKeyStored(t *testing.T) {
+	store, err := NewFileStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadLocalPeer(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := p.BoxKey(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadLocalPeer(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadedKey, err := reloaded.BoxKey(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *reloadedKey != *key {
+		t.Errorf("box key changed on reload")
+	}
+}
@@ -1,35 +1,114 @@
 package peer
 
 import (
+	"context"
 	"crypto/sha512"
 	"fmt"
 	"math/rand" // not for crypto purposes
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/dvshur/distributed-signature/pkg/audit"
 	"github.com/dvshur/distributed-signature/pkg/crypto"
 	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Coordinator ..
 type Coordinator interface {
-	Keygen(clientID string) (crypto.PublicKey, error)
-	Sign(clientID string, message []byte) (crypto.Signature, error)
+	Keygen(ctx context.Context, clientID string, t, n int) (crypto.PublicKey, error)
+	Sign(ctx context.Context, clientID string, message []byte) (crypto.Signature, error)
+	Refresh(ctx context.Context, clientID string) error
+	Reshare(ctx context.Context, clientID string, peers []Peer, threshold int) error
 	GetPublicKey(clientID string) (crypto.PublicKey, bool)
 }
 
+type member struct {
+	peer  Peer
+	index int
+}
+
+// committee is a set of peers holding shares of a client key, any threshold of them can sign
+type committee struct {
+	threshold   int
+	members     []member
+	commitments []cryptobase.ExtendedGroupElement
+}
+
+// DefaultPhaseTimeout bounds every round of a protocol unless set with WithPhaseTimeout
+const DefaultPhaseTimeout = 10 * time.Second
+
+// Option configures a coordinator
+type Option func(*options)
+
+type options struct {
+	phaseTimeout  time.Duration
+	approvalTTL   time.Duration
+	nonceBatchTTL time.Duration
+	auditLog      *audit.Log
+	metrics       Metrics
+	tracer        trace.Tracer
+}
+
+// WithPhaseTimeout sets how long a round waits for the peers, the ones that don't respond in time are treated as failed
+func WithPhaseTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.phaseTimeout = timeout
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{phaseTimeout: DefaultPhaseTimeout, nonceBatchTTL: DefaultNonceBatchTTL, metrics: nopMetrics{}, tracer: trace.NewNoopTracerProvider().Tracer("")}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// phase returns the context of a single round, cancelled by the timeout or by ctx
+func (o options) phase(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, o.phaseTimeout)
+}
+
+// detachedContext keeps the values of its parent, such as the trace span, but not its deadline or cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
+
+// phaseError reports a round that ran out of time or was cancelled
+func phaseError(name string, ctx context.Context) error {
+	return fmt.Errorf("%s phase: %w", name, ctx.Err())
+}
+
 // CoordinatorImpl ..
 type CoordinatorImpl struct {
-	peers     []Peer
-	pubKeysEd map[string]cryptobase.ExtendedGroupElement
-	mux       sync.RWMutex
+	options
+	peers      []Peer
+	pubKeysEd  map[string]cryptobase.ExtendedGroupElement
+	committees map[string]committee
+	requests   map[string]*pendingRequest
+	registry   ShareStore
+	mux        sync.RWMutex
 }
 
 // NewCoordinator ..
-func NewCoordinator(peers []Peer) Coordinator {
+func NewCoordinator(peers []Peer, opts ...Option) Coordinator {
 	return &CoordinatorImpl{
-		peers:     peers,
-		pubKeysEd: make(map[string]cryptobase.ExtendedGroupElement),
-		mux:       sync.RWMutex{},
+		options:    newOptions(opts),
+		peers:      peers,
+		pubKeysEd:  make(map[string]cryptobase.ExtendedGroupElement),
+		committees: make(map[string]committee),
+		requests:   make(map[string]*pendingRequest),
+		mux:        sync.RWMutex{},
 	}
 }
 
@@ -41,113 +120,906 @@ func (c *CoordinatorImpl) GetPublicKey(clientID string) (crypto.PublicKey, bool)
 	return curvePKFromEdPK(&A), ok
 }
 
-// Keygen ..
-func (c *CoordinatorImpl) Keygen(clientID string) (crypto.PublicKey, error) {
-	errors := make(chan error)
-	AA := make(chan cryptobase.ExtendedGroupElement)
+// Keygen runs a distributed key generation between the first n peers, any t of which can sign.
+// No peer, nor the coordinator, learns the secret key.
+func (c *CoordinatorImpl) Keygen(ctx context.Context, clientID string, t, n int) (crypto.PublicKey, error) {
+	ctx, span := c.startOperation(ctx, "Keygen", clientID)
+	start := time.Now()
+	pk, err := c.keygen(ctx, clientID, t, n)
+	c.metrics.Operation(audit.OpKeygen, time.Since(start), err)
+	endSpan(span, err)
+	c.record(audit.Entry{Operation: audit.OpKeygen, ClientID: clientID, Peers: c.committeeIndices(clientID, err)}, err)
+	return pk, err
+}
+
+func (c *CoordinatorImpl) keygen(ctx context.Context, clientID string, t, n int) (pk crypto.PublicKey, err error) {
+	if n < 1 || n > len(c.peers) {
+		return pk, fmt.Errorf("invalid number of peers %d, have %d: %w", n, len(c.peers), ErrInvalidParameters)
+	}
+	if t < 1 || t > n {
+		return pk, fmt.Errorf("invalid threshold %d of %d: %w", t, n, ErrInvalidParameters)
+	}
+
+	c.mux.RLock()
+	_, clientExists := c.pubKeysEd[clientID]
+	c.mux.RUnlock()
+	if clientExists {
+		return pk, fmt.Errorf("client id %s: %w", clientID, ErrClientExists)
+	}
+
+	members := make([]member, n)
+	participants := make([]int, n)
+	for i, p := range c.peers[:n] {
+		members[i] = member{peer: p, index: i + 1}
+		participants[i] = i + 1
+	}
+	// members that finalized a key of a failed keygen delete it, so the client id can be generated again
+	defer func() {
+		if err != nil {
+			c.rollbackShares(ctx, clientID, members)
+		}
+	}()
 
-	// get all peers Ai
-	for _, p := range c.peers {
-		go func(p Peer) {
-			Ai, err := p.Ai(clientID)
+	keys, err := c.boxKeys(ctx, audit.OpKeygen, members)
+	if err != nil {
+		return pk, err
+	}
+
+	type indexedDealing struct {
+		index   int
+		dealing *Dealing
+	}
+
+	// round 1: every member deals shares of its own secret ai, sealed to the box keys of the members
+	dealDone := c.timePhase(audit.OpKeygen, "deal")
+	dealCtx, cancelDeal := c.phase(ctx)
+	defer cancelDeal()
+	errors := make(chan error, n)
+	DD := make(chan indexedDealing, n)
+	for _, m := range members {
+		go func(m member) {
+			callCtx, done := c.peerCall(dealCtx, m.index, m.peer, "Deal")
+			d, err := m.peer.Deal(callCtx, clientID, m.index, t, participants, keys)
+			done(err)
 			if err != nil {
 				errors <- err
 				return
 			}
-			AA <- *Ai
-		}(p)
+			DD <- indexedDealing{m.index, d}
+		}(m)
 	}
-	As := make([]cryptobase.ExtendedGroupElement, len(c.peers))
-	for i := range c.peers {
+	dealings := make(map[int]*Dealing, n)
+	for range members {
 		select {
-		case Ai := <-AA:
-			As[i] = Ai
+		case d := <-DD:
+			dealings[d.index] = d.dealing
 		case err := <-errors:
-			var pk crypto.PublicKey
 			return pk, err
+		case <-dealCtx.Done():
+			return pk, phaseError("deal", dealCtx)
+		}
+	}
+	dealDone()
+
+	// a peer that can't prove knowledge of its secret may be mounting a rogue key attack
+	for _, j := range participants {
+		d := dealings[j]
+		if len(d.Commitments) == 0 || !verifyKnowledge(clientID, j, &d.Commitments[0], &d.Proof) {
+			return pk, &MisbehaviorError{Index: j, Reason: "invalid proof of knowledge of its secret"}
 		}
 	}
-	A := sumGeSlice(As)
 
-	c.mux.Lock()
-	c.pubKeysEd[clientID] = A
-	c.mux.Unlock()
+	qualified, revealed, err := c.verifyDealings(ctx, audit.OpKeygen, clientID, members, members, t, dealings)
+	if err != nil {
+		return pk, err
+	}
+	if len(qualified) < t {
+		return pk, fmt.Errorf("only %d of %d dealers qualified, threshold is %d", len(qualified), n, t)
+	}
+	commitments := make([][]cryptobase.ExtendedGroupElement, len(qualified))
+	for i, j := range qualified {
+		commitments[i] = dealings[j].Commitments
+	}
+	groupCommitments := sumCommitments(commitments)
+	A := groupCommitments[0]
+
+	// round 4: every member combines the shares of qualified dealers
+	if err := c.finalizeShares(ctx, audit.OpKeygen, clientID, members, qualified, revealed, groupCommitments); err != nil {
+		return pk, err
+	}
+
+	if err := c.setCommittee(clientID, committee{threshold: t, members: members, commitments: groupCommitments}); err != nil {
+		return pk, err
+	}
+	_ = c.confirmShares(ctx, clientID, members)
 
 	return curvePKFromEdPK(&A), nil
 }
 
+// Refresh re-randomizes the members' key shares without changing the public key.
+// Every member deals a sharing of zero, shares held before the refresh can't be combined with the new ones.
+// All members have to take part, members keep their old shares until all of them have applied the new ones,
+// a refresh that fails rolls every member back to its old share.
+func (c *CoordinatorImpl) Refresh(ctx context.Context, clientID string) error {
+	ctx, span := c.startOperation(ctx, "Refresh", clientID)
+	start := time.Now()
+	err := c.refresh(ctx, clientID)
+	c.metrics.Operation(audit.OpRefresh, time.Since(start), err)
+	endSpan(span, err)
+	c.record(audit.Entry{Operation: audit.OpRefresh, ClientID: clientID, Peers: c.committeeIndices(clientID, err)}, err)
+	return err
+}
+
+func (c *CoordinatorImpl) refresh(ctx context.Context, clientID string) (err error) {
+	c.mux.RLock()
+	cm, clientExists := c.committees[clientID]
+	c.mux.RUnlock()
+	if !clientExists {
+		return fmt.Errorf("client id %s: %w", clientID, ErrUnknownClient)
+	}
+	defer func() {
+		if err != nil {
+			c.rollbackShares(ctx, clientID, cm.members)
+		}
+	}()
+
+	participants := make([]int, len(cm.members))
+	for i, m := range cm.members {
+		participants[i] = m.index
+	}
+
+	keys, err := c.boxKeys(ctx, audit.OpRefresh, cm.members)
+	if err != nil {
+		return err
+	}
+
+	type indexedDealing struct {
+		index   int
+		dealing *Dealing
+	}
+
+	// round 1: every member deals shares of zero, sealed to the box keys of the members
+	dealDone := c.timePhase(audit.OpRefresh, "deal")
+	dealCtx, cancelDeal := c.phase(ctx)
+	defer cancelDeal()
+	dealErrors := make(chan error, len(cm.members))
+	DD := make(chan indexedDealing, len(cm.members))
+	for _, m := range cm.members {
+		go func(m member) {
+			callCtx, done := c.peerCall(dealCtx, m.index, m.peer, "Refresh")
+			d, err := m.peer.Refresh(callCtx, clientID, participants, keys)
+			done(err)
+			if err != nil {
+				dealErrors <- err
+				return
+			}
+			DD <- indexedDealing{m.index, d}
+		}(m)
+	}
+	dealings := make(map[int]*Dealing, len(cm.members))
+	for range cm.members {
+		select {
+		case d := <-DD:
+			dealings[d.index] = d.dealing
+		case err := <-dealErrors:
+			return err
+		case <-dealCtx.Done():
+			return phaseError("deal", dealCtx)
+		}
+	}
+	dealDone()
+
+	// a sharing of anything but zero would change the key
+	for _, j := range participants {
+		d := dealings[j]
+		if len(d.Commitments) == 0 || !cryptobase.GeIsNeutral(&d.Commitments[0]) {
+			return &MisbehaviorError{Index: j, Reason: "refresh dealing is not a sharing of zero"}
+		}
+	}
+
+	qualified, revealed, err := c.verifyDealings(ctx, audit.OpRefresh, clientID, cm.members, cm.members, cm.threshold, dealings)
+	if err != nil {
+		return err
+	}
+	if len(qualified) < cm.threshold {
+		return fmt.Errorf("only %d of %d dealers qualified, threshold is %d", len(qualified), len(cm.members), cm.threshold)
+	}
+	commitments := make([][]cryptobase.ExtendedGroupElement, len(qualified), len(qualified)+1)
+	for i, j := range qualified {
+		commitments[i] = dealings[j].Commitments
+	}
+	groupCommitments := sumCommitments(append(commitments, cm.commitments))
+
+	// round 4: every member adds the shares of qualified dealers to its current share
+	if err := c.finalizeShares(ctx, audit.OpRefresh, clientID, cm.members, qualified, revealed, groupCommitments); err != nil {
+		return err
+	}
+
+	// round 5: members switch to the refreshed shares, keeping the old ones until every member has switched
+	applyDone := c.timePhase(audit.OpRefresh, "apply")
+	applyCtx, cancelApply := c.phase(ctx)
+	defer cancelApply()
+	applyErrors := make(chan error, len(cm.members))
+	for _, m := range cm.members {
+		go func(m member) {
+			callCtx, done := c.peerCall(applyCtx, m.index, m.peer, "ApplyRefresh")
+			err := m.peer.ApplyRefresh(callCtx, clientID)
+			done(err)
+			applyErrors <- err
+		}(m)
+	}
+	for range cm.members {
+		select {
+		case err := <-applyErrors:
+			if err != nil {
+				return err
+			}
+		case <-applyCtx.Done():
+			return phaseError("apply", applyCtx)
+		}
+	}
+	applyDone()
+
+	cm.commitments = groupCommitments
+	if err := c.setCommittee(clientID, cm); err != nil {
+		return err
+	}
+	_ = c.confirmShares(ctx, clientID, cm.members)
+	return nil
+}
+
+// Reshare moves the client key to a new set of peers, any threshold of which can sign, keeping the public key.
+// At least threshold of the current members have to deal their shares, the others may be offline.
+// A reshare that fails before every new member has applied its share rolls the peers back to their old shares,
+// current members left out of the new set delete their shares once the new members have confirmed theirs.
+// The new set is registered even if some of them fail to, the error names the old members still holding shares.
+func (c *CoordinatorImpl) Reshare(ctx context.Context, clientID string, peers []Peer, threshold int) error {
+	ctx, span := c.startOperation(ctx, "Reshare", clientID)
+	start := time.Now()
+	err := c.reshare(ctx, clientID, peers, threshold)
+	c.metrics.Operation(audit.OpReshare, time.Since(start), err)
+	endSpan(span, err)
+	c.record(audit.Entry{Operation: audit.OpReshare, ClientID: clientID, Peers: c.committeeIndices(clientID, err)}, err)
+	return err
+}
+
+func (c *CoordinatorImpl) reshare(ctx context.Context, clientID string, peers []Peer, threshold int) (err error) {
+	n := len(peers)
+	if n < 1 {
+		return fmt.Errorf("no peers to reshare to: %w", ErrInvalidParameters)
+	}
+	if threshold < 1 || threshold > n {
+		return fmt.Errorf("invalid threshold %d of %d: %w", threshold, n, ErrInvalidParameters)
+	}
+	// the registry refers to peers by their position among the coordinator's peers
+	if c.registry != nil {
+		for _, p := range peers {
+			if c.peerPosition(p) < 0 {
+				return fmt.Errorf("can't register a peer the coordinator doesn't have: %w", ErrInvalidParameters)
+			}
+		}
+	}
+
+	c.mux.RLock()
+	cm, clientExists := c.committees[clientID]
+	c.mux.RUnlock()
+	if !clientExists {
+		return fmt.Errorf("client id %s: %w", clientID, ErrUnknownClient)
+	}
+
+	members := make([]member, n)
+	participants := make([]int, n)
+	for i, p := range peers {
+		members[i] = member{peer: p, index: i + 1}
+		participants[i] = i + 1
+	}
+	registered := false
+	defer func() {
+		if err != nil && !registered {
+			c.rollbackShares(ctx, clientID, append(append([]member{}, members...), cm.members...))
+		}
+	}()
+
+	// round 0: new members prepare to receive shares under their new indices
+	joinDone := c.timePhase(audit.OpReshare, "join")
+	joinCtx, cancelJoin := c.phase(ctx)
+	defer cancelJoin()
+	joinErrors := make(chan error, n)
+	for _, m := range members {
+		go func(m member) {
+			callCtx, done := c.peerCall(joinCtx, m.index, m.peer, "Join")
+			err := m.peer.Join(callCtx, clientID, m.index, threshold)
+			done(err)
+			joinErrors <- err
+		}(m)
+	}
+	for range members {
+		select {
+		case err := <-joinErrors:
+			if err != nil {
+				return err
+			}
+		case <-joinCtx.Done():
+			return phaseError("join", joinCtx)
+		}
+	}
+	joinDone()
+
+	keys, err := c.boxKeys(ctx, audit.OpReshare, members)
+	if err != nil {
+		return err
+	}
+
+	type indexedDealing struct {
+		index   int
+		dealing *Dealing
+	}
+
+	// round 1: current members deal their shares sealed to the box keys of the new members,
+	// C_i0 has to be their public share Y_i
+	dealDone := c.timePhase(audit.OpReshare, "deal")
+	dealCtx, cancelDeal := c.phase(ctx)
+	defer cancelDeal()
+	dealErrors := make(chan error, len(cm.members))
+	DD := make(chan indexedDealing, len(cm.members))
+	for _, m := range cm.members {
+		go func(m member) {
+			callCtx, done := c.peerCall(dealCtx, m.index, m.peer, "Reshare")
+			d, err := m.peer.Reshare(callCtx, clientID, threshold, participants, keys)
+			done(err)
+			if err != nil {
+				dealErrors <- err
+				return
+			}
+			DD <- indexedDealing{m.index, d}
+		}(m)
+	}
+	dealings := make(map[int]*Dealing, len(cm.members))
+	failed := 0
+dealing:
+	for range cm.members {
+		select {
+		case d := <-DD:
+			Yi := evaluateCommitments(cm.commitments, d.index)
+			if len(d.dealing.Commitments) == 0 || !geEqual(&d.dealing.Commitments[0], &Yi) {
+				return &MisbehaviorError{Index: d.index, Reason: "reshare dealing is not a sharing of its key share"}
+			}
+			dealings[d.index] = d.dealing
+		case err := <-dealErrors:
+			failed++
+			if len(cm.members)-failed < cm.threshold {
+				return fmt.Errorf("not enough peers to reshare, %d failed: %v", failed, err)
+			}
+		case <-dealCtx.Done():
+			// dealers that didn't respond in time are left out
+			if ctx.Err() != nil || len(dealings) < cm.threshold {
+				return phaseError("deal", dealCtx)
+			}
+			break dealing
+		}
+	}
+	dealDone()
+
+	qualified, revealed, err := c.verifyDealings(ctx, audit.OpReshare, clientID, cm.members, members, threshold, dealings)
+	if err != nil {
+		return err
+	}
+	if len(qualified) < cm.threshold {
+		return fmt.Errorf("only %d of %d dealers qualified, threshold is %d", len(qualified), len(cm.members), cm.threshold)
+	}
+	commitments := make([][]cryptobase.ExtendedGroupElement, len(qualified))
+	for i, j := range qualified {
+		lambda := lagrangeCoefficient(j, qualified)
+		commitments[i] = scaleCommitments(&lambda, dealings[j].Commitments)
+	}
+	groupCommitments := sumCommitments(commitments)
+
+	// round 4: every new member interpolates the shares of qualified dealers
+	if err := c.finalizeShares(ctx, audit.OpReshare, clientID, members, qualified, revealed, groupCommitments); err != nil {
+		return err
+	}
+
+	// round 5: new members switch to their shares, keeping the old ones until every new member has switched
+	applyDone := c.timePhase(audit.OpReshare, "apply")
+	applyCtx, cancelApply := c.phase(ctx)
+	defer cancelApply()
+	applyErrors := make(chan error, n)
+	for _, m := range members {
+		go func(m member) {
+			callCtx, done := c.peerCall(applyCtx, m.index, m.peer, "ApplyRefresh")
+			err := m.peer.ApplyRefresh(callCtx, clientID)
+			done(err)
+			applyErrors <- err
+		}(m)
+	}
+	for range members {
+		select {
+		case err := <-applyErrors:
+			if err != nil {
+				return err
+			}
+		case <-applyCtx.Done():
+			return phaseError("apply", applyCtx)
+		}
+	}
+	applyDone()
+
+	if err := c.setCommittee(clientID, committee{threshold: threshold, members: members, commitments: groupCommitments}); err != nil {
+		return err
+	}
+	registered = true
+
+	// members left out keep their shares until every new member has dropped its old one
+	if err := c.confirmShares(ctx, clientID, members); err != nil {
+		return fmt.Errorf("reshared, but not every new member confirmed its share, the old members keep theirs: %v", err)
+	}
+	var retired []member
+	for _, old := range cm.members {
+		retained := false
+		for _, p := range peers {
+			if p == old.peer {
+				retained = true
+			}
+		}
+		if !retained {
+			retired = append(retired, old)
+		}
+	}
+	return c.retireMembers(ctx, clientID, retired)
+}
+
+// retireMembers makes the members left out by a reshare delete their shares. A member failing to retire keeps
+// a share of the old polynomial, it can't sign with the new members, but a threshold of such members still can.
+func (c *CoordinatorImpl) retireMembers(ctx context.Context, clientID string, members []member) error {
+	retireCtx, cancel := c.phase(ctx)
+	defer cancel()
+	type retireError struct {
+		index int
+		err   error
+	}
+	retireErrors := make(chan retireError, len(members))
+	for _, m := range members {
+		go func(m member) {
+			callCtx, done := c.peerCall(retireCtx, m.index, m.peer, "Retire")
+			err := m.peer.Retire(callCtx, clientID)
+			done(err)
+			retireErrors <- retireError{m.index, err}
+		}(m)
+	}
+	var failed []int
+	var lastErr error
+	for range members {
+		if e := <-retireErrors; e.err != nil {
+			failed = append(failed, e.index)
+			lastErr = e.err
+		}
+	}
+	if lastErr != nil {
+		sort.Ints(failed)
+		return fmt.Errorf("reshared, but old members %v failed to retire and still hold shares of the key: %v", failed, lastErr)
+	}
+	return nil
+}
+
+// boxKeys collects the box keys the shares dealt to the receivers are sealed to
+func (c *CoordinatorImpl) boxKeys(ctx context.Context, op string, receivers []member) (map[int][32]byte, error) {
+	type indexedKey struct {
+		index int
+		key   *[32]byte
+	}
+
+	keysDone := c.timePhase(op, "keys")
+	keysCtx, cancelKeys := c.phase(ctx)
+	defer cancelKeys()
+	errors := make(chan error, len(receivers))
+	KK := make(chan indexedKey, len(receivers))
+	for _, m := range receivers {
+		go func(m member) {
+			callCtx, done := c.peerCall(keysCtx, m.index, m.peer, "BoxKey")
+			key, err := m.peer.BoxKey(callCtx)
+			done(err)
+			if err != nil {
+				errors <- err
+				return
+			}
+			KK <- indexedKey{m.index, key}
+		}(m)
+	}
+	keys := make(map[int][32]byte, len(receivers))
+	for range receivers {
+		select {
+		case k := <-KK:
+			keys[k.index] = *k.key
+		case err := <-errors:
+			return nil, err
+		case <-keysCtx.Done():
+			return nil, phaseError("keys", keysCtx)
+		}
+	}
+	keysDone()
+	return keys, nil
+}
+
+// verifyDealings runs the verification and complaint rounds, receivers check the shares dealt to them
+// with a polynomial of degree t-1, and returns the qualified dealers with the shares revealed to every receiver
+func (c *CoordinatorImpl) verifyDealings(ctx context.Context, op, clientID string, dealers, receivers []member, t int, dealings map[int]*Dealing) ([]int, map[int]map[int][32]byte, error) {
+	n := len(receivers)
+
+	// malformed dealings are disqualified right away
+	disqualified := make(map[int]bool)
+	for j, d := range dealings {
+		if len(d.Commitments) != t {
+			disqualified[j] = true
+			continue
+		}
+		for _, m := range receivers {
+			if _, ok := d.Sealed[m.index]; !ok {
+				disqualified[j] = true
+			}
+		}
+	}
+
+	// round 2: every receiver verifies the shares dealt to it
+	type complaint struct {
+		accuser int
+		accused []int
+	}
+	verifyDone := c.timePhase(op, "verify")
+	verifyCtx, cancelVerify := c.phase(ctx)
+	defer cancelVerify()
+	verifyErrors := make(chan error, n)
+	CC := make(chan complaint, n)
+	for _, m := range receivers {
+		shares := make(map[int]DealtShare, len(dealings))
+		for j, d := range dealings {
+			if disqualified[j] {
+				continue
+			}
+			shares[j] = DealtShare{Commitments: d.Commitments, Sealed: d.Sealed[m.index]}
+		}
+		go func(m member, shares map[int]DealtShare) {
+			callCtx, done := c.peerCall(verifyCtx, m.index, m.peer, "Verify")
+			accused, err := m.peer.Verify(callCtx, clientID, shares)
+			done(err)
+			if err != nil {
+				verifyErrors <- err
+				return
+			}
+			CC <- complaint{m.index, accused}
+		}(m, shares)
+	}
+	accusers := make(map[int][]int)
+	for range receivers {
+		select {
+		case c := <-CC:
+			for _, j := range c.accused {
+				accusers[j] = append(accusers[j], c.accuser)
+			}
+		case err := <-verifyErrors:
+			return nil, nil, err
+		case <-verifyCtx.Done():
+			return nil, nil, phaseError("verify", verifyCtx)
+		}
+	}
+	verifyDone()
+
+	// round 3: accused dealers reveal the disputed shares,
+	// a dealer is disqualified if t or more receivers complain or a revealed share is invalid
+	revealed := make(map[int]map[int][32]byte, n)
+	for _, m := range receivers {
+		revealed[m.index] = make(map[int][32]byte)
+	}
+	revealDone := c.timePhase(op, "reveal")
+	revealCtx, cancelReveal := c.phase(ctx)
+	defer cancelReveal()
+	for _, m := range dealers {
+		j := m.index
+		if len(accusers[j]) == 0 || disqualified[j] {
+			continue
+		}
+		if len(accusers[j]) >= t {
+			disqualified[j] = true
+			continue
+		}
+		callCtx, done := c.peerCall(revealCtx, m.index, m.peer, "Reveal")
+		shares, err := m.peer.Reveal(callCtx, clientID, accusers[j])
+		done(err)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			disqualified[j] = true
+			continue
+		}
+		for _, i := range accusers[j] {
+			share, ok := shares[i]
+			if !ok || !verifyShare(&share, i, dealings[j].Commitments) {
+				disqualified[j] = true
+				break
+			}
+			revealed[i][j] = share
+		}
+	}
+	revealDone()
+
+	qualified := make([]int, 0, len(dealers))
+	for _, m := range dealers {
+		if _, dealt := dealings[m.index]; dealt && !disqualified[m.index] {
+			qualified = append(qualified, m.index)
+		}
+	}
+	return qualified, revealed, nil
+}
+
+// finalizeShares runs the last round, every receiver combines the shares of qualified dealers
+// and its public share is checked against the commitments to the joint polynomial
+func (c *CoordinatorImpl) finalizeShares(ctx context.Context, op, clientID string, receivers []member, qualified []int, revealed map[int]map[int][32]byte, groupCommitments []cryptobase.ExtendedGroupElement) error {
+	type publicShare struct {
+		index int
+		Yi    cryptobase.ExtendedGroupElement
+	}
+	finalizeDone := c.timePhase(op, "finalize")
+	finalizeCtx, cancelFinalize := c.phase(ctx)
+	defer cancelFinalize()
+	finalizeErrors := make(chan error, len(receivers))
+	YY := make(chan publicShare, len(receivers))
+	for _, m := range receivers {
+		go func(m member) {
+			callCtx, done := c.peerCall(finalizeCtx, m.index, m.peer, "Finalize")
+			Yi, err := m.peer.Finalize(callCtx, clientID, qualified, revealed[m.index])
+			done(err)
+			if err != nil {
+				finalizeErrors <- err
+				return
+			}
+			YY <- publicShare{m.index, *Yi}
+		}(m)
+	}
+	for range receivers {
+		select {
+		case Y := <-YY:
+			expected := evaluateCommitments(groupCommitments, Y.index)
+			if !geEqual(&Y.Yi, &expected) {
+				return &MisbehaviorError{Index: Y.index, Reason: "public share does not match commitments"}
+			}
+		case err := <-finalizeErrors:
+			return err
+		case <-finalizeCtx.Done():
+			return phaseError("finalize", finalizeCtx)
+		}
+	}
+	finalizeDone()
+	return nil
+}
+
+// confirmShares lets the members drop the shares replaced by the new ones and returns the last error of a member
+// that didn't confirm, such a member keeps its old share until the next refresh or reshare
+func (c *CoordinatorImpl) confirmShares(ctx context.Context, clientID string, members []member) error {
+	confirmCtx, cancel := c.phase(ctx)
+	defer cancel()
+	confirmErrors := make(chan error, len(members))
+	for _, m := range members {
+		go func(m member) {
+			callCtx, done := c.peerCall(confirmCtx, m.index, m.peer, "Confirm")
+			err := m.peer.Confirm(callCtx, clientID)
+			done(err)
+			confirmErrors <- err
+		}(m)
+	}
+	var lastErr error
+	for range members {
+		if err := <-confirmErrors; err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// rollbackShares makes the members of a failed keygen, refresh or reshare go back to the shares they had before it
+func (c *CoordinatorImpl) rollbackShares(ctx context.Context, clientID string, members []member) {
+	rollbackCtx, cancel := c.phase(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, m := range members {
+		wg.Add(1)
+		go func(m member) {
+			defer wg.Done()
+			callCtx, done := c.peerCall(rollbackCtx, m.index, m.peer, "Rollback")
+			done(m.peer.Rollback(callCtx, clientID))
+		}(m)
+	}
+	wg.Wait()
+}
+
 // Sign ..
-func (c *CoordinatorImpl) Sign(clientID string, message []byte) (crypto.Signature, error) {
+func (c *CoordinatorImpl) Sign(ctx context.Context, clientID string, message []byte) (crypto.Signature, error) {
+	ctx, span := c.startOperation(ctx, "Sign", clientID)
+	signature, err := c.withApprovals(ctx, clientID, message, func() (crypto.Signature, error) {
+		start := time.Now()
+		sessionID := randomSessionID()
+		span.SetAttributes(attribute.String("session.id", sessionID))
+		signature, signers, err := c.sign(ctx, clientID, sessionID, message)
+		c.metrics.Operation(audit.OpSign, time.Since(start), err)
+		c.record(audit.Entry{Operation: audit.OpSign, ClientID: clientID, SessionID: sessionID, Message: message, Peers: memberIndices(signers)}, err)
+		return signature, err
+	})
+	endSpan(span, err)
+	return signature, err
+}
+
+// sign runs a signing session, it returns the signers picked once the commit phase is over
+func (c *CoordinatorImpl) sign(ctx context.Context, clientID string, sessionID string, message []byte) (crypto.Signature, []member, error) {
 	var signature crypto.Signature
 
 	c.mux.RLock()
 	A, clientExists := c.pubKeysEd[clientID]
+	cm := c.committees[clientID]
 	c.mux.RUnlock()
 	if !clientExists {
-		return signature, fmt.Errorf("client id %s does not exist", clientID)
+		return signature, nil, fmt.Errorf("client id %s: %w", clientID, ErrUnknownClient)
 	}
 
-	errors := make(chan error)
-	sessionID := randomSessionID()
+	type commitment struct {
+		member member
+		digest crypto.Digest
+	}
 
-	// phase1: ask peers for R_i to calculate R
-	RR := make(chan cryptobase.ExtendedGroupElement)
-	for _, p := range c.peers {
-		go func(p Peer) {
-			Ri, err := p.Ri(clientID, sessionID, message)
+	// phase 1: ask all members to commit to R_i, the first t to respond are the signers,
+	// the commits still running are cancelled once they are found
+	commitDone := c.timePhase(audit.OpSign, "commit")
+	commitCtx, cancelCommit := c.phase(ctx)
+	defer cancelCommit()
+	commitErrors := make(chan error, len(cm.members))
+	CC := make(chan commitment, len(cm.members))
+	for _, m := range cm.members {
+		go func(m member) {
+			callCtx, done := c.peerCall(commitCtx, m.index, m.peer, "Commit")
+			digest, err := m.peer.Commit(callCtx, clientID, sessionID, message)
+			done(err)
 			if err != nil {
-				errors <- err
+				commitErrors <- err
+				return
+			}
+			CC <- commitment{m, digest}
+		}(m)
+	}
+	signers := make([]member, 0, cm.threshold)
+	commitments := make(map[int]crypto.Digest, cm.threshold)
+	failed := 0
+	for len(signers) < cm.threshold {
+		select {
+		case c := <-CC:
+			signers = append(signers, c.member)
+			commitments[c.member.index] = c.digest
+		case err := <-commitErrors:
+			failed++
+			if len(cm.members)-failed < cm.threshold {
+				return signature, nil, fmt.Errorf("not enough peers to sign, %d of %d failed: %w", failed, len(cm.members), err)
+			}
+		case <-commitCtx.Done():
+			return signature, nil, phaseError("commit", commitCtx)
+		}
+	}
+	commitDone()
+	cancelCommit()
+
+	// phase 2: signers reveal R_i once everyone is committed
+	type nonce struct {
+		index int
+		Ri    cryptobase.ExtendedGroupElement
+	}
+	riDone := c.timePhase(audit.OpSign, "ri")
+	riCtx, cancelRi := c.phase(ctx)
+	defer cancelRi()
+	riErrors := make(chan error, len(signers))
+	RR := make(chan nonce, len(signers))
+	for _, m := range signers {
+		go func(m member) {
+			callCtx, done := c.peerCall(riCtx, m.index, m.peer, "Ri")
+			Ri, err := m.peer.Ri(callCtx, clientID, sessionID, commitments)
+			done(err)
+			if err != nil {
+				riErrors <- err
 				return
 			}
-			RR <- *Ri
-		}(p)
+			RR <- nonce{m.index, *Ri}
+		}(m)
 	}
-	Rs := make([]cryptobase.ExtendedGroupElement, len(c.peers))
-	for i := range c.peers {
+	Rs := make(map[int]cryptobase.ExtendedGroupElement, len(signers))
+	for range signers {
 		select {
 		case Ri := <-RR:
-			Rs[i] = Ri
-		case err := <-errors:
-			return signature, err
+			digest, err := nonceCommitment(sessionID, Ri.index, &Ri.Ri)
+			if err != nil {
+				return signature, signers, err
+			}
+			if digest != commitments[Ri.index] {
+				return signature, signers, &MisbehaviorError{Index: Ri.index, Reason: "nonce does not match its commitment"}
+			}
+			Rs[Ri.index] = Ri.Ri
+		case err := <-riErrors:
+			return signature, signers, err
+		case <-riCtx.Done():
+			return signature, signers, phaseError("ri", riCtx)
 		}
 	}
-	R := sumGeSlice(Rs)
+	riDone()
+
+	participants := make([]int, len(signers))
+	for i, m := range signers {
+		participants[i] = m.index
+	}
+	R := interpolateGe(Rs, participants)
 
 	k, err := calculateK(&R, &A, message)
 	if err != nil {
-		return signature, err
+		return signature, signers, err
 	}
 
-	// phase 2: ask peers for S_i to calculate S
-	var S cryptobase.FieldElement
-	SS := make(chan cryptobase.FieldElement)
-	for _, p := range c.peers {
-		go func(p Peer) {
-			Si, err := p.Si(clientID, sessionID, k)
+	// phase 3: ask signers for S_i, S = sum λ_i·S_i
+	type partialSignature struct {
+		index int
+		Si    [32]byte
+	}
+	var S [32]byte
+	siDone := c.timePhase(audit.OpSign, "si")
+	siCtx, cancelSi := c.phase(ctx)
+	defer cancelSi()
+	siErrors := make(chan error, len(signers))
+	SS := make(chan partialSignature, len(signers))
+	for _, m := range signers {
+		go func(m member) {
+			callCtx, done := c.peerCall(siCtx, m.index, m.peer, "Si")
+			Si, err := m.peer.Si(callCtx, clientID, sessionID, Rs, message)
+			done(err)
 			if err != nil {
-				errors <- err
+				siErrors <- err
 				return
 			}
-			SS <- *Si
-		}(p)
+			SS <- partialSignature{m.index, *Si}
+		}(m)
 	}
-	for range c.peers {
+	for range signers {
 		select {
 		case Si := <-SS:
-			cryptobase.FeAdd(&S, &S, &Si)
-		case err := <-errors:
-			return signature, err
+			if !cryptobase.ScMinimal(&Si.Si) {
+				return signature, signers, &MisbehaviorError{Index: Si.index, Reason: "non-canonical partial signature"}
+			}
+			if !verifyPartialSignature(&Si.Si, &k, Rs[Si.index], evaluateCommitments(cm.commitments, Si.index)) {
+				return signature, signers, &MisbehaviorError{Index: Si.index, Reason: "invalid partial signature"}
+			}
+			lambda := lagrangeCoefficient(Si.index, participants)
+			cryptobase.ScMulAdd(&S, &lambda, &Si.Si, &S)
+		case err := <-siErrors:
+			return signature, signers, err
+		case <-siCtx.Done():
+			return signature, signers, phaseError("si", siCtx)
 		}
 	}
+	siDone()
+
+	return curveSigFromEd(&R, &A, &S), signers, nil
+}
+
+// verifyPartialSignature checks S_i·B == R_i + k·Y_i
+func verifyPartialSignature(Si, k *[32]byte, Ri, Yi cryptobase.ExtendedGroupElement) bool {
+	var SiB, kY, expected cryptobase.ExtendedGroupElement
+	cryptobase.GeScalarMultBase(&SiB, Si)
+	cryptobase.GeScalarMult(&kY, k, &Yi)
+	cryptobase.GeAdd(&expected, &Ri, &kY)
+	return geEqual(&SiB, &expected)
+}
+
+// curveSigFromEd serializes R, S into an ed25519 signature R || S
+// and transforms it to a Curve25519 one by storing the sign bit of A in S
+func curveSigFromEd(R, A *cryptobase.ExtendedGroupElement, S *[32]byte) crypto.Signature {
+	var signature crypto.Signature
 
-	// serialize R, S to bytes — ed25519 signature
-	var RByte, SByte [32]byte
+	var RByte [32]byte
 	R.ToBytes(&RByte)
-	cryptobase.FeToBytes(&SByte, &S)
 	copy(signature[:], RByte[:])
-	copy(signature[32:], SByte[:])
+	copy(signature[32:], S[:])
 
-	// ed25519 to curve25519 signature
 	var publicKeyEd = new([crypto.PublicKeySize]byte)
 	A.ToBytes(publicKeyEd)
 	signBit := publicKeyEd[31] & 0x80
@@ -155,7 +1027,18 @@ func (c *CoordinatorImpl) Sign(clientID string, message []byte) (crypto.Signatur
 	signature[63] &= 0x7f
 	signature[63] |= signBit
 
-	return signature, nil
+	return signature
+}
+
+// interpolateGe returns sum λ_i·P_i over the given participants
+func interpolateGe(points map[int]cryptobase.ExtendedGroupElement, participants []int) cryptobase.ExtendedGroupElement {
+	terms := make([]cryptobase.ExtendedGroupElement, len(participants))
+	for i, j := range participants {
+		lambda := lagrangeCoefficient(j, participants)
+		P := points[j]
+		cryptobase.GeScalarMult(&terms[i], &lambda, &P)
+	}
+	return sumGeSlice(terms)
 }
 
 func sumGeSlice(ges []cryptobase.ExtendedGroupElement) cryptobase.ExtendedGroupElement {
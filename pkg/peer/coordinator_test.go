@@ -1,52 +1,290 @@
 package peer
 
 import (
+	"context"
 	"crypto/rand"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"runtime"
 	"testing"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
 )
 
-func randomGE() cryptobaseExtendedGroupElement {
+func randomGE() cryptobase.ExtendedGroupElement {
 	r := make([]byte, 32)
 	rand.Read(r)
 	var r2 [32]byte
 	copy(r2[:], r[:32])
-	var R cryptobaseExtendedGroupElement
+	var R cryptobase.ExtendedGroupElement
 	R.FromBytes(&r2)
 	return R
 }
 
 // Coordinator ..
 func TestSumGeSlice(t *testing.T) {
-	var actualR cryptobaseExtendedGroupElement
+	var actualR cryptobase.ExtendedGroupElement
 
 	// empty slice
-	var empty cryptobaseExtendedGroupElement
-	actualR = sumGeSlice([]cryptobaseExtendedGroupElement{})
+	var empty cryptobase.ExtendedGroupElement
+	actualR = sumGeSlice([]cryptobase.ExtendedGroupElement{})
 	if actualR != empty {
 		t.Errorf("Empty slice does not produce empty result. Got: %d.", actualR)
 	}
 
 	// slice size 1
 	R1 := randomGE()
-	actualR = sumGeSlice([]cryptobaseExtendedGroupElement{R1})
+	actualR = sumGeSlice([]cryptobase.ExtendedGroupElement{R1})
 	if actualR != R1 {
 		t.Errorf("Slice size 1 incorrect result, got: %d, want: %d", actualR, R1)
 	}
 
 	// slice size 2
-	var expectedR, R2 cryptobaseExtendedGroupElement
+	var expectedR, R2 cryptobase.ExtendedGroupElement
 	R2 = randomGE()
-	cryptobaseGeAdd(&expectedR, &R1, &R2)
+	cryptobase.GeAdd(&expectedR, &R1, &R2)
 
-	actualR = sumGeSlice([]cryptobaseExtendedGroupElement{R1, R2})
+	actualR = sumGeSlice([]cryptobase.ExtendedGroupElement{R1, R2})
 
 	if expectedR != actualR {
 		t.Errorf("Sum was incorrect, got: %d, want: %d.", expectedR, actualR)
 	}
 
 	// same Ri, but inverted order — test commutativity
-	invertedR := sumGeSlice([]cryptobaseExtendedGroupElement{R2, R1})
+	invertedR := sumGeSlice([]cryptobase.ExtendedGroupElement{R2, R1})
 	if actualR != invertedR {
 		t.Errorf("Sum is not commutative, R12: %d, R21: %d.", actualR, invertedR)
 	}
 }
+
+// offlinePeer fails every signing request
+type offlinePeer struct {
+	Peer
+}
+
+func (p offlinePeer) Commit(ctx context.Context, clientID string, sessionID string, message []byte) (crypto.Digest, error) {
+	return crypto.Digest{}, fmt.Errorf("peer is offline")
+}
+
+func TestThresholdSign(t *testing.T) {
+	cases := []struct{ t, n int }{{1, 1}, {2, 2}, {2, 3}, {3, 3}, {3, 5}}
+	for _, tc := range cases {
+		peers := make([]Peer, tc.n)
+		for i := range peers {
+			peers[i] = NewLocalPeer()
+		}
+		c := NewCoordinator(peers)
+
+		pk, err := c.Keygen(context.Background(), "client", tc.t, tc.n)
+		if err != nil {
+			t.Fatalf("%d of %d: keygen failed: %v", tc.t, tc.n, err)
+		}
+
+		message := []byte("threshold")
+		sig, err := c.Sign(context.Background(), "client", message)
+		if err != nil {
+			t.Fatalf("%d of %d: sign failed: %v", tc.t, tc.n, err)
+		}
+		if !crypto.Verify(pk, sig, message) {
+			t.Errorf("%d of %d: signature is not valid", tc.t, tc.n)
+		}
+	}
+}
+
+func TestThresholdSignWithOfflinePeers(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), NewLocalPeer(), NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator(peers)
+
+	pk, err := c.Keygen(context.Background(), "client", 3, 5)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	// two of five offline, three are enough
+	peers[0] = offlinePeer{peers[0]}
+	peers[3] = offlinePeer{peers[3]}
+	c.(*CoordinatorImpl).committees["client"].members[0].peer = peers[0]
+	c.(*CoordinatorImpl).committees["client"].members[3].peer = peers[3]
+
+	message := []byte("threshold")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+
+	// three of five offline, two are not enough
+	c.(*CoordinatorImpl).committees["client"].members[1].peer = offlinePeer{peers[1]}
+	if _, err := c.Sign(context.Background(), "client", message); err == nil {
+		t.Errorf("sign succeeded with less than threshold peers")
+	}
+}
+
+func TestLagrangeCoefficient(t *testing.T) {
+	secret, _ := randomScalar()
+	f, _ := newRandomPolynomial(secret, 2)
+
+	for _, participants := range [][]int{{1, 2, 3}, {2, 4, 5}, {5, 1, 3}} {
+		var interpolated [32]byte
+		for _, j := range participants {
+			lambda := lagrangeCoefficient(j, participants)
+			share := f.evaluate(j)
+			cryptobase.ScMulAdd(&interpolated, &lambda, &share, &interpolated)
+		}
+		if interpolated != secret {
+			t.Errorf("interpolation over %v does not give the secret", participants)
+		}
+	}
+}
+
+// cheatingPeer returns a partial signature off by one
+type cheatingPeer struct {
+	Peer
+}
+
+func (p cheatingPeer) Si(ctx context.Context, clientID string, sessionID string, nonces map[int]cryptobase.ExtendedGroupElement, message []byte) (*[32]byte, error) {
+	Si, err := p.Peer.Si(ctx, clientID, sessionID, nonces, message)
+	if err != nil {
+		return nil, err
+	}
+	cryptobase.ScAdd(Si, Si, &scOne)
+	return Si, nil
+}
+
+func TestSignIdentifiesCheatingPeer(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "client", 3, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	c.(*CoordinatorImpl).committees["client"].members[1].peer = cheatingPeer{peers[1]}
+
+	_, err := c.Sign(context.Background(), "client", []byte("cheat"))
+	var misbehavior *MisbehaviorError
+	if !errors.As(err, &misbehavior) {
+		t.Fatalf("expected a misbehavior error, got: %v", err)
+	}
+	if misbehavior.Index != 2 {
+		t.Errorf("blamed peer %d, cheater is peer 2", misbehavior.Index)
+	}
+}
+
+// sum of n partial signatures must be reduced modulo the group order, not the field prime.
+// Keygen of n peers takes n^3 scalar multiplications, so every size up to 16 is signed with
+// and one more is sampled up to 64
+func TestPartialSignaturesSumModOrder(t *testing.T) {
+	message := []byte("aggregate")
+	sizes := make([]int, 0, 16)
+	for n := 2; n <= 16; n++ {
+		sizes = append(sizes, n)
+	}
+	if !testing.Short() {
+		n := 17 + mathrand.New(mathrand.NewSource(time.Now().UnixNano())).Intn(64-16)
+		t.Logf("sampled %d peers", n)
+		sizes = append(sizes, n)
+	}
+	for _, n := range sizes {
+		peers := make([]Peer, n)
+		for i := range peers {
+			peers[i] = NewLocalPeer()
+		}
+		c := NewCoordinator(peers, WithPhaseTimeout(5*time.Minute))
+		pk, err := c.Keygen(context.Background(), "client", n, n)
+		if err != nil {
+			t.Fatalf("keygen of %d peers failed: %v", n, err)
+		}
+		sig, err := c.Sign(context.Background(), "client", message)
+		if err != nil {
+			t.Fatalf("sign of %d peers failed: %v", n, err)
+		}
+		if !crypto.Verify(pk, sig, message) {
+			t.Errorf("signature of %d peers is not valid", n)
+		}
+	}
+}
+
+// stuckPeer never answers a commit request until it is cancelled
+type stuckPeer struct {
+	Peer
+}
+
+func (p stuckPeer) Commit(ctx context.Context, clientID string, sessionID string, message []byte) (crypto.Digest, error) {
+	<-ctx.Done()
+	return crypto.Digest{}, ctx.Err()
+}
+
+// waitGoroutines waits until the number of goroutines drops back to n
+func waitGoroutines(t *testing.T, n int) {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			t.Errorf("%d goroutines leaked", runtime.NumGoroutine()-n)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSignPhaseTimeout(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator(peers, WithPhaseTimeout(50*time.Millisecond))
+
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	goroutines := runtime.NumGoroutine()
+
+	// one of three stuck, the others are enough and the stuck commit is cancelled
+	members := c.(*CoordinatorImpl).committees["client"].members
+	members[0].peer = stuckPeer{peers[0]}
+	message := []byte("threshold")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+	waitGoroutines(t, goroutines)
+
+	// two of three stuck, the commit phase times out
+	members[2].peer = stuckPeer{peers[2]}
+	start := time.Now()
+	_, err = c.Sign(context.Background(), "client", message)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the commit phase to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("sign took %v with a phase timeout of 50ms", elapsed)
+	}
+	waitGoroutines(t, goroutines)
+}
+
+func TestSignCancelled(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator(peers)
+
+	if _, err := c.Keygen(context.Background(), "client", 3, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	goroutines := runtime.NumGoroutine()
+
+	c.(*CoordinatorImpl).committees["client"].members[1].peer = stuckPeer{peers[1]}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := c.Sign(ctx, "client", []byte("threshold")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected sign to be cancelled, got %v", err)
+	}
+	waitGoroutines(t, goroutines)
+
+	// a context that is already cancelled fails the sign
+	if _, err := c.Sign(ctx, "client", []byte("threshold")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected sign to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,568 @@
+package peer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/dvshur/distributed-signature/pkg/audit"
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+)
+
+// Distributed key generation after Pedersen, every participant deals a Feldman VSS of its own secret:
+//  1. Deal: participant i picks f_i of degree t-1, publishes commitments C_ik = a_ik·B, shares f_i(j) sealed to j
+//     and a proof of knowledge of a_i0 so that C_i0 cannot be chosen as a function of the others
+//  2. Verify: participant j checks f_i(j)·B == sum C_ik·j^k and complains about every dealer i that fails
+//  3. Reveal: an accused dealer publishes the disputed shares, dealers failing to do so are disqualified
+//  4. Finalize: participant j sums the shares of qualified dealers, A = sum C_i0 over qualified dealers
+//
+// Refresh runs the same rounds with every participant dealing a sharing of zero, C_i0 is the neutral element.
+// Adding the dealt shares to the current ones re-randomizes them while A stays the same.
+// Refreshed shares are kept pending until ApplyRefresh, so that an aborted refresh leaves the old ones intact.
+//
+// Reshare moves the key to a new set of participants with a new threshold. Old participant i deals its share x_i
+// with f_i of degree t'-1, the coordinator checks C_i0 == Y_i. New participant j combines the shares of
+// a qualified set Q of old participants, x'_j = sum λ_i·f_i(j), C'_k = sum λ_i·C_ik, so C'_0 == A.
+
+// Dealing is a peer's contribution to a threshold key:
+// commitments to the coefficients of its polynomial, the first one is Ai = ai·B,
+// a proof of knowledge of ai and the shares f(j) for every participant j, sealed to j's box key
+type Dealing struct {
+	Commitments []cryptobase.ExtendedGroupElement
+	Proof       Proof
+	Sealed      map[int][]byte
+}
+
+// Proof is a Schnorr proof of knowledge of the discrete log of a point
+type Proof struct {
+	R cryptobase.ExtendedGroupElement
+	Z [32]byte
+}
+
+// DealtShare is what a participant receives from a single dealer, Share is opened from Sealed by the participant
+type DealtShare struct {
+	Commitments []cryptobase.ExtendedGroupElement
+	Share       [32]byte
+	Sealed      []byte
+}
+
+type dealing struct {
+	index     int
+	threshold int
+	// shares this peer dealt, kept for Reveal instead of the polynomial, so its secret f(0) is dropped right away
+	dealt      map[int][32]byte
+	received   map[int]DealtShare
+	complaints map[int]bool
+	// refresh dealings share zero and are added to the current key share
+	refresh bool
+	// reshare dealings share the current key shares and are interpolated by a new set of participants
+	reshare bool
+}
+
+// Deal generates a random secret ai and splits it into shares
+// with a polynomial of degree threshold-1, one share per participant sealed to its box key
+func (p *PeerLocal) Deal(ctx context.Context, clientID string, index int, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	if threshold < 1 || threshold > len(participants) {
+		return nil, fmt.Errorf("invalid threshold %d for %d participants", threshold, len(participants))
+	}
+	found := false
+	for _, j := range participants {
+		if j < 1 {
+			return nil, fmt.Errorf("invalid participant index %d", j)
+		}
+		if j == index {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("index %d is not among participants", index)
+	}
+
+	// a key from a keygen that was never confirmed can be generated anew
+	p.mux.RLock()
+	_, clientExists := p.keys[clientID]
+	previous, unconfirmed := p.unconfirmed[clientID]
+	p.mux.RUnlock()
+
+	if clientExists && !(unconfirmed && previous == nil) {
+		return nil, fmt.Errorf("client id %s already exists", clientID)
+	}
+
+	// generate secret key
+	seed := make([]byte, 32)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return nil, err
+	}
+	sk := [32]byte(crypto.GenerateSecretKey(seed))
+
+	f, err := newRandomPolynomial(sk, threshold-1)
+	if err != nil {
+		return nil, err
+	}
+
+	d := Dealing{Commitments: f.commit()}
+	d.Proof, err = proveKnowledge(clientID, index, &sk, &d.Commitments[0])
+	if err != nil {
+		return nil, err
+	}
+	dealt := f.shares(participants)
+	if d.Sealed, err = p.sealShares(dealt, keys); err != nil {
+		return nil, err
+	}
+
+	p.mux.Lock()
+	p.dealings[clientID] = dealing{
+		index:     index,
+		threshold: threshold,
+		dealt:     dealt,
+	}
+	p.mux.Unlock()
+
+	return &d, nil
+}
+
+// Refresh deals a random sharing of zero to the participants holding shares of the client key,
+// sealed to their box keys
+func (p *PeerLocal) Refresh(ctx context.Context, clientID string, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	p.mux.RLock()
+	ks, clientExists := p.keys[clientID]
+	p.mux.RUnlock()
+
+	if !clientExists {
+		return nil, fmt.Errorf("client id %s does not exist", clientID)
+	}
+	found := false
+	for _, j := range participants {
+		if j < 1 {
+			return nil, fmt.Errorf("invalid participant index %d", j)
+		}
+		if j == ks.Index {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("index %d is not among participants", ks.Index)
+	}
+
+	threshold := len(ks.Commitments)
+	f, err := newRandomPolynomial([32]byte{}, threshold-1)
+	if err != nil {
+		return nil, err
+	}
+
+	d := Dealing{Commitments: f.commit()}
+	dealt := f.shares(participants)
+	if d.Sealed, err = p.sealShares(dealt, keys); err != nil {
+		return nil, err
+	}
+
+	p.mux.Lock()
+	p.dealings[clientID] = dealing{
+		index:     ks.Index,
+		threshold: threshold,
+		dealt:     dealt,
+		refresh:   true,
+	}
+	p.mux.Unlock()
+
+	return &d, nil
+}
+
+// Join prepares this peer to receive shares of an existing client key under the new index and threshold
+func (p *PeerLocal) Join(ctx context.Context, clientID string, index int, threshold int) error {
+	if index < 1 {
+		return fmt.Errorf("invalid participant index %d", index)
+	}
+	if threshold < 1 {
+		return fmt.Errorf("invalid threshold %d", threshold)
+	}
+
+	p.mux.Lock()
+	p.dealings[clientID] = dealing{
+		index:     index,
+		threshold: threshold,
+		reshare:   true,
+	}
+	p.mux.Unlock()
+
+	return nil
+}
+
+// Reshare deals this peer's key share to the new participants with a polynomial of degree threshold-1,
+// sealed to their box keys
+func (p *PeerLocal) Reshare(ctx context.Context, clientID string, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	if threshold < 1 || threshold > len(participants) {
+		return nil, fmt.Errorf("invalid threshold %d for %d participants", threshold, len(participants))
+	}
+	for _, j := range participants {
+		if j < 1 {
+			return nil, fmt.Errorf("invalid participant index %d", j)
+		}
+	}
+
+	p.mux.RLock()
+	ks, clientExists := p.keys[clientID]
+	p.mux.RUnlock()
+
+	if !clientExists {
+		return nil, fmt.Errorf("client id %s does not exist", clientID)
+	}
+
+	f, err := newRandomPolynomial(ks.SecretKey, threshold-1)
+	if err != nil {
+		return nil, err
+	}
+
+	d := Dealing{Commitments: f.commit()}
+	dealt := f.shares(participants)
+	if d.Sealed, err = p.sealShares(dealt, keys); err != nil {
+		return nil, err
+	}
+
+	// a peer staying in the committee has joined already and keeps its new index
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	joined, ok := p.dealings[clientID]
+	if !ok || !joined.reshare {
+		joined = dealing{threshold: threshold, reshare: true}
+	} else if joined.threshold != threshold {
+		return nil, fmt.Errorf("joined with threshold %d, reshared with %d", joined.threshold, threshold)
+	}
+	joined.dealt = dealt
+	p.dealings[clientID] = joined
+
+	return &d, nil
+}
+
+// Retire deletes this peer's key share of a client that was reshared to a committee without it
+func (p *PeerLocal) Retire(ctx context.Context, clientID string) error {
+	err := p.retire(clientID)
+	p.record(audit.Entry{Operation: audit.OpRetire, ClientID: clientID}, err)
+	return err
+}
+
+func (p *PeerLocal) retire(clientID string) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if _, clientExists := p.keys[clientID]; !clientExists {
+		return fmt.Errorf("client id %s does not exist", clientID)
+	}
+	if err := p.deleteShare(clientID); err != nil {
+		return err
+	}
+	if _, unconfirmed := p.unconfirmed[clientID]; unconfirmed {
+		if err := p.deletePrevious(clientID); err != nil {
+			return err
+		}
+	}
+	delete(p.keys, clientID)
+	delete(p.unconfirmed, clientID)
+	delete(p.refreshed, clientID)
+	delete(p.dealings, clientID)
+	return nil
+}
+
+// PublicShare returns the public part of the client key share, the coordinator recovers its registry from them
+func (p *PeerLocal) PublicShare(ctx context.Context, clientID string) (*PublicShare, error) {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+
+	ks, clientExists := p.keys[clientID]
+	if !clientExists {
+		return nil, fmt.Errorf("client id %s does not exist", clientID)
+	}
+	commitments := make([]cryptobase.ExtendedGroupElement, len(ks.Commitments))
+	copy(commitments, ks.Commitments)
+	return &PublicShare{Index: ks.Index, Yi: ks.Yi, Commitments: commitments}, nil
+}
+
+// ApplyRefresh replaces the client key share with the one computed by the last refresh or reshare,
+// the replaced share is kept until Confirm or Rollback
+func (p *PeerLocal) ApplyRefresh(ctx context.Context, clientID string) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	ks, refreshed := p.refreshed[clientID]
+	if !refreshed {
+		return fmt.Errorf("no refreshed key share for client id %s", clientID)
+	}
+	var previous *keyShare
+	if current, clientExists := p.keys[clientID]; clientExists {
+		previous = &current
+	}
+	if err := p.putPrevious(clientID, previous); err != nil {
+		return err
+	}
+	if err := p.putShare(clientID, ks); err != nil {
+		return err
+	}
+	p.keys[clientID] = ks
+	p.unconfirmed[clientID] = previous
+	delete(p.refreshed, clientID)
+	return nil
+}
+
+// Confirm drops the share replaced by the last keygen, refresh or reshare, once every member has its new share
+func (p *PeerLocal) Confirm(ctx context.Context, clientID string) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if _, unconfirmed := p.unconfirmed[clientID]; !unconfirmed {
+		return nil
+	}
+	if err := p.deletePrevious(clientID); err != nil {
+		return err
+	}
+	delete(p.unconfirmed, clientID)
+	return nil
+}
+
+// Rollback aborts the keygen, refresh or reshare of the client: a share that is not confirmed yet is replaced
+// by the one before it, or deleted if the key is new. A confirmed share is never touched.
+func (p *PeerLocal) Rollback(ctx context.Context, clientID string) error {
+	restored, err := p.rollback(clientID)
+	if restored {
+		p.record(audit.Entry{Operation: audit.OpRollback, ClientID: clientID}, err)
+	}
+	return err
+}
+
+func (p *PeerLocal) rollback(clientID string) (bool, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	delete(p.dealings, clientID)
+	delete(p.refreshed, clientID)
+	previous, unconfirmed := p.unconfirmed[clientID]
+	if !unconfirmed {
+		return false, nil
+	}
+	if previous == nil {
+		if err := p.deleteShare(clientID); err != nil {
+			return true, err
+		}
+		delete(p.keys, clientID)
+	} else {
+		if err := p.putShare(clientID, *previous); err != nil {
+			return true, err
+		}
+		p.keys[clientID] = *previous
+	}
+	if err := p.deletePrevious(clientID); err != nil {
+		return true, err
+	}
+	delete(p.unconfirmed, clientID)
+	return true, nil
+}
+
+// Verify opens the shares sealed to this peer and checks them against dealers' commitments
+// and returns the indices of dealers it complains about
+func (p *PeerLocal) Verify(ctx context.Context, clientID string, shares map[int]DealtShare) ([]int, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	d, dealingExists := p.dealings[clientID]
+	if !dealingExists {
+		return nil, fmt.Errorf("no dealing for client id %s", clientID)
+	}
+
+	d.received = make(map[int]DealtShare, len(shares))
+	d.complaints = make(map[int]bool)
+	for j, s := range shares {
+		// a share this peer can't open is as bad as a wrong one
+		var opened bool
+		s.Share, opened = p.openShare(s.Sealed)
+		s.Sealed = nil
+		d.received[j] = s
+		if !opened || len(s.Commitments) != d.threshold || !verifyShare(&s.Share, d.index, s.Commitments) {
+			d.complaints[j] = true
+		} else if d.refresh && !cryptobase.GeIsNeutral(&s.Commitments[0]) {
+			// a non-zero sharing would change the key
+			d.complaints[j] = true
+		}
+	}
+	p.dealings[clientID] = d
+
+	complaints := make([]int, 0, len(d.complaints))
+	for j := range d.complaints {
+		complaints = append(complaints, j)
+	}
+	sort.Ints(complaints)
+
+	return complaints, nil
+}
+
+// Reveal publishes the shares this peer dealt to the participants complaining about it, fewer than the threshold
+func (p *PeerLocal) Reveal(ctx context.Context, clientID string, accusers []int) (map[int][32]byte, error) {
+	p.mux.RLock()
+	d, dealingExists := p.dealings[clientID]
+	p.mux.RUnlock()
+
+	if !dealingExists {
+		return nil, fmt.Errorf("no dealing for client id %s", clientID)
+	}
+	// t shares would give away f and the secret it shares
+	if len(d.dealt) == 0 || len(accusers) >= d.threshold {
+		return nil, fmt.Errorf("%d accusers, shares of a polynomial of degree %d can't be revealed", len(accusers), d.threshold-1)
+	}
+
+	revealed := make(map[int][32]byte, len(accusers))
+	for _, j := range accusers {
+		share, ok := d.dealt[j]
+		if j < 1 || !ok {
+			return nil, fmt.Errorf("accuser %d is not a participant", j)
+		}
+		revealed[j] = share
+	}
+	return revealed, nil
+}
+
+// Finalize sums the shares dealt by qualified participants into this peer's key share
+// and returns the public share Yi. Revealed shares replace the ones this peer complained about.
+// When refreshing, the dealt shares are added to the current key share,
+// when resharing, they are interpolated over the qualified old participants.
+func (p *PeerLocal) Finalize(ctx context.Context, clientID string, qualified []int, revealed map[int][32]byte) (*cryptobase.ExtendedGroupElement, error) {
+	op := audit.OpKeygen
+	p.mux.RLock()
+	if d, ok := p.dealings[clientID]; ok && d.refresh {
+		op = audit.OpRefresh
+	} else if ok && d.reshare {
+		op = audit.OpReshare
+	}
+	p.mux.RUnlock()
+
+	Yi, err := p.finalize(ctx, clientID, qualified, revealed)
+	p.record(audit.Entry{Operation: op, ClientID: clientID, Peers: qualified}, err)
+	return Yi, err
+}
+
+func (p *PeerLocal) finalize(ctx context.Context, clientID string, qualified []int, revealed map[int][32]byte) (*cryptobase.ExtendedGroupElement, error) {
+	p.mux.RLock()
+	d, dealingExists := p.dealings[clientID]
+	p.mux.RUnlock()
+
+	if !dealingExists {
+		return nil, fmt.Errorf("no dealing for client id %s", clientID)
+	}
+	// reshare dealers are the old participants, their threshold is checked by the coordinator
+	if !d.reshare && len(qualified) < d.threshold {
+		return nil, fmt.Errorf("%d qualified dealers is less than threshold %d", len(qualified), d.threshold)
+	}
+
+	ks := keyShare{Index: d.index}
+	commitments := make([][]cryptobase.ExtendedGroupElement, len(qualified), len(qualified)+1)
+	if d.refresh {
+		p.mux.RLock()
+		current, clientExists := p.keys[clientID]
+		p.mux.RUnlock()
+		if !clientExists {
+			return nil, fmt.Errorf("client id %s does not exist", clientID)
+		}
+		ks.SecretKey = current.SecretKey
+		commitments = append(commitments, current.Commitments)
+	}
+	for i, j := range qualified {
+		s, ok := d.received[j]
+		if !ok {
+			return nil, fmt.Errorf("no share from dealer %d", j)
+		}
+		if len(s.Commitments) != d.threshold {
+			return nil, fmt.Errorf("dealer %d has %d commitments, expected %d", j, len(s.Commitments), d.threshold)
+		}
+		share := s.Share
+		if d.complaints[j] {
+			share, ok = revealed[j]
+			if !ok || !verifyShare(&share, d.index, s.Commitments) {
+				return nil, fmt.Errorf("dealer %d is qualified without a valid share", j)
+			}
+		}
+		if d.reshare {
+			lambda := lagrangeCoefficient(j, qualified)
+			cryptobase.ScMulAdd(&ks.SecretKey, &lambda, &share, &ks.SecretKey)
+			commitments[i] = scaleCommitments(&lambda, s.Commitments)
+			continue
+		}
+		cryptobase.ScAdd(&ks.SecretKey, &ks.SecretKey, &share)
+		commitments[i] = s.Commitments
+	}
+
+	ks.Commitments = sumCommitments(commitments)
+	cryptobase.GeScalarMultBase(&ks.Yi, &ks.SecretKey)
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if d.refresh || d.reshare {
+		p.refreshed[clientID] = ks
+	} else {
+		// a new key is unconfirmed until the coordinator has registered it
+		if err := p.putPrevious(clientID, nil); err != nil {
+			return nil, err
+		}
+		if err := p.putShare(clientID, ks); err != nil {
+			return nil, err
+		}
+		p.keys[clientID] = ks
+		p.unconfirmed[clientID] = nil
+	}
+	delete(p.dealings, clientID)
+
+	return &ks.Yi, nil
+}
+
+// proveKnowledge proves knowledge of x such that X = x·B, bound to the client and the prover's index
+func proveKnowledge(clientID string, index int, x *[32]byte, X *cryptobase.ExtendedGroupElement) (Proof, error) {
+	var proof Proof
+	r, err := randomScalar()
+	if err != nil {
+		return proof, err
+	}
+	cryptobase.GeScalarMultBase(&proof.R, &r)
+
+	c := proofChallenge(clientID, index, X, &proof.R)
+	cryptobase.ScMulAdd(&proof.Z, &c, x, &r)
+	return proof, nil
+}
+
+// verifyKnowledge checks Z·B == R + c·X
+func verifyKnowledge(clientID string, index int, X *cryptobase.ExtendedGroupElement, proof *Proof) bool {
+	if !cryptobase.ScMinimal(&proof.Z) {
+		return false
+	}
+	c := proofChallenge(clientID, index, X, &proof.R)
+
+	var ZB, cX, expected cryptobase.ExtendedGroupElement
+	cryptobase.GeScalarMultBase(&ZB, &proof.Z)
+	cryptobase.GeScalarMult(&cX, &c, X)
+	cryptobase.GeAdd(&expected, &proof.R, &cX)
+	return geEqual(&ZB, &expected)
+}
+
+func proofChallenge(clientID string, index int, X, R *cryptobase.ExtendedGroupElement) [32]byte {
+	var XBytes, RBytes [32]byte
+	X.ToBytes(&XBytes)
+	R.ToBytes(&RBytes)
+
+	var lengthBytes, indexBytes [8]byte
+	binary.LittleEndian.PutUint64(lengthBytes[:], uint64(len(clientID)))
+	binary.LittleEndian.PutUint64(indexBytes[:], uint64(index))
+
+	h := sha512.New()
+	_, _ = h.Write([]byte("distributed-signature proof of knowledge"))
+	_, _ = h.Write(lengthBytes[:])
+	_, _ = h.Write([]byte(clientID))
+	_, _ = h.Write(indexBytes[:])
+	_, _ = h.Write(XBytes[:])
+	_, _ = h.Write(RBytes[:])
+
+	var cHash [64]byte
+	h.Sum(cHash[:0])
+	var c [32]byte
+	cryptobase.ScReduce(&c, &cHash)
+	return c
+}
@@ -0,0 +1,487 @@
+package peer
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// corruptDealer deals a wrong share to the victim, when lying it also reveals a wrong one
+type corruptDealer struct {
+	Peer
+	victim int
+	lying  bool
+}
+
+func (p corruptDealer) Deal(ctx context.Context, clientID string, index int, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	d, err := p.Peer.Deal(ctx, clientID, index, threshold, participants, keys)
+	if err != nil {
+		return nil, err
+	}
+	share, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	key := keys[p.victim]
+	if d.Sealed[p.victim], err = box.SealAnonymous(nil, share[:], &key, rand.Reader); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (p corruptDealer) Reveal(ctx context.Context, clientID string, accusers []int) (map[int][32]byte, error) {
+	revealed, err := p.Peer.Reveal(ctx, clientID, accusers)
+	if err != nil || !p.lying {
+		return revealed, err
+	}
+	for j, share := range revealed {
+		cryptobase.ScAdd(&share, &share, &scOne)
+		revealed[j] = share
+	}
+	return revealed, nil
+}
+
+func keygenAndSign(t *testing.T, peers []Peer, threshold int) {
+	c := NewCoordinator(peers)
+
+	pk, err := c.Keygen(context.Background(), "client", threshold, len(peers))
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	message := []byte("dkg")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+func TestKeygenComplaintResolved(t *testing.T) {
+	peers := []Peer{
+		corruptDealer{Peer: NewLocalPeer(), victim: 3},
+		NewLocalPeer(),
+		NewLocalPeer(),
+		NewLocalPeer(),
+	}
+	keygenAndSign(t, peers, 3)
+}
+
+func TestKeygenDealerDisqualified(t *testing.T) {
+	peers := []Peer{
+		NewLocalPeer(),
+		corruptDealer{Peer: NewLocalPeer(), victim: 1, lying: true},
+		NewLocalPeer(),
+	}
+	c := NewCoordinator(peers)
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	// the disqualified dealer still holds a valid share of the qualified dealers' secrets
+	c.(*CoordinatorImpl).committees["client"].members[2].peer = offlinePeer{peers[2]}
+
+	message := []byte("dkg")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+func TestKeygenTooManyDisqualified(t *testing.T) {
+	peers := []Peer{
+		corruptDealer{Peer: NewLocalPeer(), victim: 3, lying: true},
+		corruptDealer{Peer: NewLocalPeer(), victim: 3, lying: true},
+		NewLocalPeer(),
+	}
+	c := NewCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err == nil {
+		t.Errorf("keygen succeeded with %d of %d dealers disqualified", 2, 3)
+	}
+}
+
+func TestRevealRefusesSecret(t *testing.T) {
+	p := NewLocalPeer()
+	keys := make(map[int][32]byte)
+	for _, j := range []int{1, 2, 3} {
+		key, err := NewLocalPeer().BoxKey(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[j] = *key
+	}
+	if _, err := p.Deal(context.Background(), "client", 1, 2, []int{1, 2, 3}, keys); err != nil {
+		t.Fatalf("deal failed: %v", err)
+	}
+
+	for _, accusers := range [][]int{{0}, {4}, {2, 3}} {
+		if _, err := p.Reveal(context.Background(), "client", accusers); err == nil {
+			t.Errorf("revealed the shares of %v", accusers)
+		}
+	}
+	if revealed, err := p.Reveal(context.Background(), "client", []int{3}); err != nil || len(revealed) != 1 {
+		t.Errorf("share of a complaining participant not revealed: %v", err)
+	}
+}
+
+// failingFinalizer can't finalize its share
+type failingFinalizer struct {
+	Peer
+}
+
+func (p failingFinalizer) Finalize(ctx context.Context, clientID string, qualified []int, revealed map[int][32]byte) (*cryptobase.ExtendedGroupElement, error) {
+	return nil, fmt.Errorf("disk full")
+}
+
+func TestFailedKeygenRollsBack(t *testing.T) {
+	store, err := NewFileStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := LoadLocalPeer(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := NewLocalPeer()
+	if _, err := NewCoordinator([]Peer{first, second, failingFinalizer{NewLocalPeer()}}).Keygen(context.Background(), "client", 2, 3); err == nil {
+		t.Fatalf("keygen succeeded without a member's share")
+	}
+	for i, p := range []*PeerLocal{first, second} {
+		if len(p.keys) != 0 || len(p.unconfirmed) != 0 {
+			t.Errorf("peer %d kept the key of a failed keygen", i+1)
+		}
+	}
+	// only the box key stays
+	if values, err := store.Load(); err != nil || len(values) != 1 {
+		t.Errorf("store kept %d values of a failed keygen: %v", len(values)-1, err)
+	}
+
+	// the client id can be generated again, and a confirmed key is not rolled back
+	keygenAndSign(t, []Peer{first, second, NewLocalPeer()}, 2)
+	if err := first.Rollback(context.Background(), "client"); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+	values, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := first.keys["client"]; !ok || len(values) != 2 {
+		t.Errorf("rollback deleted a confirmed key, %d values stored", len(values))
+	}
+}
+
+// rogueDealer replaces its Ai with a point it doesn't know the discrete log of
+type rogueDealer struct {
+	Peer
+}
+
+func (p rogueDealer) Deal(ctx context.Context, clientID string, index int, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	d, err := p.Peer.Deal(ctx, clientID, index, threshold, participants, keys)
+	if err != nil {
+		return nil, err
+	}
+	d.Commitments[0] = randomGE()
+	return d, nil
+}
+
+func TestKeygenRejectsRogueKey(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), rogueDealer{NewLocalPeer()}, NewLocalPeer()}
+	c := NewCoordinator(peers)
+
+	_, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err == nil {
+		t.Fatalf("keygen succeeded with a rogue key")
+	}
+	if !strings.HasPrefix(err.Error(), "peer 2:") {
+		t.Errorf("error does not name the rogue peer: %v", err)
+	}
+}
+
+func TestProofOfKnowledgeBoundToClient(t *testing.T) {
+	x, _ := randomScalar()
+	var X cryptobase.ExtendedGroupElement
+	cryptobase.GeScalarMultBase(&X, &x)
+
+	proof, err := proveKnowledge("alice", 1, &x, &X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifyKnowledge("alice", 1, &X, &proof) {
+		t.Errorf("valid proof rejected")
+	}
+	if verifyKnowledge("bob", 1, &X, &proof) {
+		t.Errorf("proof accepted for another client")
+	}
+	if verifyKnowledge("alice", 2, &X, &proof) {
+		t.Errorf("proof accepted for another peer")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	locals := []*PeerLocal{NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	peers := []Peer{locals[0], locals[1], locals[2]}
+	c := NewCoordinator(peers)
+
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	old := locals[0].keys["client"]
+
+	if err := c.Refresh(context.Background(), "client"); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	if refreshedPK, _ := c.GetPublicKey("client"); refreshedPK != pk {
+		t.Errorf("public key changed on refresh")
+	}
+	refreshed := locals[0].keys["client"]
+	if refreshed.SecretKey == old.SecretKey {
+		t.Errorf("key share did not change on refresh")
+	}
+	// the old share doesn't fit the refreshed polynomial anymore
+	if verifyShare(&old.SecretKey, old.Index, refreshed.Commitments) {
+		t.Errorf("old key share is still valid after refresh")
+	}
+
+	for i, p := range locals {
+		if _, ok := p.unconfirmed["client"]; ok {
+			t.Errorf("peer %d kept its old share after the refresh", i+1)
+		}
+	}
+
+	message := []byte("refresh")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+// failingApplier can't switch to its refreshed share
+type failingApplier struct {
+	Peer
+}
+
+func (p failingApplier) ApplyRefresh(ctx context.Context, clientID string) error {
+	return fmt.Errorf("disk full")
+}
+
+func TestFailedRefreshRollsBack(t *testing.T) {
+	locals := []*PeerLocal{NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator([]Peer{locals[0], locals[1], locals[2]})
+	pk, err := c.Keygen(context.Background(), "client", 3, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	old := locals[0].keys["client"]
+	c.(*CoordinatorImpl).committees["client"].members[2].peer = failingApplier{locals[2]}
+
+	if err := c.Refresh(context.Background(), "client"); err == nil {
+		t.Fatalf("refresh succeeded without a member applying its share")
+	}
+	if locals[0].keys["client"].SecretKey != old.SecretKey {
+		t.Errorf("member kept the refreshed share of a failed refresh")
+	}
+
+	// all three signers are back on the shares of the same polynomial
+	message := []byte("refresh")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+// shiftingDealer deals a sharing of a non-zero value on refresh, which would change the key
+type shiftingDealer struct {
+	Peer
+}
+
+func (p shiftingDealer) Refresh(ctx context.Context, clientID string, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	d, err := p.Peer.Refresh(ctx, clientID, participants, keys)
+	if err != nil {
+		return nil, err
+	}
+	// the shares are sealed, shifting the commitments is enough for the coordinator to notice
+	var B cryptobase.ExtendedGroupElement
+	cryptobase.GeScalarMultBase(&B, &scOne)
+	cryptobase.GeAdd(&d.Commitments[0], &d.Commitments[0], &B)
+	return d, nil
+}
+
+func TestRefreshRejectsNonZeroSharing(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), shiftingDealer{NewLocalPeer()}, NewLocalPeer()}
+	c := NewCoordinator(peers)
+
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	err = c.Refresh(context.Background(), "client")
+	var misbehavior *MisbehaviorError
+	if !errors.As(err, &misbehavior) || misbehavior.Index != 2 {
+		t.Fatalf("refresh error does not name the misbehaving peer: %v", err)
+	}
+
+	// an aborted refresh leaves the old shares in use
+	message := []byte("refresh")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+// absentDealer is offline while the key is reshared
+type absentDealer struct {
+	Peer
+}
+
+func (p absentDealer) Reshare(ctx context.Context, clientID string, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	return nil, fmt.Errorf("peer is offline")
+}
+
+func TestReshare(t *testing.T) {
+	locals := []*PeerLocal{NewLocalPeer(), NewLocalPeer(), NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	old := []Peer{locals[0], locals[1], absentDealer{locals[2]}}
+	c := NewCoordinator(old)
+
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	// 2-of-3 to 3-of-4, the second old member stays with a new index
+	reshared := []Peer{locals[3], locals[1], locals[4], old[2]}
+	if err := c.Reshare(context.Background(), "client", reshared, 3); err != nil {
+		t.Fatalf("reshare failed: %v", err)
+	}
+
+	if resharedPK, _ := c.GetPublicKey("client"); resharedPK != pk {
+		t.Errorf("public key changed on reshare")
+	}
+	if _, ok := locals[0].keys["client"]; ok {
+		t.Errorf("member left out of the committee kept its key share")
+	}
+	if index := locals[1].keys["client"].Index; index != 2 {
+		t.Errorf("retained member has index %d, expected 2", index)
+	}
+
+	// any 3 of the new members sign
+	c.(*CoordinatorImpl).committees["client"].members[0].peer = offlinePeer{reshared[0]}
+	message := []byte("reshare")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+func TestFailedReshareRollsBack(t *testing.T) {
+	locals := []*PeerLocal{NewLocalPeer(), NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator([]Peer{locals[0], locals[1], locals[2]})
+	pk, err := c.Keygen(context.Background(), "client", 3, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	old := locals[1].keys["client"]
+
+	// the second old member stays with a new index, the third one can't apply its new share
+	reshared := []Peer{locals[3], locals[1], failingApplier{locals[2]}}
+	if err := c.Reshare(context.Background(), "client", reshared, 2); err == nil {
+		t.Fatalf("reshare succeeded without a new member applying its share")
+	}
+	if _, ok := locals[3].keys["client"]; ok {
+		t.Errorf("new member kept the share of a failed reshare")
+	}
+	if ks := locals[1].keys["client"]; ks.Index != old.Index || ks.SecretKey != old.SecretKey {
+		t.Errorf("retained member kept the share of a failed reshare")
+	}
+	if _, ok := locals[0].keys["client"]; !ok {
+		t.Errorf("member left out retired before the reshare was confirmed")
+	}
+
+	// the old committee still signs with all of its members
+	message := []byte("reshare")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+// failingRetirer can't delete its key share
+type failingRetirer struct {
+	Peer
+}
+
+func (p failingRetirer) Retire(ctx context.Context, clientID string) error {
+	return fmt.Errorf("disk full")
+}
+
+func TestReshareReportsFailedRetire(t *testing.T) {
+	locals := []*PeerLocal{NewLocalPeer(), NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator([]Peer{failingRetirer{locals[0]}, locals[1], locals[2]})
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	err = c.Reshare(context.Background(), "client", []Peer{locals[1], locals[2], locals[3]}, 2)
+	if err == nil || !strings.Contains(err.Error(), "old members [1] failed to retire") {
+		t.Fatalf("reshare error does not name the member still holding a share: %v", err)
+	}
+
+	// the new committee is registered anyway
+	message := []byte("reshare")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+	if _, ok := locals[3].keys["client"]; !ok {
+		t.Errorf("new member has no key share")
+	}
+}
+
+func TestReshareNeedsThresholdOfDealers(t *testing.T) {
+	locals := []*PeerLocal{NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator([]Peer{locals[0], absentDealer{locals[1]}, absentDealer{locals[2]}})
+
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if err := c.Reshare(context.Background(), "client", []Peer{NewLocalPeer(), NewLocalPeer()}, 2); err == nil {
+		t.Errorf("reshare succeeded with 1 dealer of threshold 2")
+	}
+	if _, ok := locals[0].keys["client"]; !ok {
+		t.Errorf("aborted reshare deleted a key share")
+	}
+}
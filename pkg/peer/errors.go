@@ -0,0 +1,61 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnknownClient is returned by a Coordinator for a client id it has no key for
+	ErrUnknownClient = errors.New("unknown client")
+	// ErrClientExists is returned by Keygen for a client id that already has a key
+	ErrClientExists = errors.New("client already exists")
+	// ErrInvalidParameters is returned for a threshold or a set of peers a coordinator can't use
+	ErrInvalidParameters = errors.New("invalid parameters")
+	// ErrWrongPassphrase is returned when a sealed store can't be unlocked with the passphrase
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	// ErrUnknownRequest is returned for a signing request that doesn't exist or expired
+	ErrUnknownRequest = errors.New("unknown signing request")
+	// ErrPendingApproval is returned by Sign for a message that waits for approvals, see PendingApprovalError
+	ErrPendingApproval = errors.New("waiting for approvals")
+)
+
+// MisbehaviorError is an identifiable abort: the peer with the given index
+// sent a value that failed verification, so it can be evicted from the committee
+type MisbehaviorError struct {
+	Index  int
+	Reason string
+}
+
+func (e *MisbehaviorError) Error() string {
+	return fmt.Sprintf("peer %d: %s", e.Index, e.Reason)
+}
+
+// PendingApprovalError is returned by Sign with the request the message waits in,
+// Sign signs the message once the request is approved
+type PendingApprovalError struct {
+	Request SigningRequest
+}
+
+func (e *PendingApprovalError) Error() string {
+	return fmt.Sprintf("request id %s: %v", e.Request.ID, ErrPendingApproval)
+}
+
+func (e *PendingApprovalError) Unwrap() error {
+	return ErrPendingApproval
+}
+
+// RequestFailedError is returned by Sign when signing an approved request failed. The request is cancelled
+// on every peer holding it, signing the message again proposes a new request to approve.
+type RequestFailedError struct {
+	RequestID string
+	Err       error
+}
+
+func (e *RequestFailedError) Error() string {
+	return fmt.Sprintf("request id %s is cancelled, propose the message again: %v", e.RequestID, e.Err)
+}
+
+func (e *RequestFailedError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,535 @@
+package peer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/audit"
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+)
+
+// FROST(Ed25519, SHA-512) threshold signing as in RFC 9591.
+// Nonce commitments don't depend on the message, so they are preprocessed in batches
+// and a signature takes a single round trip to t signers. The challenge is the ed25519 one,
+// so signatures encode into Curve25519 ones the same way as in the aggregate flow.
+
+const frostContextString = "FROST-ED25519-SHA512-v1"
+
+// frostBatchSize is the number of nonce commitments requested from a peer at once
+const frostBatchSize = 16
+
+// maxPreprocess is the most nonces a peer generates in one Preprocess call
+const maxPreprocess = 256
+
+// DefaultNonceBatchTTL is how long a coordinator keeps a batch of preprocessed nonces unless set with WithNonceBatchTTL,
+// well within DefaultNonceTTL of the peers so that it doesn't sign with nonces they have dropped
+const DefaultNonceBatchTTL = DefaultNonceTTL / 2
+
+// WithNonceBatchTTL sets how long a FROST or MuSig coordinator keeps a batch of preprocessed nonces,
+// it has to be shorter than the nonce TTL of the peers (WithNonceTTL)
+func WithNonceBatchTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.nonceBatchTTL = ttl
+	}
+}
+
+// FrostPeer ..
+type FrostPeer interface {
+	Peer
+	Preprocess(ctx context.Context, clientID string, count int) ([]NonceCommitment, error)
+	SignFrost(ctx context.Context, clientID string, message []byte, commitments []NonceCommitment) (*[32]byte, error)
+}
+
+// NonceCommitment is a signer's commitment to a pair of single-use nonces (d, e):
+// Hiding = d·B, Binding = e·B
+type NonceCommitment struct {
+	Index   int
+	Hiding  cryptobase.ExtendedGroupElement
+	Binding cryptobase.ExtendedGroupElement
+}
+
+type frostNonce struct {
+	clientID string
+	hiding   [32]byte
+	binding  [32]byte
+	expires  time.Time
+}
+
+// Preprocess generates count nonce pairs for the client and returns commitments to them, the nonces can be used
+// within the nonce TTL and at most the max nonces of a client are stored at once
+func (p *PeerLocal) Preprocess(ctx context.Context, clientID string, count int) ([]NonceCommitment, error) {
+	p.mux.RLock()
+	kp, clientExists := p.keys[clientID]
+	p.mux.RUnlock()
+
+	if !clientExists {
+		return nil, fmt.Errorf("client id %s does not exist", clientID)
+	}
+	if count < 1 || count > maxPreprocess {
+		return nil, fmt.Errorf("invalid number of nonces %d, at most %d", count, maxPreprocess)
+	}
+
+	commitments := make([]NonceCommitment, count)
+	nonces := make([]frostNonce, count)
+	for i := range commitments {
+		hiding, err := frostGenerateNonce(&kp.SecretKey)
+		if err != nil {
+			return nil, err
+		}
+		binding, err := frostGenerateNonce(&kp.SecretKey)
+		if err != nil {
+			return nil, err
+		}
+		nonces[i] = frostNonce{clientID: clientID, hiding: hiding, binding: binding}
+		commitments[i].Index = kp.Index
+		cryptobase.GeScalarMultBase(&commitments[i].Hiding, &hiding)
+		cryptobase.GeScalarMultBase(&commitments[i].Binding, &binding)
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	now := time.Now()
+	stored := p.expireNonces(now, clientID)
+	if stored+count > p.maxNonces {
+		return nil, fmt.Errorf("too many nonces of client id %s, %d are stored", clientID, stored)
+	}
+	for i := range commitments {
+		nonces[i].expires = now.Add(p.nonceTTL)
+		p.noncesFrost[commitments[i].key()] = nonces[i]
+	}
+
+	return commitments, nil
+}
+
+// expireNonces deletes the FROST nonces past their TTL and returns how many of the client are left,
+// p.mux has to be locked
+func (p *PeerLocal) expireNonces(now time.Time, clientID string) int {
+	stored := 0
+	for key, nonce := range p.noncesFrost {
+		if now.After(nonce.expires) {
+			delete(p.noncesFrost, key)
+		} else if nonce.clientID == clientID {
+			stored++
+		}
+	}
+	return stored
+}
+
+// SignFrost returns this peer's signature share z_i = d_i + e_i·ρ_i + λ_i·s_i·c.
+// The nonces committed to in this peer's entry are consumed, so they can never sign twice.
+func (p *PeerLocal) SignFrost(ctx context.Context, clientID string, message []byte, commitments []NonceCommitment) (*[32]byte, error) {
+	participants := make([]int, len(commitments))
+	for i, nc := range commitments {
+		participants[i] = nc.Index
+	}
+	sort.Ints(participants)
+	zi, err := p.signFrost(ctx, clientID, message, commitments)
+	p.record(audit.Entry{Operation: audit.OpSign, ClientID: clientID, Message: message, Peers: participants}, err)
+	return zi, err
+}
+
+func (p *PeerLocal) signFrost(ctx context.Context, clientID string, message []byte, commitments []NonceCommitment) (*[32]byte, error) {
+	p.mux.RLock()
+	kp, clientExists := p.keys[clientID]
+	p.mux.RUnlock()
+
+	if !clientExists {
+		return nil, fmt.Errorf("client id %s does not exist", clientID)
+	}
+	if len(commitments) < len(kp.Commitments) {
+		return nil, fmt.Errorf("got %d signers, threshold is %d", len(commitments), len(kp.Commitments))
+	}
+
+	participants := make([]int, len(commitments))
+	var own *NonceCommitment
+	for i := range commitments {
+		if i > 0 && commitments[i].Index <= commitments[i-1].Index {
+			return nil, fmt.Errorf("commitments must be sorted by signer index without duplicates")
+		}
+		participants[i] = commitments[i].Index
+		if commitments[i].Index == kp.Index {
+			own = &commitments[i]
+		}
+	}
+	if own == nil {
+		return nil, fmt.Errorf("commitments don't include this peer")
+	}
+	if err := p.checkPolicy(clientID, message); err != nil {
+		return nil, err
+	}
+
+	// the approval is used up only with a valid nonce, a stale commitment doesn't cost the client its approval
+	p.mux.Lock()
+	if err := p.approved(clientID, message, false); err != nil {
+		p.mux.Unlock()
+		return nil, err
+	}
+	nonce, nonceExists := p.noncesFrost[own.key()]
+	delete(p.noncesFrost, own.key())
+	if !nonceExists || nonce.clientID != clientID || time.Now().After(nonce.expires) {
+		p.mux.Unlock()
+		return nil, fmt.Errorf("unknown, expired or already used nonce commitment")
+	}
+	_ = p.approved(clientID, message, true)
+	p.mux.Unlock()
+
+	A := kp.Commitments[0]
+	factors := frostBindingFactors(&A, commitments, message)
+	R := frostGroupCommitment(commitments, factors)
+	c, err := calculateK(&R, &A, message)
+	if err != nil {
+		return nil, err
+	}
+	lambda := lagrangeCoefficient(kp.Index, participants)
+
+	rho := factors[kp.Index]
+	var z [32]byte
+	cryptobase.ScMulAdd(&z, &nonce.binding, &rho, &nonce.hiding)
+	var lambdaC [32]byte
+	cryptobase.ScMul(&lambdaC, &lambda, &c)
+	cryptobase.ScMulAdd(&z, &lambdaC, &kp.SecretKey, &z)
+
+	return &z, nil
+}
+
+func (nc *NonceCommitment) key() [64]byte {
+	var key [64]byte
+	var hiding, binding [32]byte
+	nc.Hiding.ToBytes(&hiding)
+	nc.Binding.ToBytes(&binding)
+	copy(key[:], hiding[:])
+	copy(key[32:], binding[:])
+	return key
+}
+
+// frostHash is H1, H3, H4 and H5 of the ciphersuite, SHA-512 over the context string, a tag and the data
+func frostHash(tag string, data ...[]byte) [64]byte {
+	h := sha512.New()
+	_, _ = h.Write([]byte(frostContextString))
+	_, _ = h.Write([]byte(tag))
+	for _, d := range data {
+		_, _ = h.Write(d)
+	}
+	var digest [64]byte
+	h.Sum(digest[:0])
+	return digest
+}
+
+func frostHashToScalar(tag string, data ...[]byte) [32]byte {
+	digest := frostHash(tag, data...)
+	var s [32]byte
+	cryptobase.ScReduce(&s, &digest)
+	return s
+}
+
+func frostGenerateNonce(secret *[32]byte) ([32]byte, error) {
+	var random [32]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return random, err
+	}
+	return frostHashToScalar("nonce", random[:], secret[:]), nil
+}
+
+func frostEncodeCommitments(commitments []NonceCommitment) []byte {
+	encoded := make([]byte, 0, 96*len(commitments))
+	for _, c := range commitments {
+		var hiding, binding [32]byte
+		c.Hiding.ToBytes(&hiding)
+		c.Binding.ToBytes(&binding)
+		index := scalarFromInt(c.Index)
+		encoded = append(encoded, index[:]...)
+		encoded = append(encoded, hiding[:]...)
+		encoded = append(encoded, binding[:]...)
+	}
+	return encoded
+}
+
+// frostBindingFactors returns ρ_i for every signer, binding its nonces to the message and the signing set
+func frostBindingFactors(A *cryptobase.ExtendedGroupElement, commitments []NonceCommitment, message []byte) map[int][32]byte {
+	var ABytes [32]byte
+	A.ToBytes(&ABytes)
+	messageHash := frostHash("msg", message)
+	commitmentsHash := frostHash("com", frostEncodeCommitments(commitments))
+
+	factors := make(map[int][32]byte, len(commitments))
+	for _, c := range commitments {
+		index := scalarFromInt(c.Index)
+		factors[c.Index] = frostHashToScalar("rho", ABytes[:], messageHash[:], commitmentsHash[:], index[:])
+	}
+	return factors
+}
+
+// frostGroupCommitment returns R = sum D_i + ρ_i·E_i
+func frostGroupCommitment(commitments []NonceCommitment, factors map[int][32]byte) cryptobase.ExtendedGroupElement {
+	terms := make([]cryptobase.ExtendedGroupElement, len(commitments))
+	for i, c := range commitments {
+		rho := factors[c.Index]
+		cryptobase.GeScalarMult(&terms[i], &rho, &c.Binding)
+		cryptobase.GeAdd(&terms[i], &terms[i], &c.Hiding)
+	}
+	return sumGeSlice(terms)
+}
+
+// FrostCoordinator signs with FROST, keys are generated the same way as by CoordinatorImpl
+type FrostCoordinator struct {
+	*CoordinatorImpl
+	commitments    map[string]map[int]commitmentBatch
+	commitmentsMux sync.Mutex
+}
+
+// commitmentBatch is what is left of a batch of nonce commitments preprocessed by a peer
+type commitmentBatch struct {
+	commitments []NonceCommitment
+	expires     time.Time
+}
+
+// NewFrostCoordinator ..
+func NewFrostCoordinator(peers []FrostPeer, opts ...Option) Coordinator {
+	ps := make([]Peer, len(peers))
+	for i, p := range peers {
+		ps[i] = p
+	}
+	return &FrostCoordinator{
+		CoordinatorImpl: NewCoordinator(ps, opts...).(*CoordinatorImpl),
+		commitments:     make(map[string]map[int]commitmentBatch),
+		commitmentsMux:  sync.Mutex{},
+	}
+}
+
+// Sign ..
+func (c *FrostCoordinator) Sign(ctx context.Context, clientID string, message []byte) (crypto.Signature, error) {
+	ctx, span := c.startOperation(ctx, "Sign", clientID)
+	signature, err := c.withApprovals(ctx, clientID, message, func() (crypto.Signature, error) {
+		start := time.Now()
+		signature, signers, err := c.signFrost(ctx, clientID, message)
+		c.metrics.Operation(audit.OpSign, time.Since(start), err)
+		c.record(audit.Entry{Operation: audit.OpSign, ClientID: clientID, Message: message, Peers: memberIndices(signers)}, err)
+		return signature, err
+	})
+	endSpan(span, err)
+	return signature, err
+}
+
+func (c *FrostCoordinator) signFrost(ctx context.Context, clientID string, message []byte) (crypto.Signature, []member, error) {
+	var signature crypto.Signature
+
+	c.mux.RLock()
+	A, clientExists := c.pubKeysEd[clientID]
+	cm := c.committees[clientID]
+	c.mux.RUnlock()
+	if !clientExists {
+		return signature, nil, fmt.Errorf("client id %s: %w", clientID, ErrUnknownClient)
+	}
+
+	// round 1: take preprocessed commitments of t signers
+	signers, commitments, err := c.signingCommitments(ctx, clientID, cm)
+	if err != nil {
+		return signature, nil, err
+	}
+	participants := make([]int, len(signers))
+	for i, m := range signers {
+		participants[i] = m.index
+	}
+
+	factors := frostBindingFactors(&A, commitments, message)
+	R := frostGroupCommitment(commitments, factors)
+	k, err := calculateK(&R, &A, message)
+	if err != nil {
+		return signature, signers, err
+	}
+
+	// round 2: ask signers for signature shares
+	type signatureShare struct {
+		index int
+		zi    [32]byte
+	}
+	signDone := c.timePhase(audit.OpSign, "sign")
+	signCtx, cancelSign := c.phase(ctx)
+	defer cancelSign()
+	errors := make(chan error, len(signers))
+	ZZ := make(chan signatureShare, len(signers))
+	for _, m := range signers {
+		go func(m member) {
+			callCtx, done := c.peerCall(signCtx, m.index, m.peer, "SignFrost")
+			zi, err := m.peer.(FrostPeer).SignFrost(callCtx, clientID, message, commitments)
+			done(err)
+			if err != nil {
+				// the peer may have dropped the rest of the batch as well, take a new one next time
+				c.commitmentsMux.Lock()
+				delete(c.commitments[clientID], m.index)
+				c.commitmentsMux.Unlock()
+				errors <- err
+				return
+			}
+			ZZ <- signatureShare{m.index, *zi}
+		}(m)
+	}
+	var z [32]byte
+	for range signers {
+		select {
+		case share := <-ZZ:
+			// z_i·B == D_i + ρ_i·E_i + λ_i·c·Y_i
+			var ziB, expected, cY cryptobase.ExtendedGroupElement
+			cryptobase.GeScalarMultBase(&ziB, &share.zi)
+			for _, nc := range commitments {
+				if nc.Index == share.index {
+					expected = frostGroupCommitment([]NonceCommitment{nc}, factors)
+				}
+			}
+			lambda := lagrangeCoefficient(share.index, participants)
+			var lambdaK [32]byte
+			cryptobase.ScMul(&lambdaK, &lambda, &k)
+			Yi := evaluateCommitments(cm.commitments, share.index)
+			cryptobase.GeScalarMult(&cY, &lambdaK, &Yi)
+			cryptobase.GeAdd(&expected, &expected, &cY)
+			if !geEqual(&ziB, &expected) {
+				return signature, signers, &MisbehaviorError{Index: share.index, Reason: "invalid signature share"}
+			}
+			cryptobase.ScAdd(&z, &z, &share.zi)
+		case err := <-errors:
+			return signature, signers, err
+		case <-signCtx.Done():
+			return signature, signers, phaseError("sign", signCtx)
+		}
+	}
+	signDone()
+
+	return curveSigFromEd(&R, &A, &z), signers, nil
+}
+
+// Reshare moves the client key to a new set of FROST peers and drops the nonce commitments of the old members
+func (c *FrostCoordinator) Reshare(ctx context.Context, clientID string, peers []Peer, threshold int) error {
+	for i, p := range peers {
+		if _, ok := p.(FrostPeer); !ok {
+			return fmt.Errorf("peer %d does not support frost", i+1)
+		}
+	}
+	if err := c.CoordinatorImpl.Reshare(ctx, clientID, peers, threshold); err != nil {
+		return err
+	}
+
+	c.commitmentsMux.Lock()
+	delete(c.commitments, clientID)
+	c.commitmentsMux.Unlock()
+	return nil
+}
+
+// signingCommitments picks t signers and one unused nonce commitment of each,
+// preprocessing a new batch for members that ran out or whose batch expired
+func (c *FrostCoordinator) signingCommitments(ctx context.Context, clientID string, cm committee) ([]member, []NonceCommitment, error) {
+	signers := make([]member, 0, cm.threshold)
+	commitments := make([]NonceCommitment, 0, cm.threshold)
+	missing := make([]member, 0, len(cm.members))
+
+	c.commitmentsMux.Lock()
+	pool, ok := c.commitments[clientID]
+	if !ok {
+		pool = make(map[int]commitmentBatch)
+		c.commitments[clientID] = pool
+	}
+	now := time.Now()
+	for _, m := range cm.members {
+		queue := pool[m.index]
+		if now.After(queue.expires) {
+			queue = commitmentBatch{}
+			delete(pool, m.index)
+		}
+		if len(signers) < cm.threshold && len(queue.commitments) > 0 {
+			signers = append(signers, m)
+			commitments = append(commitments, queue.commitments[0])
+			queue.commitments = queue.commitments[1:]
+			pool[m.index] = queue
+		} else if len(queue.commitments) == 0 {
+			missing = append(missing, m)
+		}
+	}
+	c.commitmentsMux.Unlock()
+
+	if needed := cm.threshold - len(signers); needed > 0 {
+		type batch struct {
+			member      member
+			commitments []NonceCommitment
+		}
+		preprocessDone := c.timePhase(audit.OpSign, "preprocess")
+		preprocessCtx, cancelPreprocess := c.phase(ctx)
+		defer cancelPreprocess()
+		// the calls outlive the caller and this function, batches arriving once there are enough signers
+		// still go to the pool rather than being dropped while the peers keep their nonces
+		callsCtx, cancelCalls := c.phase(detachedContext{ctx})
+		errors := make(chan error, len(missing))
+		BB := make(chan batch, len(missing))
+		for _, m := range missing {
+			go func(m member) {
+				callCtx, done := c.peerCall(callsCtx, m.index, m.peer, "Preprocess")
+				ncs, err := m.peer.(FrostPeer).Preprocess(callCtx, clientID, frostBatchSize)
+				done(err)
+				if err != nil {
+					errors <- err
+					return
+				}
+				for _, nc := range ncs {
+					if nc.Index != m.index {
+						errors <- &MisbehaviorError{Index: m.index, Reason: fmt.Sprintf("nonce commitment for index %d", nc.Index)}
+						return
+					}
+				}
+				if len(ncs) == 0 {
+					errors <- fmt.Errorf("peer %d: no commitments", m.index)
+					return
+				}
+				BB <- batch{m, ncs}
+			}(m)
+		}
+		pending := len(missing)
+		defer func() {
+			go func(pending int) {
+				defer cancelCalls()
+				for ; pending > 0; pending-- {
+					select {
+					case b := <-BB:
+						c.poolCommitments(pool, b.member.index, b.commitments)
+					case <-errors:
+					}
+				}
+			}(pending)
+		}()
+		failed := 0
+		for needed > 0 {
+			select {
+			case b := <-BB:
+				pending--
+				signers = append(signers, b.member)
+				commitments = append(commitments, b.commitments[0])
+				c.poolCommitments(pool, b.member.index, b.commitments[1:])
+				needed--
+			case err := <-errors:
+				pending--
+				failed++
+				if len(missing)-failed < needed {
+					return nil, nil, fmt.Errorf("not enough peers to sign, %d failed: %v", failed, err)
+				}
+			case <-preprocessCtx.Done():
+				return nil, nil, phaseError("preprocess", preprocessCtx)
+			}
+		}
+		preprocessDone()
+	}
+
+	sort.Slice(signers, func(i, j int) bool { return signers[i].index < signers[j].index })
+	sort.Slice(commitments, func(i, j int) bool { return commitments[i].Index < commitments[j].Index })
+
+	return signers, commitments, nil
+}
+
+// poolCommitments keeps the rest of a member's batch for the next signatures
+func (c *FrostCoordinator) poolCommitments(pool map[int]commitmentBatch, index int, commitments []NonceCommitment) {
+	c.commitmentsMux.Lock()
+	pool[index] = commitmentBatch{commitments: commitments, expires: time.Now().Add(c.nonceBatchTTL)}
+	c.commitmentsMux.Unlock()
+}
@@ -0,0 +1,267 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+)
+
+func TestFrostSign(t *testing.T) {
+	peers := []FrostPeer{NewLocalPeer(), NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewFrostCoordinator(peers)
+
+	pk, err := c.Keygen(context.Background(), "client", 3, 4)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	// more signatures than a batch of nonces
+	for i := 0; i < frostBatchSize+2; i++ {
+		message := []byte{byte(i), 1, 2, 3}
+		sig, err := c.Sign(context.Background(), "client", message)
+		if err != nil {
+			t.Fatalf("sign %d failed: %v", i, err)
+		}
+		if !crypto.Verify(pk, sig, message) {
+			t.Fatalf("signature %d is not valid", i)
+		}
+	}
+}
+
+// offlineFrostPeer fails to preprocess nonces
+type offlineFrostPeer struct {
+	FrostPeer
+}
+
+func (p offlineFrostPeer) Preprocess(ctx context.Context, clientID string, count int) ([]NonceCommitment, error) {
+	return nil, fmt.Errorf("peer is offline")
+}
+
+func TestFrostSignWithOfflinePeer(t *testing.T) {
+	peers := []FrostPeer{NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewFrostCoordinator(peers)
+
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	c.(*FrostCoordinator).committees["client"].members[0].peer = offlineFrostPeer{peers[0]}
+
+	message := []byte("frost")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+func TestFrostNonceSingleUse(t *testing.T) {
+	peers := []FrostPeer{NewLocalPeer(), NewLocalPeer()}
+	c := NewFrostCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	commitments := make([]NonceCommitment, len(peers))
+	for i, p := range peers {
+		ncs, err := p.Preprocess(context.Background(), "client", 1)
+		if err != nil {
+			t.Fatalf("preprocess failed: %v", err)
+		}
+		commitments[i] = ncs[0]
+	}
+
+	if _, err := peers[0].SignFrost(context.Background(), "client", []byte("first"), commitments); err != nil {
+		t.Fatalf("sign share failed: %v", err)
+	}
+	if _, err := peers[0].SignFrost(context.Background(), "client", []byte("second"), commitments); err == nil {
+		t.Errorf("nonce was used twice")
+	}
+}
+
+func TestFrostNonceLimits(t *testing.T) {
+	local := NewLocalPeer(WithMaxNonces(3), WithNonceTTL(20*time.Millisecond))
+	peers := []FrostPeer{local, NewLocalPeer()}
+	if _, err := NewFrostCoordinator(peers).Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	if _, err := local.Preprocess(context.Background(), "client", maxPreprocess+1); err == nil {
+		t.Errorf("preprocess generated more nonces than allowed at once")
+	}
+	own, err := local.Preprocess(context.Background(), "client", 2)
+	if err != nil {
+		t.Fatalf("preprocess failed: %v", err)
+	}
+	if _, err := local.Preprocess(context.Background(), "client", 2); err == nil {
+		t.Errorf("preprocess stored more nonces of the client than the limit")
+	}
+	other, err := peers[1].Preprocess(context.Background(), "client", 1)
+	if err != nil {
+		t.Fatalf("preprocess failed: %v", err)
+	}
+
+	// expired nonces don't sign and are collected on the next preprocess
+	time.Sleep(40 * time.Millisecond)
+	if _, err := local.SignFrost(context.Background(), "client", []byte("message"), []NonceCommitment{own[0], other[0]}); err == nil {
+		t.Errorf("an expired nonce signed")
+	}
+	if _, err := local.Preprocess(context.Background(), "client", 3); err != nil {
+		t.Fatalf("preprocess failed after the nonces expired: %v", err)
+	}
+	if n := len(local.noncesFrost); n != 3 {
+		t.Errorf("%d nonces stored, expected 3", n)
+	}
+}
+
+func TestFrostSignAfterPeerNoncesExpire(t *testing.T) {
+	peers := []FrostPeer{NewLocalPeer(WithNonceTTL(20 * time.Millisecond)), NewLocalPeer()}
+	c := NewFrostCoordinator(peers)
+	pk, err := c.Keygen(context.Background(), "client", 2, 2)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if _, err := c.Sign(context.Background(), "client", []byte("first")); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	// the coordinator still holds commitments the peer has dropped, a failed share makes it take a new batch
+	time.Sleep(40 * time.Millisecond)
+	if _, err := c.Sign(context.Background(), "client", []byte("second")); err == nil {
+		t.Fatalf("signed with expired nonces")
+	}
+	message := []byte("third")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+func TestFrostReshare(t *testing.T) {
+	peers := []FrostPeer{NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c := NewFrostCoordinator(peers)
+
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	// use up part of the preprocessed nonces of the old members
+	if _, err := c.Sign(context.Background(), "client", []byte("before")); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	if err := c.Reshare(context.Background(), "client", []Peer{peers[2], NewLocalPeer(), peers[0]}, 3); err != nil {
+		t.Fatalf("reshare failed: %v", err)
+	}
+
+	message := []byte("after")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+// slowFrostPeer answers Preprocess after the others
+type slowFrostPeer struct {
+	FrostPeer
+}
+
+func (p slowFrostPeer) Preprocess(ctx context.Context, clientID string, count int) ([]NonceCommitment, error) {
+	time.Sleep(20 * time.Millisecond)
+	return p.FrostPeer.Preprocess(ctx, clientID, count)
+}
+
+func TestFrostPoolsLateBatches(t *testing.T) {
+	peers := []FrostPeer{NewLocalPeer(), NewLocalPeer(), slowFrostPeer{NewLocalPeer()}}
+	c := NewFrostCoordinator(peers).(*FrostCoordinator)
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if _, err := c.Sign(context.Background(), "client", []byte("message")); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	c.commitmentsMux.Lock()
+	late := len(c.commitments["client"][3].commitments)
+	c.commitmentsMux.Unlock()
+	if late != frostBatchSize {
+		t.Errorf("%d commitments of the late peer pooled, expected %d", late, frostBatchSize)
+	}
+}
+
+func TestFrostNonceBatchTTL(t *testing.T) {
+	peers := []FrostPeer{NewLocalPeer(WithNonceTTL(40 * time.Millisecond)), NewLocalPeer()}
+	c := NewFrostCoordinator(peers, WithNonceBatchTTL(20*time.Millisecond))
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if _, err := c.Sign(context.Background(), "client", []byte("first")); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	// the coordinator drops its batches before the peer drops the nonces, so no signature fails
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.Sign(context.Background(), "client", []byte("second")); err != nil {
+		t.Errorf("sign failed: %v", err)
+	}
+}
+
+func TestFrostKeepsApprovalOnUnknownNonce(t *testing.T) {
+	alice, bob := newApprover(t, "alice"), newApprover(t, "bob")
+	pol, err := policy.Parse([]byte(`{"clients": {"client": {"approvers": ["` + alice.pk.String() + `", "` + bob.pk.String() + `"], "approvals": 2}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := NewLocalPeer(WithPolicy(pol))
+	c := NewFrostCoordinator([]FrostPeer{local, NewLocalPeer(WithPolicy(pol))}, WithApprovals(time.Minute))
+	pk, err := c.Keygen(context.Background(), "client", 2, 2)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	message := []byte("treasury transfer")
+	_, err = c.Sign(context.Background(), "client", message)
+	var pending *PendingApprovalError
+	if !errors.As(err, &pending) {
+		t.Fatalf("expected a pending request, got %v", err)
+	}
+	for _, a := range []approver{alice, bob} {
+		if _, err := c.(*FrostCoordinator).Approve(context.Background(), pending.Request.ID, a.approve(t, pending.Request)); err != nil {
+			t.Fatalf("approve failed: %v", err)
+		}
+	}
+
+	// a commitment the peer doesn't know fails without using up the approval
+	ncs, err := local.Preprocess(context.Background(), "client", 2)
+	if err != nil {
+		t.Fatalf("preprocess failed: %v", err)
+	}
+	unknown := ncs[0]
+	unknown.Hiding = ncs[1].Hiding
+	other := NonceCommitment{Index: 2, Hiding: ncs[1].Hiding, Binding: ncs[1].Binding}
+	if _, err := local.SignFrost(context.Background(), "client", message, []NonceCommitment{unknown, other}); err == nil {
+		t.Fatalf("signed with an unknown nonce commitment")
+	}
+
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
@@ -0,0 +1,53 @@
+package peer
+
+import "time"
+
+// Metrics observes the operations of a coordinator, package metrics has a Prometheus implementation.
+// Operations and phases are named as in package audit, calls as the Peer methods.
+type Metrics interface {
+	// Operation observes a whole keygen, refresh, reshare, recover or sign
+	Operation(op string, d time.Duration, err error)
+	// Phase observes a round of an operation that ended with every response it waited for
+	Phase(op, phase string, d time.Duration)
+	// PeerCall observes a call to the named peer, the name of a peer stays the same in every committee it is a member of
+	PeerCall(peer string, call string, err error)
+	// Clients sets the number of clients with a key
+	Clients(n int)
+}
+
+// PeerMetrics observes a peer
+type PeerMetrics interface {
+	// Sessions sets the number of open signing sessions
+	Sessions(n int)
+}
+
+// nopMetrics is the default, a library user that doesn't set metrics pays nothing for them
+type nopMetrics struct{}
+
+func (nopMetrics) Operation(string, time.Duration, error) {}
+func (nopMetrics) Phase(string, string, time.Duration)    {}
+func (nopMetrics) PeerCall(string, string, error)         {}
+func (nopMetrics) Clients(int)                            {}
+func (nopMetrics) Sessions(int)                           {}
+
+// WithMetrics makes the coordinator report its operations to m
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithPeerMetrics makes the peer report its signing sessions to m
+func WithPeerMetrics(m PeerMetrics) PeerOption {
+	return func(p *PeerLocal) {
+		p.metrics = m
+	}
+}
+
+// timePhase returns a func that observes the time since timePhase was called as the duration of the phase
+func (o options) timePhase(op, phase string) func() {
+	start := time.Now()
+	return func() {
+		o.metrics.Phase(op, phase, time.Since(start))
+	}
+}
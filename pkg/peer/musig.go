@@ -0,0 +1,594 @@
+package peer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/audit"
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+)
+
+// MuSig2 unanimous signing (Nick, Ruffing, Seurin).
+// Plain public keys X_i are aggregated as X = sum a_i·X_i with a_i = H(L, X_i),
+// which makes rogue key attacks useless without proofs of possession.
+// Every signer commits to two nonces ahead of time, before the message is known:
+//   R = R_1 + b·R_2, b = H(X, R_1, R_2, m), s_i = r_i1 + b·r_i2 + c·a_i·x_i
+// The challenge c is the ed25519 one, so signatures are Curve25519 ones like in the other flows.
+
+// musigBatchSize is the number of nonce pairs requested from a peer at once
+const musigBatchSize = 16
+
+// MuSigPeer ..
+type MuSigPeer interface {
+	Name() string
+	MuSigKey(ctx context.Context, clientID string) (*cryptobase.ExtendedGroupElement, error)
+	MuSigNonces(ctx context.Context, clientID string, count int) ([]MuSigNonce, error)
+	SignMuSig(ctx context.Context, clientID string, keys []cryptobase.ExtendedGroupElement, nonces []MuSigNonce, message []byte) (*[32]byte, error)
+}
+
+// MuSigNonce is a signer's commitment to a pair of single-use nonces: R1 = r1·B, R2 = r2·B.
+// Index is the signer's place among the coordinator's peers, set by the coordinator when it takes the nonce
+type MuSigNonce struct {
+	Index int
+	R1    cryptobase.ExtendedGroupElement
+	R2    cryptobase.ExtendedGroupElement
+}
+
+type keyPair struct {
+	SecretKey [32]byte
+	Ai        cryptobase.ExtendedGroupElement
+}
+
+type musigNonce struct {
+	clientID string
+	r1       [32]byte
+	r2       [32]byte
+	expires  time.Time
+}
+
+// MuSigKey returns the peer's own public key for the client, generating the key pair on first call.
+// Signing requests are held for threshold keys only, so a client whose policy needs approvals gets no musig key.
+func (p *PeerLocal) MuSigKey(ctx context.Context, clientID string) (*cryptobase.ExtendedGroupElement, error) {
+	if err := p.refuseApprovals(clientID); err != nil {
+		return nil, err
+	}
+
+	p.mux.RLock()
+	kp, ok := p.keysMuSig[clientID]
+	p.mux.RUnlock()
+
+	if ok {
+		return &kp.Ai, nil
+	}
+
+	// generate secret key
+	seed := make([]byte, 32)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return nil, err
+	}
+	sk := [32]byte(crypto.GenerateSecretKey(seed))
+
+	var Ai cryptobase.ExtendedGroupElement
+	cryptobase.GeScalarMultBase(&Ai, &sk)
+
+	kp.Ai = Ai
+	kp.SecretKey = sk
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if existing, ok := p.keysMuSig[clientID]; ok {
+		return &existing.Ai, nil
+	}
+	if err := p.putMuSigKey(clientID, kp); err != nil {
+		return nil, err
+	}
+	p.keysMuSig[clientID] = kp
+
+	return &Ai, nil
+}
+
+// MuSigNonces generates count nonce pairs, they don't depend on the message. The nonces can be used
+// within the nonce TTL and at most the max nonces of a client are stored at once, as in Preprocess.
+func (p *PeerLocal) MuSigNonces(ctx context.Context, clientID string, count int) ([]MuSigNonce, error) {
+	p.mux.RLock()
+	_, clientExists := p.keysMuSig[clientID]
+	p.mux.RUnlock()
+
+	if !clientExists {
+		return nil, fmt.Errorf("client id %s does not exist", clientID)
+	}
+	if count < 1 || count > maxPreprocess {
+		return nil, fmt.Errorf("invalid number of nonces %d, at most %d", count, maxPreprocess)
+	}
+
+	commitments := make([]MuSigNonce, count)
+	nonces := make([]musigNonce, count)
+	for i := range commitments {
+		r1, err := randomScalar()
+		if err != nil {
+			return nil, err
+		}
+		r2, err := randomScalar()
+		if err != nil {
+			return nil, err
+		}
+		nonces[i] = musigNonce{clientID: clientID, r1: r1, r2: r2}
+		cryptobase.GeScalarMultBase(&commitments[i].R1, &r1)
+		cryptobase.GeScalarMultBase(&commitments[i].R2, &r2)
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	now := time.Now()
+	stored := p.expireMuSigNonces(now, clientID)
+	if stored+count > p.maxNonces {
+		return nil, fmt.Errorf("too many nonces of client id %s, %d are stored", clientID, stored)
+	}
+	for i := range commitments {
+		nonces[i].expires = now.Add(p.nonceTTL)
+		p.noncesMuSig[commitments[i].key()] = nonces[i]
+	}
+
+	return commitments, nil
+}
+
+// expireMuSigNonces deletes the musig nonces past their TTL and returns how many of the client are left,
+// p.mux has to be locked
+func (p *PeerLocal) expireMuSigNonces(now time.Time, clientID string) int {
+	stored := 0
+	for key, nonce := range p.noncesMuSig {
+		if now.After(nonce.expires) {
+			delete(p.noncesMuSig, key)
+		} else if nonce.clientID == clientID {
+			stored++
+		}
+	}
+	return stored
+}
+
+// SignMuSig returns s_i for the signers' keys and nonces, listed in the same order.
+// The peer's nonce pair is consumed, so it can never sign twice.
+func (p *PeerLocal) SignMuSig(ctx context.Context, clientID string, keys []cryptobase.ExtendedGroupElement, nonces []MuSigNonce, message []byte) (*[32]byte, error) {
+	signers := make([]int, len(nonces))
+	for i, n := range nonces {
+		signers[i] = n.Index
+	}
+	s, err := p.signMuSig(ctx, clientID, keys, nonces, message)
+	p.record(audit.Entry{Operation: audit.OpSign, ClientID: clientID, Message: message, Peers: signers}, err)
+	return s, err
+}
+
+func (p *PeerLocal) signMuSig(ctx context.Context, clientID string, keys []cryptobase.ExtendedGroupElement, nonces []MuSigNonce, message []byte) (*[32]byte, error) {
+	p.mux.RLock()
+	kp, clientExists := p.keysMuSig[clientID]
+	p.mux.RUnlock()
+
+	if !clientExists {
+		return nil, fmt.Errorf("client id %s does not exist", clientID)
+	}
+	if len(keys) != len(nonces) {
+		return nil, fmt.Errorf("got %d keys and %d nonces", len(keys), len(nonces))
+	}
+
+	own := -1
+	for i := range keys {
+		if geEqual(&keys[i], &kp.Ai) {
+			own = i
+		}
+	}
+	if own < 0 {
+		return nil, fmt.Errorf("keys don't include this peer")
+	}
+	if err := p.checkPolicy(clientID, message); err != nil {
+		return nil, err
+	}
+	if err := p.refuseApprovals(clientID); err != nil {
+		return nil, err
+	}
+
+	key := nonces[own].key()
+	p.mux.Lock()
+	nonce, nonceExists := p.noncesMuSig[key]
+	delete(p.noncesMuSig, key)
+	p.mux.Unlock()
+
+	if !nonceExists || nonce.clientID != clientID || time.Now().After(nonce.expires) {
+		return nil, fmt.Errorf("unknown, expired or already used nonce")
+	}
+
+	X, coefficients := musigAggregateKeys(keys)
+	R, b := musigAggregateNonces(&X, nonces, message)
+	c, err := calculateK(&R, &X, message)
+	if err != nil {
+		return nil, err
+	}
+
+	var s [32]byte
+	cryptobase.ScMulAdd(&s, &b, &nonce.r2, &nonce.r1)
+	var ca [32]byte
+	cryptobase.ScMul(&ca, &c, &coefficients[own])
+	cryptobase.ScMulAdd(&s, &ca, &kp.SecretKey, &s)
+
+	return &s, nil
+}
+
+func (n *MuSigNonce) key() [64]byte {
+	var key [64]byte
+	var R1, R2 [32]byte
+	n.R1.ToBytes(&R1)
+	n.R2.ToBytes(&R2)
+	copy(key[:], R1[:])
+	copy(key[32:], R2[:])
+	return key
+}
+
+func musigHashToScalar(tag string, data ...[]byte) [32]byte {
+	h := sha512.New()
+	_, _ = h.Write([]byte(tag))
+	for _, d := range data {
+		_, _ = h.Write(d)
+	}
+	var digest [64]byte
+	h.Sum(digest[:0])
+	var s [32]byte
+	cryptobase.ScReduce(&s, &digest)
+	return s
+}
+
+// musigAggregateKeys returns X = sum a_i·X_i and the coefficients a_i = H(L, X_i), L being the list of keys
+func musigAggregateKeys(keys []cryptobase.ExtendedGroupElement) (cryptobase.ExtendedGroupElement, [][32]byte) {
+	encoded := make([][32]byte, len(keys))
+	L := make([]byte, 0, 32*len(keys))
+	for i := range keys {
+		keys[i].ToBytes(&encoded[i])
+		L = append(L, encoded[i][:]...)
+	}
+	listHash := musigHashToScalar("MuSig2/keys", L)
+
+	coefficients := make([][32]byte, len(keys))
+	terms := make([]cryptobase.ExtendedGroupElement, len(keys))
+	for i := range keys {
+		coefficients[i] = musigHashToScalar("MuSig2/agg", listHash[:], encoded[i][:])
+		cryptobase.GeScalarMult(&terms[i], &coefficients[i], &keys[i])
+	}
+	return sumGeSlice(terms), coefficients
+}
+
+// musigAggregateNonces returns R = R_1 + b·R_2 and b = H(X, R_1, R_2, m)
+func musigAggregateNonces(X *cryptobase.ExtendedGroupElement, nonces []MuSigNonce, message []byte) (cryptobase.ExtendedGroupElement, [32]byte) {
+	R1s := make([]cryptobase.ExtendedGroupElement, len(nonces))
+	R2s := make([]cryptobase.ExtendedGroupElement, len(nonces))
+	for i, n := range nonces {
+		R1s[i] = n.R1
+		R2s[i] = n.R2
+	}
+	R1 := sumGeSlice(R1s)
+	R2 := sumGeSlice(R2s)
+
+	var XBytes, R1Bytes, R2Bytes [32]byte
+	X.ToBytes(&XBytes)
+	R1.ToBytes(&R1Bytes)
+	R2.ToBytes(&R2Bytes)
+	b := musigHashToScalar("MuSig2/non", XBytes[:], R1Bytes[:], R2Bytes[:], message)
+
+	var R cryptobase.ExtendedGroupElement
+	cryptobase.GeScalarMult(&R, &b, &R2)
+	cryptobase.GeAdd(&R, &R1, &R)
+	return R, b
+}
+
+// musigSigner is a peer holding a key pair of the client, index is its place among the coordinator's peers
+type musigSigner struct {
+	peer  MuSigPeer
+	index int
+	Xi    cryptobase.ExtendedGroupElement
+}
+
+// musigBatch is what is left of a batch of nonce pairs preprocessed by a signer
+type musigBatch struct {
+	nonces  []MuSigNonce
+	expires time.Time
+}
+
+// MuSigCoordinator is a Coordinator for the unanimous case based on MuSig2
+type MuSigCoordinator struct {
+	options
+	peers     []MuSigPeer
+	pubKeysEd map[string]cryptobase.ExtendedGroupElement
+	signers   map[string][]musigSigner
+	nonces    map[string][]musigBatch
+	mux       sync.RWMutex
+	noncesMux sync.Mutex
+}
+
+// NewMuSigCoordinator ..
+func NewMuSigCoordinator(peers []MuSigPeer, opts ...Option) Coordinator {
+	return &MuSigCoordinator{
+		options:   newOptions(opts),
+		peers:     peers,
+		pubKeysEd: make(map[string]cryptobase.ExtendedGroupElement),
+		signers:   make(map[string][]musigSigner),
+		nonces:    make(map[string][]musigBatch),
+		mux:       sync.RWMutex{},
+		noncesMux: sync.Mutex{},
+	}
+}
+
+// GetPublicKey ..
+func (c *MuSigCoordinator) GetPublicKey(clientID string) (crypto.PublicKey, bool) {
+	c.mux.RLock()
+	X, ok := c.pubKeysEd[clientID]
+	c.mux.RUnlock()
+	return curvePKFromEdPK(&X), ok
+}
+
+// Keygen aggregates the keys of the first n peers, MuSig2 is n-of-n so t must equal n
+func (c *MuSigCoordinator) Keygen(ctx context.Context, clientID string, t, n int) (crypto.PublicKey, error) {
+	ctx, span := c.startOperation(ctx, "Keygen", clientID)
+	start := time.Now()
+	pk, err := c.keygen(ctx, clientID, t, n)
+	c.metrics.Operation(audit.OpKeygen, time.Since(start), err)
+	endSpan(span, err)
+	c.record(audit.Entry{Operation: audit.OpKeygen, ClientID: clientID, Peers: c.signerIndices(clientID, err)}, err)
+	return pk, err
+}
+
+func (c *MuSigCoordinator) keygen(ctx context.Context, clientID string, t, n int) (crypto.PublicKey, error) {
+	var pk crypto.PublicKey
+
+	if n < 1 || n > len(c.peers) {
+		return pk, fmt.Errorf("invalid number of peers %d, have %d: %w", n, len(c.peers), ErrInvalidParameters)
+	}
+	if t != n {
+		return pk, fmt.Errorf("musig requires all %d peers to sign, got threshold %d: %w", n, t, ErrInvalidParameters)
+	}
+
+	c.mux.RLock()
+	_, clientExists := c.pubKeysEd[clientID]
+	c.mux.RUnlock()
+	if clientExists {
+		return pk, fmt.Errorf("client id %s: %w", clientID, ErrClientExists)
+	}
+
+	type publicKey struct {
+		i  int
+		Xi cryptobase.ExtendedGroupElement
+	}
+	keyDone := c.timePhase(audit.OpKeygen, "key")
+	keyCtx, cancelKey := c.phase(ctx)
+	defer cancelKey()
+	errors := make(chan error, n)
+	XX := make(chan publicKey, n)
+	for i, p := range c.peers[:n] {
+		go func(i int, p MuSigPeer) {
+			callCtx, done := c.peerCall(keyCtx, i+1, p, "MuSigKey")
+			Xi, err := p.MuSigKey(callCtx, clientID)
+			done(err)
+			if err != nil {
+				errors <- err
+				return
+			}
+			XX <- publicKey{i, *Xi}
+		}(i, p)
+	}
+	signers := make([]musigSigner, n)
+	keys := make([]cryptobase.ExtendedGroupElement, n)
+	for range signers {
+		select {
+		case X := <-XX:
+			signers[X.i] = musigSigner{peer: c.peers[X.i], index: X.i + 1, Xi: X.Xi}
+			keys[X.i] = X.Xi
+		case err := <-errors:
+			return pk, err
+		case <-keyCtx.Done():
+			return pk, phaseError("key", keyCtx)
+		}
+	}
+	keyDone()
+	X, _ := musigAggregateKeys(keys)
+
+	c.mux.Lock()
+	c.pubKeysEd[clientID] = X
+	c.signers[clientID] = signers
+	c.metrics.Clients(len(c.pubKeysEd))
+	c.mux.Unlock()
+
+	return curvePKFromEdPK(&X), nil
+}
+
+// Refresh is not supported, MuSig2 keys are aggregated from the peers' own key pairs
+func (c *MuSigCoordinator) Refresh(ctx context.Context, clientID string) error {
+	return fmt.Errorf("refresh is not supported for musig keys")
+}
+
+// Reshare is not supported, the aggregate key depends on every signer's key pair
+func (c *MuSigCoordinator) Reshare(ctx context.Context, clientID string, peers []Peer, threshold int) error {
+	return fmt.Errorf("reshare is not supported for musig keys")
+}
+
+// Sign ..
+func (c *MuSigCoordinator) Sign(ctx context.Context, clientID string, message []byte) (crypto.Signature, error) {
+	ctx, span := c.startOperation(ctx, "Sign", clientID)
+	start := time.Now()
+	signature, err := c.sign(ctx, clientID, message)
+	c.metrics.Operation(audit.OpSign, time.Since(start), err)
+	endSpan(span, err)
+	c.record(audit.Entry{Operation: audit.OpSign, ClientID: clientID, Message: message, Peers: c.signerIndices(clientID, nil)}, err)
+	return signature, err
+}
+
+func (c *MuSigCoordinator) sign(ctx context.Context, clientID string, message []byte) (crypto.Signature, error) {
+	var signature crypto.Signature
+
+	c.mux.RLock()
+	X, clientExists := c.pubKeysEd[clientID]
+	signers := c.signers[clientID]
+	c.mux.RUnlock()
+	if !clientExists {
+		return signature, fmt.Errorf("client id %s: %w", clientID, ErrUnknownClient)
+	}
+
+	keys := make([]cryptobase.ExtendedGroupElement, len(signers))
+	for i, s := range signers {
+		keys[i] = s.Xi
+	}
+
+	// round 1: take preprocessed nonces of every signer
+	nonces, err := c.signingNonces(ctx, clientID, signers)
+	if err != nil {
+		return signature, err
+	}
+
+	_, coefficients := musigAggregateKeys(keys)
+	R, b := musigAggregateNonces(&X, nonces, message)
+	k, err := calculateK(&R, &X, message)
+	if err != nil {
+		return signature, err
+	}
+
+	// round 2: ask every signer for s_i
+	type partialSignature struct {
+		i  int
+		si [32]byte
+	}
+	signDone := c.timePhase(audit.OpSign, "sign")
+	signCtx, cancelSign := c.phase(ctx)
+	defer cancelSign()
+	errors := make(chan error, len(signers))
+	SS := make(chan partialSignature, len(signers))
+	for i, s := range signers {
+		go func(i int, s musigSigner) {
+			callCtx, done := c.peerCall(signCtx, s.index, s.peer, "SignMuSig")
+			si, err := s.peer.SignMuSig(callCtx, clientID, keys, nonces, message)
+			done(err)
+			if err != nil {
+				// the peer may have dropped the rest of the batch as well, take a new one next time
+				c.noncesMux.Lock()
+				if pool := c.nonces[clientID]; i < len(pool) {
+					pool[i] = musigBatch{}
+				}
+				c.noncesMux.Unlock()
+				errors <- err
+				return
+			}
+			SS <- partialSignature{i, *si}
+		}(i, s)
+	}
+	var S [32]byte
+	for range signers {
+		select {
+		case s := <-SS:
+			// s_i·B == R_i1 + b·R_i2 + c·a_i·X_i
+			var siB, bR2, caX, expected cryptobase.ExtendedGroupElement
+			cryptobase.GeScalarMultBase(&siB, &s.si)
+			cryptobase.GeScalarMult(&bR2, &b, &nonces[s.i].R2)
+			var ca [32]byte
+			cryptobase.ScMul(&ca, &k, &coefficients[s.i])
+			cryptobase.GeScalarMult(&caX, &ca, &keys[s.i])
+			cryptobase.GeAdd(&expected, &nonces[s.i].R1, &bR2)
+			cryptobase.GeAdd(&expected, &expected, &caX)
+			if !geEqual(&siB, &expected) {
+				return signature, &MisbehaviorError{Index: signers[s.i].index, Reason: "invalid partial signature"}
+			}
+			cryptobase.ScAdd(&S, &S, &s.si)
+		case err := <-errors:
+			return signature, err
+		case <-signCtx.Done():
+			return signature, phaseError("sign", signCtx)
+		}
+	}
+	signDone()
+
+	return curveSigFromEd(&R, &X, &S), nil
+}
+
+// signerIndices returns the indices of the peers holding the client key, none if err is set
+func (c *MuSigCoordinator) signerIndices(clientID string, err error) []int {
+	if err != nil {
+		return nil
+	}
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	signers := c.signers[clientID]
+	indices := make([]int, len(signers))
+	for i, s := range signers {
+		indices[i] = s.index
+	}
+	return indices
+}
+
+// signingNonces takes an unused nonce pair of every signer, preprocessing a new batch for signers that ran out
+func (c *MuSigCoordinator) signingNonces(ctx context.Context, clientID string, signers []musigSigner) ([]MuSigNonce, error) {
+	nonces := make([]MuSigNonce, len(signers))
+	missing := make([]int, 0, len(signers))
+
+	c.noncesMux.Lock()
+	pool, ok := c.nonces[clientID]
+	if !ok {
+		pool = make([]musigBatch, len(signers))
+		c.nonces[clientID] = pool
+	}
+	now := time.Now()
+	for i := range signers {
+		if now.After(pool[i].expires) {
+			pool[i] = musigBatch{}
+		}
+		if len(pool[i].nonces) > 0 {
+			nonces[i] = pool[i].nonces[0]
+			nonces[i].Index = signers[i].index
+			pool[i].nonces = pool[i].nonces[1:]
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	c.noncesMux.Unlock()
+
+	type batch struct {
+		i      int
+		nonces []MuSigNonce
+	}
+	preprocessDone := c.timePhase(audit.OpSign, "preprocess")
+	preprocessCtx, cancelPreprocess := c.phase(ctx)
+	defer cancelPreprocess()
+	errors := make(chan error, len(missing))
+	BB := make(chan batch, len(missing))
+	for _, i := range missing {
+		go func(i int, s musigSigner) {
+			callCtx, done := c.peerCall(preprocessCtx, s.index, s.peer, "MuSigNonces")
+			ns, err := s.peer.MuSigNonces(callCtx, clientID, musigBatchSize)
+			done(err)
+			if err != nil {
+				errors <- err
+				return
+			}
+			if len(ns) == 0 {
+				errors <- fmt.Errorf("peer %d: no nonces", s.index)
+				return
+			}
+			BB <- batch{i, ns}
+		}(i, signers[i])
+	}
+	for range missing {
+		select {
+		case b := <-BB:
+			nonces[b.i] = b.nonces[0]
+			nonces[b.i].Index = signers[b.i].index
+			c.noncesMux.Lock()
+			pool[b.i] = musigBatch{nonces: b.nonces[1:], expires: time.Now().Add(c.nonceBatchTTL)}
+			c.noncesMux.Unlock()
+		case err := <-errors:
+			return nil, err
+		case <-preprocessCtx.Done():
+			return nil, phaseError("preprocess", preprocessCtx)
+		}
+	}
+	preprocessDone()
+
+	return nonces, nil
+}
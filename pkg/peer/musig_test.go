@@ -0,0 +1,202 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+)
+
+func TestMuSigSign(t *testing.T) {
+	for _, n := range []int{1, 2, 5} {
+		peers := make([]MuSigPeer, n)
+		for i := range peers {
+			peers[i] = NewLocalPeer()
+		}
+		c := NewMuSigCoordinator(peers)
+
+		pk, err := c.Keygen(context.Background(), "client", n, n)
+		if err != nil {
+			t.Fatalf("%d peers: keygen failed: %v", n, err)
+		}
+		if stored, ok := c.GetPublicKey("client"); !ok || stored != pk {
+			t.Fatalf("%d peers: public key is not stored", n)
+		}
+
+		for i := 0; i < musigBatchSize+2; i++ {
+			message := []byte{byte(i), 4, 5, 6}
+			sig, err := c.Sign(context.Background(), "client", message)
+			if err != nil {
+				t.Fatalf("%d peers: sign %d failed: %v", n, i, err)
+			}
+			if !crypto.Verify(pk, sig, message) {
+				t.Fatalf("%d peers: signature %d is not valid", n, i)
+			}
+		}
+	}
+}
+
+func TestMuSigKeygenRequiresAllSigners(t *testing.T) {
+	c := NewMuSigCoordinator([]MuSigPeer{NewLocalPeer(), NewLocalPeer(), NewLocalPeer()})
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err == nil {
+		t.Errorf("musig keygen accepted a threshold below n")
+	}
+}
+
+func TestMuSigRefusesApprovals(t *testing.T) {
+	alice, bob := newApprover(t, "alice"), newApprover(t, "bob")
+	pol, err := policy.Parse([]byte(`{"clients": {"client": {"approvers": ["` + alice.pk.String() + `", "` + bob.pk.String() + `"], "approvals": 2}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var violation *policy.Violation
+
+	c := NewMuSigCoordinator([]MuSigPeer{NewLocalPeer(WithPolicy(pol)), NewLocalPeer()})
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); !errors.As(err, &violation) || violation.Rule != policy.RuleApprovals {
+		t.Errorf("expected a violation of %s, got %v", policy.RuleApprovals, err)
+	}
+
+	// a policy that needs approvals since the key was generated stops signing
+	local := NewLocalPeer()
+	c = NewMuSigCoordinator([]MuSigPeer{local, NewLocalPeer()}, WithApprovals(time.Minute))
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	local.policy = pol
+	if _, err := c.Sign(context.Background(), "client", []byte("message")); !errors.As(err, &violation) || violation.Rule != policy.RuleApprovals {
+		t.Errorf("expected a violation of %s, got %v", policy.RuleApprovals, err)
+	}
+}
+
+func TestMuSigKeyAggregationCoefficients(t *testing.T) {
+	// a rogue key X2 = X* - X1 doesn't give control of the aggregate key
+	x1, _ := randomScalar()
+	xStar, _ := randomScalar()
+	var X1, XStar, X2 cryptobase.ExtendedGroupElement
+	cryptobase.GeScalarMultBase(&X1, &x1)
+	cryptobase.GeScalarMultBase(&XStar, &xStar)
+	var negX1 cryptobase.ExtendedGroupElement
+	cryptobase.GeNeg(&negX1, X1)
+	cryptobase.GeAdd(&X2, &XStar, &negX1)
+
+	X, _ := musigAggregateKeys([]cryptobase.ExtendedGroupElement{X1, X2})
+	if geEqual(&X, &XStar) {
+		t.Errorf("aggregate key equals the rogue key")
+	}
+}
+
+func TestMuSigNonceLimits(t *testing.T) {
+	local := NewLocalPeer(WithMaxNonces(3), WithNonceTTL(20*time.Millisecond))
+	other := NewLocalPeer()
+	if _, err := NewMuSigCoordinator([]MuSigPeer{local, other}).Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	if _, err := local.MuSigNonces(context.Background(), "client", maxPreprocess+1); err == nil {
+		t.Errorf("generated more nonces than allowed at once")
+	}
+	own, err := local.MuSigNonces(context.Background(), "client", 2)
+	if err != nil {
+		t.Fatalf("nonces failed: %v", err)
+	}
+	if _, err := local.MuSigNonces(context.Background(), "client", 2); err == nil {
+		t.Errorf("stored more nonces of the client than the limit")
+	}
+	others, err := other.MuSigNonces(context.Background(), "client", 1)
+	if err != nil {
+		t.Fatalf("nonces failed: %v", err)
+	}
+	keys := make([]cryptobase.ExtendedGroupElement, 2)
+	for i, p := range []*PeerLocal{local, other} {
+		key, err := p.MuSigKey(context.Background(), "client")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = *key
+	}
+
+	// expired nonces don't sign and are collected on the next call
+	time.Sleep(40 * time.Millisecond)
+	if _, err := local.SignMuSig(context.Background(), "client", keys, []MuSigNonce{own[0], others[0]}, []byte("message")); err == nil {
+		t.Errorf("an expired nonce signed")
+	}
+	if _, err := local.MuSigNonces(context.Background(), "client", 3); err != nil {
+		t.Fatalf("nonces failed after the old ones expired: %v", err)
+	}
+	if n := len(local.noncesMuSig); n != 3 {
+		t.Errorf("%d nonces stored, expected 3", n)
+	}
+}
+
+func TestMuSigSignAfterPeerNoncesExpire(t *testing.T) {
+	peers := []MuSigPeer{NewLocalPeer(WithNonceTTL(20 * time.Millisecond)), NewLocalPeer()}
+	c := NewMuSigCoordinator(peers)
+	pk, err := c.Keygen(context.Background(), "client", 2, 2)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if _, err := c.Sign(context.Background(), "client", []byte("first")); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	// the coordinator still holds nonces the peer has dropped, a failed signature makes it take a new batch
+	time.Sleep(40 * time.Millisecond)
+	if _, err := c.Sign(context.Background(), "client", []byte("second")); err == nil {
+		t.Fatalf("signed with expired nonces")
+	}
+	message := []byte("third")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+// wrongMuSigSigner answers with a partial signature that doesn't verify
+type wrongMuSigSigner struct {
+	*PeerLocal
+}
+
+func (p wrongMuSigSigner) SignMuSig(ctx context.Context, clientID string, keys []cryptobase.ExtendedGroupElement, nonces []MuSigNonce, message []byte) (*[32]byte, error) {
+	s, err := p.PeerLocal.SignMuSig(ctx, clientID, keys, nonces, message)
+	if err != nil {
+		return nil, err
+	}
+	s[0] ^= 1
+	return s, nil
+}
+
+func TestMuSigSignerIndices(t *testing.T) {
+	dir := tempDir(t)
+	log := filepath.Join(dir, "peer1.log")
+	peers := []MuSigPeer{NewLocalPeer(WithPeerAudit(openAuditLog(t, log))), NewLocalPeer(), NewLocalPeer()}
+	c := NewMuSigCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if _, err := c.Sign(context.Background(), "client", []byte("message")); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	entries := readAuditLog(t, log)
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0].Peers, []int{1, 2}) {
+		t.Errorf("peer logged %+v", entries)
+	}
+
+	peers[1] = wrongMuSigSigner{NewLocalPeer()}
+	c = NewMuSigCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "wrong", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	var misbehavior *MisbehaviorError
+	if _, err := c.Sign(context.Background(), "wrong", []byte("message")); !errors.As(err, &misbehavior) || misbehavior.Index != 2 {
+		t.Errorf("expected misbehavior of peer 2, got %v", err)
+	}
+}
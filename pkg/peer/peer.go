@@ -2,131 +2,420 @@ package peer
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha512"
+	"encoding/binary"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/dvshur/distributed-signature/pkg/audit"
 	"github.com/dvshur/distributed-signature/pkg/crypto"
 	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+	"github.com/dvshur/distributed-signature/pkg/policy"
 )
 
 // Peer ..
 type Peer interface {
-	Ai(clientID string) (*cryptobase.ExtendedGroupElement, error)
-	Ri(clientID string, sessionID string, message []byte) (*cryptobase.ExtendedGroupElement, error)
-	Si(clientID string, sessionID string, k [32]byte) (*cryptobase.FieldElement, error)
+	Name() string
+	BoxKey(ctx context.Context) (*[32]byte, error)
+	Deal(ctx context.Context, clientID string, index int, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error)
+	Verify(ctx context.Context, clientID string, shares map[int]DealtShare) ([]int, error)
+	Reveal(ctx context.Context, clientID string, accusers []int) (map[int][32]byte, error)
+	Finalize(ctx context.Context, clientID string, qualified []int, revealed map[int][32]byte) (*cryptobase.ExtendedGroupElement, error)
+	Refresh(ctx context.Context, clientID string, participants []int, keys map[int][32]byte) (*Dealing, error)
+	ApplyRefresh(ctx context.Context, clientID string) error
+	Confirm(ctx context.Context, clientID string) error
+	Rollback(ctx context.Context, clientID string) error
+	Join(ctx context.Context, clientID string, index int, threshold int) error
+	Reshare(ctx context.Context, clientID string, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error)
+	Retire(ctx context.Context, clientID string) error
+	PublicShare(ctx context.Context, clientID string) (*PublicShare, error)
+	Commit(ctx context.Context, clientID string, sessionID string, message []byte) (crypto.Digest, error)
+	Ri(ctx context.Context, clientID string, sessionID string, commitments map[int]crypto.Digest) (*cryptobase.ExtendedGroupElement, error)
+	Si(ctx context.Context, clientID string, sessionID string, nonces map[int]cryptobase.ExtendedGroupElement, message []byte) (*[32]byte, error)
+	Hold(ctx context.Context, req *SigningRequest) error
+	Approve(ctx context.Context, clientID string, requestID string, approval Approval) (bool, error)
+	Cancel(ctx context.Context, clientID string, requestID string) error
 }
 
-type keyPair struct {
+type keyShare struct {
+	Index     int
 	SecretKey [32]byte
-	Ai        cryptobase.ExtendedGroupElement
+	Yi        cryptobase.ExtendedGroupElement
+	// Feldman commitments to the joint polynomial, the first one is A
+	Commitments []cryptobase.ExtendedGroupElement
+}
+
+// PublicShare is the public part of a peer's key share: its index, Yi = xi·B and the commitments,
+// the first commitment is the client public key A
+type PublicShare struct {
+	Index       int
+	Yi          cryptobase.ExtendedGroupElement
+	Commitments []cryptobase.ExtendedGroupElement
+}
+
+// session is a signing session of a client and a message, Ri is revealed only once commitments of all signers are known
+type session struct {
+	clientID    string
+	message     []byte
+	ri          [32]byte
+	Ri          cryptobase.ExtendedGroupElement
+	commitments map[int]crypto.Digest
+	expires     time.Time
+}
+
+const (
+	// DefaultSessionTTL is how long a signing session lives unless set with WithSessionTTL
+	DefaultSessionTTL = time.Minute
+	// DefaultMaxSessions is how many signing sessions a peer keeps unless set with WithMaxSessions
+	DefaultMaxSessions = 4096
+	// DefaultNonceTTL is how long a preprocessed FROST or MuSig nonce lives unless set with WithNonceTTL
+	DefaultNonceTTL = 10 * time.Minute
+	// DefaultMaxNonces is how many preprocessed FROST or MuSig nonces a peer keeps per client unless set with WithMaxNonces
+	DefaultMaxNonces = 1024
+)
+
+// PeerOption configures a PeerLocal
+type PeerOption func(*PeerLocal)
+
+// WithSessionTTL sets how long a signing session can be used after Commit
+func WithSessionTTL(ttl time.Duration) PeerOption {
+	return func(p *PeerLocal) {
+		p.sessionTTL = ttl
+	}
+}
+
+// WithMaxSessions sets how many signing sessions can be open at once, Commit fails beyond that
+func WithMaxSessions(n int) PeerOption {
+	return func(p *PeerLocal) {
+		p.maxSessions = n
+	}
+}
+
+// WithNonceTTL sets how long a FROST or MuSig nonce can be used after it is preprocessed
+func WithNonceTTL(ttl time.Duration) PeerOption {
+	return func(p *PeerLocal) {
+		p.nonceTTL = ttl
+	}
+}
+
+// WithMaxNonces sets how many FROST or MuSig nonces of a client can be stored at once, preprocessing fails beyond that
+func WithMaxNonces(n int) PeerOption {
+	return func(p *PeerLocal) {
+		p.maxNonces = n
+	}
+}
+
+// WithPolicy sets the rules the peer checks before it releases a nonce or a partial signature
+func WithPolicy(pol *policy.Policy) PeerOption {
+	return func(p *PeerLocal) {
+		p.policy = pol
+	}
 }
 
 // PeerLocal ..
 type PeerLocal struct {
-	keys       map[string]keyPair
-	sessionsRi map[string][32]byte
-	mux        sync.RWMutex
+	keys      map[string]keyShare
+	dealings  map[string]dealing
+	refreshed map[string]keyShare
+	// shares replaced by a keygen, refresh or reshare the coordinator hasn't confirmed yet, nil for a new key
+	unconfirmed map[string]*keyShare
+	sessionsRi  map[string]session
+	noncesFrost map[[64]byte]frostNonce
+	keysMuSig   map[string]keyPair
+	noncesMuSig map[[64]byte]musigNonce
+	requests    map[string]heldRequest
+	boxKey      *boxKeyPair
+	peerKeys    map[[32]byte]bool
+	store       ShareStore
+	sessionTTL  time.Duration
+	maxSessions int
+	nonceTTL    time.Duration
+	maxNonces   int
+	policy      *policy.Policy
+	auditLog    *audit.Log
+	metrics     PeerMetrics
+	mux         sync.RWMutex
 }
 
 // NewLocalPeer ..
-func NewLocalPeer() Peer {
-	return &PeerLocal{
-		keys:       make(map[string]keyPair),
-		sessionsRi: make(map[string][32]byte),
-		mux:        sync.RWMutex{},
+func NewLocalPeer(opts ...PeerOption) *PeerLocal {
+	p := &PeerLocal{
+		keys:        make(map[string]keyShare),
+		dealings:    make(map[string]dealing),
+		refreshed:   make(map[string]keyShare),
+		unconfirmed: make(map[string]*keyShare),
+		sessionsRi:  make(map[string]session),
+		noncesFrost: make(map[[64]byte]frostNonce),
+		keysMuSig:   make(map[string]keyPair),
+		noncesMuSig: make(map[[64]byte]musigNonce),
+		requests:    make(map[string]heldRequest),
+		sessionTTL:  DefaultSessionTTL,
+		maxSessions: DefaultMaxSessions,
+		nonceTTL:    DefaultNonceTTL,
+		maxNonces:   DefaultMaxNonces,
+		metrics:     nopMetrics{},
+		mux:         sync.RWMutex{},
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
-// Ai ..
-func (p *PeerLocal) Ai(clientID string) (*cryptobase.ExtendedGroupElement, error) {
-	p.mux.RLock()
-	kp, ok := p.keys[clientID]
-	p.mux.RUnlock()
-
-	if ok {
-		return &kp.Ai, nil
+// LoadLocalPeer returns a peer that keeps its key shares in store, loading the ones stored before
+func LoadLocalPeer(store ShareStore, opts ...PeerOption) (*PeerLocal, error) {
+	values, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	p := NewLocalPeer(opts...)
+	p.store = store
+	for key, value := range values {
+		switch {
+		case key == boxKeyName:
+			if p.boxKey, err = loadBoxKey(value); err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+		case strings.HasPrefix(key, shareKeyPrefix):
+			var ks keyShare
+			if err := ks.UnmarshalBinary(value); err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			p.keys[strings.TrimPrefix(key, shareKeyPrefix)] = ks
+		case strings.HasPrefix(key, previousKeyPrefix):
+			var previous *keyShare
+			if len(value) > 0 {
+				previous = &keyShare{}
+				if err := previous.UnmarshalBinary(value); err != nil {
+					return nil, fmt.Errorf("%s: %v", key, err)
+				}
+			}
+			p.unconfirmed[strings.TrimPrefix(key, previousKeyPrefix)] = previous
+		case strings.HasPrefix(key, musigKeyPrefix):
+			var kp keyPair
+			if len(value) != len(kp.SecretKey) {
+				return nil, fmt.Errorf("%s: musig key has %d bytes", key, len(value))
+			}
+			copy(kp.SecretKey[:], value)
+			cryptobase.GeScalarMultBase(&kp.Ai, &kp.SecretKey)
+			p.keysMuSig[strings.TrimPrefix(key, musigKeyPrefix)] = kp
+		default:
+			return nil, fmt.Errorf("unexpected key %s in store", key)
+		}
 	}
+	return p, nil
+}
 
-	// generate secret key
-	seed := make([]byte, 32)
-	_, err := rand.Read(seed)
+// putShare persists a key share before it is used, p.mux has to be locked
+func (p *PeerLocal) putShare(clientID string, ks keyShare) error {
+	if p.store == nil {
+		return nil
+	}
+	value, err := ks.MarshalBinary()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	sk := [32]byte(crypto.GenerateSecretKey(seed))
+	return p.store.Put(shareKeyPrefix+clientID, value)
+}
 
-	var Ai cryptobase.ExtendedGroupElement
-	cryptobase.GeScalarMultBase(&Ai, &sk)
+// deleteShare removes a key share from the store, p.mux has to be locked
+func (p *PeerLocal) deleteShare(clientID string) error {
+	if p.store == nil {
+		return nil
+	}
+	return p.store.Delete(shareKeyPrefix + clientID)
+}
 
-	kp.Ai = Ai
-	kp.SecretKey = sk
+// putPrevious persists the share replaced by an unconfirmed one, nil for a new key, p.mux has to be locked
+func (p *PeerLocal) putPrevious(clientID string, previous *keyShare) error {
+	if p.store == nil {
+		return nil
+	}
+	var value []byte
+	if previous != nil {
+		var err error
+		if value, err = previous.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	return p.store.Put(previousKeyPrefix+clientID, value)
+}
 
-	p.mux.Lock()
-	p.keys[clientID] = kp
-	p.mux.Unlock()
+// deletePrevious removes the replaced share from the store once the new one is confirmed, p.mux has to be locked
+func (p *PeerLocal) deletePrevious(clientID string) error {
+	if p.store == nil {
+		return nil
+	}
+	return p.store.Delete(previousKeyPrefix + clientID)
+}
+
+// putMuSigKey persists a musig key pair before it is used, p.mux has to be locked
+func (p *PeerLocal) putMuSigKey(clientID string, kp keyPair) error {
+	if p.store == nil {
+		return nil
+	}
+	return p.store.Put(musigKeyPrefix+clientID, kp.SecretKey[:])
+}
 
-	return &Ai, nil
+// Commit generates a nonce ri for the session and returns a commitment to Ri = ri·B
+func (p *PeerLocal) Commit(ctx context.Context, clientID string, sessionID string, message []byte) (crypto.Digest, error) {
+	commitment, err := p.commit(ctx, clientID, sessionID, message)
+	if err != nil {
+		// a session is recorded once it signs, only refusals to open one are recorded here
+		p.record(audit.Entry{Operation: audit.OpSign, ClientID: clientID, SessionID: sessionID, Message: message}, err)
+	}
+	return commitment, err
 }
 
-// Ri ..
-func (p *PeerLocal) Ri(clientID string, sessionID string, message []byte) (*cryptobase.ExtendedGroupElement, error) {
+func (p *PeerLocal) commit(ctx context.Context, clientID string, sessionID string, message []byte) (crypto.Digest, error) {
+	var commitment crypto.Digest
+
 	p.mux.RLock()
 	kp, clientExists := p.keys[clientID]
 	p.mux.RUnlock()
 
 	if !clientExists {
-		return nil, fmt.Errorf("client id %s does not exist", clientID)
+		return commitment, fmt.Errorf("client id %s does not exist", clientID)
+	}
+	if err := p.checkPolicy(clientID, message); err != nil {
+		return commitment, err
+	}
+	if err := p.checkApproval(clientID, message, false); err != nil {
+		return commitment, err
 	}
 
-	p.mux.RLock()
-	ri, sessionExists := p.sessionsRi[sessionID]
-	p.mux.RUnlock()
+	var prefix = bytes.Repeat([]byte{0xff}, 32)
+	prefix[0] = 0xfe
 
-	if !sessionExists {
-		var prefix = bytes.Repeat([]byte{0xff}, 32)
-		prefix[0] = 0xfe
+	random := make([]byte, 64)
+	_, err := rand.Read(random)
+	if err != nil {
+		return commitment, err
+	}
 
-		random := make([]byte, 64)
-		_, err := rand.Read(random)
-		if err != nil {
-			return nil, err
-		}
+	var rHash [64]byte
+	h := sha512.New()
+	if _, err := h.Write(prefix); err != nil {
+		return commitment, err
+	}
+	if _, err := h.Write(kp.SecretKey[:]); err != nil {
+		return commitment, err
+	}
+	if _, err := h.Write(message); err != nil {
+		return commitment, err
+	}
+	if _, err := h.Write(random[:]); err != nil {
+		return commitment, err
+	}
+	h.Sum(rHash[:0])
 
-		var rHash [64]byte
-		h := sha512.New()
-		if _, err := h.Write(prefix); err != nil {
-			return nil, err
-		}
-		if _, err := h.Write(kp.SecretKey[:]); err != nil {
-			return nil, err
-		}
-		if _, err := h.Write(message); err != nil {
-			return nil, err
-		}
-		if _, err := h.Write(random[:]); err != nil {
-			return nil, err
+	sess := session{clientID: clientID, message: append([]byte{}, message...)}
+	cryptobase.ScReduce(&sess.ri, &rHash)
+	cryptobase.GeScalarMultBase(&sess.Ri, &sess.ri)
+
+	commitment, err = nonceCommitment(sessionID, kp.Index, &sess.Ri)
+	if err != nil {
+		return commitment, err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if _, sessionExists := p.sessionsRi[sessionID]; sessionExists {
+		return commitment, fmt.Errorf("session id %s already exists", sessionID)
+	}
+	now := time.Now()
+	p.expireSessions(now)
+	if len(p.sessionsRi) >= p.maxSessions {
+		return commitment, fmt.Errorf("too many signing sessions, %d are open", len(p.sessionsRi))
+	}
+	sess.expires = now.Add(p.sessionTTL)
+	p.sessionsRi[sessionID] = sess
+	p.metrics.Sessions(len(p.sessionsRi))
+
+	return commitment, nil
+}
+
+// expireSessions deletes the sessions past their TTL, p.mux has to be locked
+func (p *PeerLocal) expireSessions(now time.Time) {
+	for id, sess := range p.sessionsRi {
+		if now.After(sess.expires) {
+			delete(p.sessionsRi, id)
 		}
-		h.Sum(rHash[:0])
+	}
+	p.metrics.Sessions(len(p.sessionsRi))
+}
+
+// Ri reveals the session nonce once the commitments of all signers are received
+func (p *PeerLocal) Ri(ctx context.Context, clientID string, sessionID string, commitments map[int]crypto.Digest) (*cryptobase.ExtendedGroupElement, error) {
+	Ri, err := p.ri(ctx, clientID, sessionID, commitments)
+	if err != nil {
+		p.record(audit.Entry{Operation: audit.OpSign, ClientID: clientID, SessionID: sessionID}, err)
+	}
+	return Ri, err
+}
+
+func (p *PeerLocal) ri(ctx context.Context, clientID string, sessionID string, commitments map[int]crypto.Digest) (*cryptobase.ExtendedGroupElement, error) {
+	p.mux.RLock()
+	kp, clientExists := p.keys[clientID]
+	p.mux.RUnlock()
+
+	if !clientExists {
+		return nil, fmt.Errorf("client id %s does not exist", clientID)
+	}
 
-		cryptobase.ScReduce(&ri, &rHash)
+	p.mux.Lock()
+	defer p.mux.Unlock()
 
-		p.mux.Lock()
-		p.sessionsRi[sessionID] = ri
-		p.mux.Unlock()
+	sess, sessionExists := p.sessionsRi[sessionID]
+	if !sessionExists || sess.clientID != clientID {
+		return nil, fmt.Errorf("session id %s does not exist", sessionID)
+	}
+	if time.Now().After(sess.expires) {
+		delete(p.sessionsRi, sessionID)
+		p.metrics.Sessions(len(p.sessionsRi))
+		return nil, fmt.Errorf("session id %s expired", sessionID)
+	}
+	if sess.commitments != nil {
+		return nil, fmt.Errorf("session id %s nonce already revealed", sessionID)
+	}
+	if err := p.checkPolicy(clientID, sess.message); err != nil {
+		return nil, err
+	}
+	if err := p.approved(clientID, sess.message, false); err != nil {
+		return nil, err
+	}
 
-		// todo set a goroutine for deleting
+	own, err := nonceCommitment(sessionID, kp.Index, &sess.Ri)
+	if err != nil {
+		return nil, err
+	}
+	if commitments[kp.Index] != own {
+		return nil, fmt.Errorf("session id %s commitments don't include this peer's commitment", sessionID)
 	}
 
-	var Ri cryptobase.ExtendedGroupElement
-	cryptobase.GeScalarMultBase(&Ri, &ri)
+	sess.commitments = make(map[int]crypto.Digest, len(commitments))
+	for j, c := range commitments {
+		sess.commitments[j] = c
+	}
+	p.sessionsRi[sessionID] = sess
 
+	Ri := sess.Ri
 	return &Ri, nil
 }
 
-// Si ..
-func (p *PeerLocal) Si(clientID string, sessionID string, k [32]byte) (*cryptobase.FieldElement, error) {
+// Si returns the partial signature si = k·xi + ri as a canonical scalar. The peer computes k = H(R, A, M) itself
+// from the nonces of the signers and the message the session was opened for.
+func (p *PeerLocal) Si(ctx context.Context, clientID string, sessionID string, nonces map[int]cryptobase.ExtendedGroupElement, message []byte) (*[32]byte, error) {
+	s, err := p.si(ctx, clientID, sessionID, nonces, message)
+	p.record(audit.Entry{Operation: audit.OpSign, ClientID: clientID, SessionID: sessionID, Message: message, Peers: nonceIndices(nonces)}, err)
+	return s, err
+}
+
+func (p *PeerLocal) si(ctx context.Context, clientID string, sessionID string, nonces map[int]cryptobase.ExtendedGroupElement, message []byte) (*[32]byte, error) {
 	p.mux.RLock()
 	kp, clientExists := p.keys[clientID]
 	p.mux.RUnlock()
@@ -134,19 +423,108 @@ func (p *PeerLocal) Si(clientID string, sessionID string, k [32]byte) (*cryptoba
 	if !clientExists {
 		return nil, fmt.Errorf("client id %s does not exist", clientID)
 	}
+	if err := p.checkPolicy(clientID, message); err != nil {
+		return nil, err
+	}
 
-	p.mux.RLock()
-	ri, sessionExists := p.sessionsRi[sessionID]
-	p.mux.RUnlock()
-	if !sessionExists {
-		return nil, fmt.Errorf("session id %s does not exist", sessionID)
+	sess, k, err := p.useSession(clientID, sessionID, kp, nonces, message)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkApproval(clientID, message, true); err != nil {
+		return nil, err
 	}
 
 	var s [32]byte
-	cryptobase.ScMulAdd(&s, &k, &kp.SecretKey, &ri)
+	cryptobase.ScMulAdd(&s, &k, &kp.SecretKey, &sess.ri)
+
+	return &s, nil
+}
+
+// checkPolicy returns a *policy.Violation if the peer's policy does not allow signing the message for the client
+func (p *PeerLocal) checkPolicy(clientID string, message []byte) error {
+	if p.policy == nil {
+		return nil
+	}
+	return p.policy.Check(clientID, message, time.Now())
+}
+
+// useSession checks the message and the signers against the session, computes k = H(R, A, M) from the nonces
+// of the signers and deletes the session. The checks and the deletion are atomic so the nonce ri signs only once.
+func (p *PeerLocal) useSession(clientID, sessionID string, kp keyShare, nonces map[int]cryptobase.ExtendedGroupElement, message []byte) (session, [32]byte, error) {
+	var k [32]byte
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	sess, sessionExists := p.sessionsRi[sessionID]
+	if !sessionExists || sess.clientID != clientID {
+		return sess, k, fmt.Errorf("session id %s does not exist", sessionID)
+	}
+	if time.Now().After(sess.expires) {
+		delete(p.sessionsRi, sessionID)
+		p.metrics.Sessions(len(p.sessionsRi))
+		return sess, k, fmt.Errorf("session id %s expired", sessionID)
+	}
+	if sess.commitments == nil {
+		return sess, k, fmt.Errorf("session id %s nonce is not revealed", sessionID)
+	}
+	if !bytes.Equal(message, sess.message) {
+		return sess, k, fmt.Errorf("message does not match the one session id %s was opened for", sessionID)
+	}
+
+	// the signers are the ones committed to in Ri, at least threshold of them including this peer
+	if len(sess.commitments) < len(kp.Commitments) {
+		return sess, k, fmt.Errorf("%d signers is less than threshold %d", len(sess.commitments), len(kp.Commitments))
+	}
+	if _, ok := sess.commitments[kp.Index]; !ok {
+		return sess, k, fmt.Errorf("signers don't include this peer")
+	}
+
+	// every revealed nonce must match the commitment it was revealed against
+	if len(nonces) != len(sess.commitments) {
+		return sess, k, fmt.Errorf("got %d nonces for %d commitments", len(nonces), len(sess.commitments))
+	}
+	participants := make([]int, 0, len(sess.commitments))
+	for j, commitment := range sess.commitments {
+		Rj, ok := nonces[j]
+		if !ok {
+			return sess, k, fmt.Errorf("no nonce from signer %d", j)
+		}
+		c, err := nonceCommitment(sessionID, j, &Rj)
+		if err != nil {
+			return sess, k, err
+		}
+		if c != commitment {
+			return sess, k, fmt.Errorf("nonce of signer %d does not match its commitment", j)
+		}
+		participants = append(participants, j)
+	}
+
+	R := interpolateGe(nonces, participants)
+	k, err := calculateK(&R, &kp.Commitments[0], sess.message)
+	if err != nil {
+		return sess, k, err
+	}
+
+	delete(p.sessionsRi, sessionID)
+	p.metrics.Sessions(len(p.sessionsRi))
+	return sess, k, nil
+}
+
+// nonceCommitment is a hash of Ri bound to the session and the signer
+func nonceCommitment(sessionID string, index int, Ri *cryptobase.ExtendedGroupElement) (crypto.Digest, error) {
+	var RiBytes [32]byte
+	Ri.ToBytes(&RiBytes)
 
-	var S cryptobase.FieldElement
-	cryptobase.FeFromBytes(&S, &s)
+	var lengthBytes, indexBytes [8]byte
+	binary.LittleEndian.PutUint64(lengthBytes[:], uint64(len(sessionID)))
+	binary.LittleEndian.PutUint64(indexBytes[:], uint64(index))
 
-	return &S, nil
+	data := make([]byte, 0, len(lengthBytes)+len(sessionID)+len(indexBytes)+len(RiBytes))
+	data = append(data, lengthBytes[:]...)
+	data = append(data, sessionID...)
+	data = append(data, indexBytes[:]...)
+	data = append(data, RiBytes[:]...)
+	return crypto.FastHash(data)
 }
@@ -0,0 +1,242 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+	"github.com/mr-tron/base58/base58"
+)
+
+func TestSiRefusesNonceNotMatchingCommitment(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	message := []byte("commit")
+	commitments := make(map[int]crypto.Digest)
+	for i, p := range peers {
+		digest, err := p.Commit(context.Background(), "client", "session", message)
+		if err != nil {
+			t.Fatalf("commit failed: %v", err)
+		}
+		commitments[i+1] = digest
+	}
+	nonces := make(map[int]cryptobase.ExtendedGroupElement)
+	for i, p := range peers {
+		Ri, err := p.Ri(context.Background(), "client", "session", commitments)
+		if err != nil {
+			t.Fatalf("reveal failed: %v", err)
+		}
+		nonces[i+1] = *Ri
+	}
+
+	// the second signer's nonce is swapped after commitments are fixed
+	tampered := map[int]cryptobase.ExtendedGroupElement{1: nonces[1], 2: randomGE()}
+	if _, err := peers[0].Si(context.Background(), "client", "session", tampered, message); err == nil {
+		t.Errorf("Si accepted a nonce not matching its commitment")
+	}
+	if _, err := peers[0].Si(context.Background(), "client", "session", map[int]cryptobase.ExtendedGroupElement{1: nonces[1]}, message); err == nil {
+		t.Errorf("Si accepted a nonce set missing a committed signer")
+	}
+	if _, err := peers[0].Si(context.Background(), "client", "session", nonces, message); err != nil {
+		t.Errorf("Si refused matching nonces: %v", err)
+	}
+}
+
+func TestRiRequiresOwnCommitment(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	if _, err := peers[0].Commit(context.Background(), "client", "session", []byte("commit")); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if _, err := peers[0].Ri(context.Background(), "client", "session", map[int]crypto.Digest{1: {}, 2: {}}); err == nil {
+		t.Errorf("Ri revealed a nonce against a forged commitment")
+	}
+}
+
+// sessionK computes k = H(R, A, M) for the nonces of a session the way the coordinator does
+func sessionK(t *testing.T, p Peer, nonces map[int]cryptobase.ExtendedGroupElement, message []byte) [32]byte {
+	participants := make([]int, 0, len(nonces))
+	for j := range nonces {
+		participants = append(participants, j)
+	}
+	R := interpolateGe(nonces, participants)
+	A := p.(*PeerLocal).keys["client"].Commitments[0]
+	k, err := calculateK(&R, &A, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// openSession commits and reveals the nonces of all peers in the session
+func openSession(t *testing.T, peers []Peer, sessionID string) map[int]cryptobase.ExtendedGroupElement {
+	commitments := make(map[int]crypto.Digest)
+	for i, p := range peers {
+		digest, err := p.Commit(context.Background(), "client", sessionID, []byte("message"))
+		if err != nil {
+			t.Fatalf("commit failed: %v", err)
+		}
+		commitments[i+1] = digest
+	}
+	nonces := make(map[int]cryptobase.ExtendedGroupElement)
+	for i, p := range peers {
+		Ri, err := p.Ri(context.Background(), "client", sessionID, commitments)
+		if err != nil {
+			t.Fatalf("reveal failed: %v", err)
+		}
+		nonces[i+1] = *Ri
+	}
+	return nonces
+}
+
+func TestSiSingleUse(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), NewLocalPeer()}
+	if _, err := NewCoordinator(peers).Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	nonces := openSession(t, peers, "session")
+
+	// two partial signatures with the same ri and different k would reveal the secret share
+	if _, err := peers[0].Si(context.Background(), "client", "session", nonces, []byte("message")); err != nil {
+		t.Fatalf("Si failed: %v", err)
+	}
+	if _, err := peers[0].Si(context.Background(), "client", "session", nonces, []byte("message")); err == nil {
+		t.Errorf("Si signed twice with the same session")
+	}
+	if _, err := peers[0].Ri(context.Background(), "client", "session", map[int]crypto.Digest{}); err == nil {
+		t.Errorf("session is still open after Si")
+	}
+}
+
+func TestSessionExpires(t *testing.T) {
+	peers := []Peer{NewLocalPeer(WithSessionTTL(20 * time.Millisecond)), NewLocalPeer()}
+	if _, err := NewCoordinator(peers).Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	nonces := openSession(t, peers, "session")
+
+	time.Sleep(40 * time.Millisecond)
+	if _, err := peers[0].Si(context.Background(), "client", "session", nonces, []byte("message")); err == nil {
+		t.Errorf("Si used an expired session")
+	}
+
+	// expired sessions are collected on the next commit
+	local := peers[0].(*PeerLocal)
+	if _, err := local.Commit(context.Background(), "client", "expired", []byte("message")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, err := local.Commit(context.Background(), "client", "next", []byte("message")); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(local.sessionsRi); n != 1 {
+		t.Errorf("%d sessions open, expected 1", n)
+	}
+}
+
+func TestMaxSessions(t *testing.T) {
+	peers := []Peer{NewLocalPeer(WithMaxSessions(2)), NewLocalPeer()}
+	c := NewCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	nonces := openSession(t, peers, "first")
+	if _, err := peers[0].Commit(context.Background(), "client", "second", []byte("message")); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if _, err := peers[0].Commit(context.Background(), "client", "third", []byte("message")); err == nil {
+		t.Errorf("commit opened more sessions than the limit")
+	}
+
+	// a used session frees its slot
+	if _, err := peers[0].Si(context.Background(), "client", "first", nonces, []byte("message")); err != nil {
+		t.Fatalf("Si failed: %v", err)
+	}
+	if _, err := peers[0].Commit(context.Background(), "client", "third", []byte("message")); err != nil {
+		t.Errorf("commit failed after a session was used: %v", err)
+	}
+}
+
+func TestSessionBoundToClientAndMessage(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), NewLocalPeer()}
+	c := NewCoordinator(peers)
+	for _, clientID := range []string{"client", "other"} {
+		if _, err := c.Keygen(context.Background(), clientID, 2, 2); err != nil {
+			t.Fatalf("keygen failed: %v", err)
+		}
+	}
+	nonces := openSession(t, peers, "session")
+
+	if _, err := peers[0].Ri(context.Background(), "other", "session", map[int]crypto.Digest{}); err == nil {
+		t.Errorf("Ri revealed a nonce of another client's session")
+	}
+	if _, err := peers[0].Si(context.Background(), "other", "session", nonces, []byte("message")); err == nil {
+		t.Errorf("Si signed for another client")
+	}
+	if _, err := peers[0].Si(context.Background(), "client", "session", nonces, []byte("other message")); err == nil {
+		t.Errorf("Si signed another message")
+	}
+
+	// the partial signature is for k = H(R, A, M) of the session
+	Si, err := peers[0].Si(context.Background(), "client", "session", nonces, []byte("message"))
+	if err != nil {
+		t.Fatalf("Si failed: %v", err)
+	}
+	k := sessionK(t, peers[0], nonces, []byte("message"))
+	Yi := peers[0].(*PeerLocal).keys["client"].Yi
+	if !verifyPartialSignature(Si, &k, nonces[1], Yi) {
+		t.Errorf("partial signature is not for the session challenge")
+	}
+}
+
+func TestPolicyRefusesSession(t *testing.T) {
+	pol, err := policy.Parse([]byte(`{"clients": {"client": {"messagePrefixes": ["` + base58.Encode([]byte("mess")) + `"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []Peer{NewLocalPeer(WithPolicy(pol)), NewLocalPeer()}
+	if _, err := NewCoordinator(peers).Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	// no session is opened for a message the policy refuses
+	_, err = peers[0].Commit(context.Background(), "client", "session", []byte("commit"))
+	var violation *policy.Violation
+	if !errors.As(err, &violation) || violation.Rule != policy.RuleMessagePrefixes {
+		t.Errorf("commit opened a session for a message the policy refuses: %v", err)
+	}
+
+	// nor is a nonce revealed if the policy changed since the commit
+	digest, err := peers[0].Commit(context.Background(), "client", "changed", []byte("message"))
+	if err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	closed, err := policy.Parse([]byte(`{"default": {"hours": []}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers[0].(*PeerLocal).policy = closed
+	if _, err := peers[0].Ri(context.Background(), "client", "changed", map[int]crypto.Digest{1: digest}); !errors.As(err, &violation) {
+		t.Errorf("Ri revealed a nonce for a message the policy refuses: %v", err)
+	}
+
+	// the allowed message is signed
+	peers[0].(*PeerLocal).policy = pol
+	nonces := openSession(t, peers, "allowed")
+	if _, err := peers[0].Si(context.Background(), "client", "allowed", nonces, []byte("message")); err != nil {
+		t.Errorf("Si failed: %v", err)
+	}
+}
@@ -0,0 +1,4 @@
+// Package peerpb contains the gRPC service of a peer, generated from peer.proto
+package peerpb
+
+//go:generate buf generate
@@ -0,0 +1,745 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package peerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion7
+
+// PeerClient is the client API for Peer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PeerClient interface {
+	BoxKey(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*BoxKeyResponse, error)
+	Deal(ctx context.Context, in *DealRequest, opts ...grpc.CallOption) (*Dealing, error)
+	Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*VerifyResponse, error)
+	Reveal(ctx context.Context, in *RevealRequest, opts ...grpc.CallOption) (*Shares, error)
+	Finalize(ctx context.Context, in *FinalizeRequest, opts ...grpc.CallOption) (*Point, error)
+	Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*Dealing, error)
+	ApplyRefresh(ctx context.Context, in *ClientRequest, opts ...grpc.CallOption) (*Empty, error)
+	Confirm(ctx context.Context, in *ClientRequest, opts ...grpc.CallOption) (*Empty, error)
+	Rollback(ctx context.Context, in *ClientRequest, opts ...grpc.CallOption) (*Empty, error)
+	Join(ctx context.Context, in *JoinRequest, opts ...grpc.CallOption) (*Empty, error)
+	Reshare(ctx context.Context, in *ReshareRequest, opts ...grpc.CallOption) (*Dealing, error)
+	Retire(ctx context.Context, in *ClientRequest, opts ...grpc.CallOption) (*Empty, error)
+	PublicShare(ctx context.Context, in *ClientRequest, opts ...grpc.CallOption) (*PublicShareResponse, error)
+	Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error)
+	Ri(ctx context.Context, in *RiRequest, opts ...grpc.CallOption) (*Point, error)
+	Si(ctx context.Context, in *SiRequest, opts ...grpc.CallOption) (*Scalar, error)
+	Hold(ctx context.Context, in *HoldRequest, opts ...grpc.CallOption) (*Empty, error)
+	Approve(ctx context.Context, in *ApproveRequest, opts ...grpc.CallOption) (*ApproveResponse, error)
+	Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type peerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPeerClient(cc grpc.ClientConnInterface) PeerClient {
+	return &peerClient{cc}
+}
+
+func (c *peerClient) BoxKey(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*BoxKeyResponse, error) {
+	out := new(BoxKeyResponse)
+	err := c.cc.Invoke(ctx, "/peer.Peer/BoxKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Deal(ctx context.Context, in *DealRequest, opts ...grpc.CallOption) (*Dealing, error) {
+	out := new(Dealing)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Deal", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*VerifyResponse, error) {
+	out := new(VerifyResponse)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Verify", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Reveal(ctx context.Context, in *RevealRequest, opts ...grpc.CallOption) (*Shares, error) {
+	out := new(Shares)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Reveal", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Finalize(ctx context.Context, in *FinalizeRequest, opts ...grpc.CallOption) (*Point, error) {
+	out := new(Point)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Finalize", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*Dealing, error) {
+	out := new(Dealing)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Refresh", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) ApplyRefresh(ctx context.Context, in *ClientRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/peer.Peer/ApplyRefresh", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Confirm(ctx context.Context, in *ClientRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Confirm", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Rollback(ctx context.Context, in *ClientRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Rollback", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Join(ctx context.Context, in *JoinRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Join", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Reshare(ctx context.Context, in *ReshareRequest, opts ...grpc.CallOption) (*Dealing, error) {
+	out := new(Dealing)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Reshare", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Retire(ctx context.Context, in *ClientRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Retire", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) PublicShare(ctx context.Context, in *ClientRequest, opts ...grpc.CallOption) (*PublicShareResponse, error) {
+	out := new(PublicShareResponse)
+	err := c.cc.Invoke(ctx, "/peer.Peer/PublicShare", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error) {
+	out := new(CommitResponse)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Commit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Ri(ctx context.Context, in *RiRequest, opts ...grpc.CallOption) (*Point, error) {
+	out := new(Point)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Ri", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Si(ctx context.Context, in *SiRequest, opts ...grpc.CallOption) (*Scalar, error) {
+	out := new(Scalar)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Si", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Hold(ctx context.Context, in *HoldRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Hold", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Approve(ctx context.Context, in *ApproveRequest, opts ...grpc.CallOption) (*ApproveResponse, error) {
+	out := new(ApproveResponse)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Approve", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerClient) Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/peer.Peer/Cancel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PeerServer is the server API for Peer service.
+// All implementations must embed UnimplementedPeerServer
+// for forward compatibility
+type PeerServer interface {
+	BoxKey(context.Context, *Empty) (*BoxKeyResponse, error)
+	Deal(context.Context, *DealRequest) (*Dealing, error)
+	Verify(context.Context, *VerifyRequest) (*VerifyResponse, error)
+	Reveal(context.Context, *RevealRequest) (*Shares, error)
+	Finalize(context.Context, *FinalizeRequest) (*Point, error)
+	Refresh(context.Context, *RefreshRequest) (*Dealing, error)
+	ApplyRefresh(context.Context, *ClientRequest) (*Empty, error)
+	Confirm(context.Context, *ClientRequest) (*Empty, error)
+	Rollback(context.Context, *ClientRequest) (*Empty, error)
+	Join(context.Context, *JoinRequest) (*Empty, error)
+	Reshare(context.Context, *ReshareRequest) (*Dealing, error)
+	Retire(context.Context, *ClientRequest) (*Empty, error)
+	PublicShare(context.Context, *ClientRequest) (*PublicShareResponse, error)
+	Commit(context.Context, *CommitRequest) (*CommitResponse, error)
+	Ri(context.Context, *RiRequest) (*Point, error)
+	Si(context.Context, *SiRequest) (*Scalar, error)
+	Hold(context.Context, *HoldRequest) (*Empty, error)
+	Approve(context.Context, *ApproveRequest) (*ApproveResponse, error)
+	Cancel(context.Context, *CancelRequest) (*Empty, error)
+	mustEmbedUnimplementedPeerServer()
+}
+
+// UnimplementedPeerServer must be embedded to have forward compatible implementations.
+type UnimplementedPeerServer struct {
+}
+
+func (UnimplementedPeerServer) BoxKey(context.Context, *Empty) (*BoxKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BoxKey not implemented")
+}
+func (UnimplementedPeerServer) Deal(context.Context, *DealRequest) (*Dealing, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Deal not implemented")
+}
+func (UnimplementedPeerServer) Verify(context.Context, *VerifyRequest) (*VerifyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedPeerServer) Reveal(context.Context, *RevealRequest) (*Shares, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reveal not implemented")
+}
+func (UnimplementedPeerServer) Finalize(context.Context, *FinalizeRequest) (*Point, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Finalize not implemented")
+}
+func (UnimplementedPeerServer) Refresh(context.Context, *RefreshRequest) (*Dealing, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Refresh not implemented")
+}
+func (UnimplementedPeerServer) ApplyRefresh(context.Context, *ClientRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApplyRefresh not implemented")
+}
+func (UnimplementedPeerServer) Confirm(context.Context, *ClientRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Confirm not implemented")
+}
+func (UnimplementedPeerServer) Rollback(context.Context, *ClientRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rollback not implemented")
+}
+func (UnimplementedPeerServer) Join(context.Context, *JoinRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Join not implemented")
+}
+func (UnimplementedPeerServer) Reshare(context.Context, *ReshareRequest) (*Dealing, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reshare not implemented")
+}
+func (UnimplementedPeerServer) Retire(context.Context, *ClientRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Retire not implemented")
+}
+func (UnimplementedPeerServer) PublicShare(context.Context, *ClientRequest) (*PublicShareResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PublicShare not implemented")
+}
+func (UnimplementedPeerServer) Commit(context.Context, *CommitRequest) (*CommitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Commit not implemented")
+}
+func (UnimplementedPeerServer) Ri(context.Context, *RiRequest) (*Point, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ri not implemented")
+}
+func (UnimplementedPeerServer) Si(context.Context, *SiRequest) (*Scalar, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Si not implemented")
+}
+func (UnimplementedPeerServer) Hold(context.Context, *HoldRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Hold not implemented")
+}
+func (UnimplementedPeerServer) Approve(context.Context, *ApproveRequest) (*ApproveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Approve not implemented")
+}
+func (UnimplementedPeerServer) Cancel(context.Context, *CancelRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cancel not implemented")
+}
+func (UnimplementedPeerServer) mustEmbedUnimplementedPeerServer() {}
+
+// UnsafePeerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PeerServer will
+// result in compilation errors.
+type UnsafePeerServer interface {
+	mustEmbedUnimplementedPeerServer()
+}
+
+func RegisterPeerServer(s *grpc.Server, srv PeerServer) {
+	s.RegisterService(&_Peer_serviceDesc, srv)
+}
+
+func _Peer_BoxKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).BoxKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/BoxKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).BoxKey(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Deal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DealRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Deal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Deal",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Deal(ctx, req.(*DealRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Verify",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Verify(ctx, req.(*VerifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Reveal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevealRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Reveal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Reveal",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Reveal(ctx, req.(*RevealRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Finalize_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FinalizeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Finalize(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Finalize",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Finalize(ctx, req.(*FinalizeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Refresh_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Refresh(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Refresh",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Refresh(ctx, req.(*RefreshRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_ApplyRefresh_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).ApplyRefresh(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/ApplyRefresh",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).ApplyRefresh(ctx, req.(*ClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Confirm_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Confirm(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Confirm",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Confirm(ctx, req.(*ClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Rollback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Rollback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Rollback",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Rollback(ctx, req.(*ClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Join_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JoinRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Join(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Join",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Join(ctx, req.(*JoinRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Reshare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReshareRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Reshare(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Reshare",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Reshare(ctx, req.(*ReshareRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Retire_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Retire(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Retire",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Retire(ctx, req.(*ClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_PublicShare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).PublicShare(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/PublicShare",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).PublicShare(ctx, req.(*ClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Commit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Commit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Commit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Commit(ctx, req.(*CommitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Ri_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RiRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Ri(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Ri",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Ri(ctx, req.(*RiRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Si_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SiRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Si(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Si",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Si(ctx, req.(*SiRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Hold_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HoldRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Hold(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Hold",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Hold(ctx, req.(*HoldRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Approve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApproveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Approve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Approve",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Approve(ctx, req.(*ApproveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Peer_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.Peer/Cancel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServer).Cancel(ctx, req.(*CancelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Peer_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "peer.Peer",
+	HandlerType: (*PeerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "BoxKey",
+			Handler:    _Peer_BoxKey_Handler,
+		},
+		{
+			MethodName: "Deal",
+			Handler:    _Peer_Deal_Handler,
+		},
+		{
+			MethodName: "Verify",
+			Handler:    _Peer_Verify_Handler,
+		},
+		{
+			MethodName: "Reveal",
+			Handler:    _Peer_Reveal_Handler,
+		},
+		{
+			MethodName: "Finalize",
+			Handler:    _Peer_Finalize_Handler,
+		},
+		{
+			MethodName: "Refresh",
+			Handler:    _Peer_Refresh_Handler,
+		},
+		{
+			MethodName: "ApplyRefresh",
+			Handler:    _Peer_ApplyRefresh_Handler,
+		},
+		{
+			MethodName: "Confirm",
+			Handler:    _Peer_Confirm_Handler,
+		},
+		{
+			MethodName: "Rollback",
+			Handler:    _Peer_Rollback_Handler,
+		},
+		{
+			MethodName: "Join",
+			Handler:    _Peer_Join_Handler,
+		},
+		{
+			MethodName: "Reshare",
+			Handler:    _Peer_Reshare_Handler,
+		},
+		{
+			MethodName: "Retire",
+			Handler:    _Peer_Retire_Handler,
+		},
+		{
+			MethodName: "PublicShare",
+			Handler:    _Peer_PublicShare_Handler,
+		},
+		{
+			MethodName: "Commit",
+			Handler:    _Peer_Commit_Handler,
+		},
+		{
+			MethodName: "Ri",
+			Handler:    _Peer_Ri_Handler,
+		},
+		{
+			MethodName: "Si",
+			Handler:    _Peer_Si_Handler,
+		},
+		{
+			MethodName: "Hold",
+			Handler:    _Peer_Hold_Handler,
+		},
+		{
+			MethodName: "Approve",
+			Handler:    _Peer_Approve_Handler,
+		},
+		{
+			MethodName: "Cancel",
+			Handler:    _Peer_Cancel_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "peer.proto",
+}
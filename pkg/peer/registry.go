@@ -0,0 +1,294 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/audit"
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+)
+
+// The registry keeps the committee of every client: the threshold, the index and the position among
+// the coordinator's peers of every member, and the commitments, the first one is the public key A.
+//
+// record: version || threshold || number of members || (index || position) per member || number of commitments || commitments
+
+const (
+	registryVersion   = 1
+	clientKeyPrefix   = "client/"
+	registryMaxMember = 1<<16 - 1
+)
+
+// LoadCoordinator returns a coordinator that keeps its committees in registry, any ShareStore
+// such as a FileStore, loading the ones stored before. The peers have to be in the same order.
+func LoadCoordinator(peers []Peer, registry ShareStore, opts ...Option) (Coordinator, error) {
+	c := NewCoordinator(peers, opts...).(*CoordinatorImpl)
+	if err := c.loadRegistry(registry); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadFrostCoordinator is LoadCoordinator for a FrostCoordinator
+func LoadFrostCoordinator(peers []FrostPeer, registry ShareStore, opts ...Option) (Coordinator, error) {
+	c := NewFrostCoordinator(peers, opts...).(*FrostCoordinator)
+	if err := c.loadRegistry(registry); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *CoordinatorImpl) loadRegistry(registry ShareStore) error {
+	values, err := registry.Load()
+	if err != nil {
+		return err
+	}
+	c.registry = registry
+	for key, value := range values {
+		if !strings.HasPrefix(key, clientKeyPrefix) {
+			return fmt.Errorf("unexpected key %s in registry", key)
+		}
+		cm, err := c.decodeCommittee(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		clientID := strings.TrimPrefix(key, clientKeyPrefix)
+		c.pubKeysEd[clientID] = cm.commitments[0]
+		c.committees[clientID] = cm
+	}
+	c.metrics.Clients(len(c.committees))
+	return nil
+}
+
+// setCommittee stores the committee of the client in the registry before it is used
+func (c *CoordinatorImpl) setCommittee(clientID string, cm committee) error {
+	if c.registry != nil {
+		record, err := c.encodeCommittee(cm)
+		if err != nil {
+			return err
+		}
+		if err := c.registry.Put(clientKeyPrefix+clientID, record); err != nil {
+			return fmt.Errorf("client id %s: registry: %v", clientID, err)
+		}
+	}
+
+	c.mux.Lock()
+	c.pubKeysEd[clientID] = cm.commitments[0]
+	c.committees[clientID] = cm
+	c.metrics.Clients(len(c.committees))
+	c.mux.Unlock()
+	return nil
+}
+
+// peerPosition returns the position of p among the coordinator's peers, -1 if it is not one of them
+func (c *CoordinatorImpl) peerPosition(p Peer) int {
+	for i, q := range c.peers {
+		if q == p {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *CoordinatorImpl) encodeCommittee(cm committee) ([]byte, error) {
+	if len(cm.members) > registryMaxMember || len(cm.commitments) > registryMaxMember {
+		return nil, fmt.Errorf("committee is too large")
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(registryVersion)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(cm.threshold))
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(cm.members)))
+	for _, m := range cm.members {
+		position := c.peerPosition(m.peer)
+		if position < 0 {
+			return nil, fmt.Errorf("member %d is not one of the coordinator's peers", m.index)
+		}
+		_ = binary.Write(&buf, binary.BigEndian, uint32(m.index))
+		_ = binary.Write(&buf, binary.BigEndian, uint32(position))
+	}
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(cm.commitments)))
+	buf.Write(encodeCommitments(cm.commitments))
+	return buf.Bytes(), nil
+}
+
+func (c *CoordinatorImpl) decodeCommittee(data []byte) (committee, error) {
+	var cm committee
+	r := bytes.NewReader(data)
+	version, err := r.ReadByte()
+	if err != nil {
+		return cm, err
+	}
+	if version != registryVersion {
+		return cm, fmt.Errorf("unknown registry record version %d", version)
+	}
+	var threshold, members, commitments uint16
+	if err := binary.Read(r, binary.BigEndian, &threshold); err != nil {
+		return cm, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &members); err != nil {
+		return cm, err
+	}
+	cm.threshold = int(threshold)
+	cm.members = make([]member, members)
+	for i := range cm.members {
+		var index, position uint32
+		if err := binary.Read(r, binary.BigEndian, &index); err != nil {
+			return cm, err
+		}
+		if err := binary.Read(r, binary.BigEndian, &position); err != nil {
+			return cm, err
+		}
+		if int(position) >= len(c.peers) {
+			return cm, fmt.Errorf("member %d is peer %d, have %d peers", index, position, len(c.peers))
+		}
+		cm.members[i] = member{peer: c.peers[position], index: int(index)}
+	}
+	if err := binary.Read(r, binary.BigEndian, &commitments); err != nil {
+		return cm, err
+	}
+	if commitments == 0 || int(commitments) != cm.threshold || r.Len() != 32*int(commitments) {
+		return cm, fmt.Errorf("expected %d commitments", cm.threshold)
+	}
+	cm.commitments = make([]cryptobase.ExtendedGroupElement, commitments)
+	for i := range cm.commitments {
+		var b [32]byte
+		_, _ = r.Read(b[:])
+		if !cm.commitments[i].FromBytes(&b) {
+			return cm, fmt.Errorf("commitment %d is not a valid point", i)
+		}
+	}
+	return cm, nil
+}
+
+func encodeCommitments(commitments []cryptobase.ExtendedGroupElement) []byte {
+	encoded := make([]byte, 32*len(commitments))
+	for i := range commitments {
+		var b [32]byte
+		commitments[i].ToBytes(&b)
+		copy(encoded[32*i:], b[:])
+	}
+	return encoded
+}
+
+// Recover rebuilds the committee of a client from the public shares of the coordinator's peers, for a client
+// lost from the registry. At least threshold peers have to hold shares consistent with the same commitments.
+// A committee that is in the registry has to match what the peers report, otherwise recovery fails.
+func (c *CoordinatorImpl) Recover(ctx context.Context, clientID string) (crypto.PublicKey, error) {
+	ctx, span := c.startOperation(ctx, "Recover", clientID)
+	start := time.Now()
+	pk, err := c.recoverKey(ctx, clientID)
+	c.metrics.Operation(audit.OpRecover, time.Since(start), err)
+	endSpan(span, err)
+	c.record(audit.Entry{Operation: audit.OpRecover, ClientID: clientID, Peers: c.committeeIndices(clientID, err)}, err)
+	return pk, err
+}
+
+func (c *CoordinatorImpl) recoverKey(ctx context.Context, clientID string) (crypto.PublicKey, error) {
+	var pk crypto.PublicKey
+
+	type publicShare struct {
+		position int
+		share    *PublicShare
+	}
+	shareCtx, cancelShare := c.phase(ctx)
+	defer cancelShare()
+	shareErrors := make(chan error, len(c.peers))
+	PP := make(chan publicShare, len(c.peers))
+	for i, p := range c.peers {
+		go func(i int, p Peer) {
+			callCtx, done := c.peerCall(shareCtx, i+1, p, "PublicShare")
+			share, err := p.PublicShare(callCtx, clientID)
+			done(err)
+			if err != nil {
+				shareErrors <- err
+				return
+			}
+			PP <- publicShare{i, share}
+		}(i, p)
+	}
+
+	// peers that don't hold a share, fail or don't respond in time are left out
+	groups := make(map[string][]publicShare)
+	var lastErr error
+collecting:
+	for range c.peers {
+		select {
+		case s := <-PP:
+			if len(s.share.Commitments) == 0 {
+				continue
+			}
+			Yi := evaluateCommitments(s.share.Commitments, s.share.Index)
+			if !geEqual(&Yi, &s.share.Yi) {
+				lastErr = &MisbehaviorError{Index: s.share.Index, Reason: "public share does not match its commitments"}
+				continue
+			}
+			key := string(encodeCommitments(s.share.Commitments))
+			groups[key] = append(groups[key], s)
+		case err := <-shareErrors:
+			lastErr = err
+		case <-shareCtx.Done():
+			if ctx.Err() != nil {
+				return pk, phaseError("public share", shareCtx)
+			}
+			break collecting
+		}
+	}
+
+	// the commitments at least threshold peers agree on, there can't be two such sets
+	var agreed []publicShare
+	for _, shares := range groups {
+		// a share counts once however many peers hold it
+		indices := make(map[int]bool, len(shares))
+		distinct := make([]publicShare, 0, len(shares))
+		for _, s := range shares {
+			if !indices[s.share.Index] {
+				indices[s.share.Index] = true
+				distinct = append(distinct, s)
+			}
+		}
+		if len(distinct) < len(shares[0].share.Commitments) {
+			continue
+		}
+		if agreed != nil {
+			return pk, fmt.Errorf("client id %s: peers hold two different keys", clientID)
+		}
+		agreed = distinct
+	}
+	sort.Slice(agreed, func(i, j int) bool { return agreed[i].share.Index < agreed[j].share.Index })
+	if agreed == nil {
+		return pk, fmt.Errorf("client id %s: no threshold of peers agrees on a key, last error: %v", clientID, lastErr)
+	}
+	commitments := agreed[0].share.Commitments
+
+	c.mux.RLock()
+	cm, registered := c.committees[clientID]
+	c.mux.RUnlock()
+	if registered {
+		if !bytes.Equal(encodeCommitments(cm.commitments), encodeCommitments(commitments)) {
+			return pk, fmt.Errorf("client id %s: peers disagree with the registry", clientID)
+		}
+		for _, s := range agreed {
+			for _, m := range cm.members {
+				if m.peer == c.peers[s.position] && m.index != s.share.Index {
+					return pk, fmt.Errorf("client id %s: peer %d has index %d, registry has %d", clientID, s.position, s.share.Index, m.index)
+				}
+			}
+		}
+		return curvePKFromEdPK(&cm.commitments[0]), nil
+	}
+
+	members := make([]member, len(agreed))
+	for i, s := range agreed {
+		members[i] = member{peer: c.peers[s.position], index: s.share.Index}
+	}
+	if err := c.setCommittee(clientID, committee{threshold: len(commitments), members: members, commitments: commitments}); err != nil {
+		return pk, err
+	}
+	return curvePKFromEdPK(&commitments[0]), nil
+}
@@ -0,0 +1,167 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+)
+
+func TestCoordinatorRestart(t *testing.T) {
+	registry, err := NewFileStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []Peer{NewLocalPeer(), NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	c, err := LoadCoordinator(peers, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if err := c.Refresh(context.Background(), "client"); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if err := c.Reshare(context.Background(), "client", []Peer{peers[3], peers[1], peers[2]}, 3); err != nil {
+		t.Fatalf("reshare failed: %v", err)
+	}
+
+	restarted, err := LoadCoordinator(peers, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restartedPK, ok := restarted.GetPublicKey("client"); !ok || restartedPK != pk {
+		t.Errorf("public key lost on restart")
+	}
+	message := []byte("restart")
+	sig, err := restarted.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+
+	// the registry agrees with the peers
+	if recovered, err := restarted.(*CoordinatorImpl).Recover(context.Background(), "client"); err != nil || recovered != pk {
+		t.Errorf("recover failed: %v", err)
+	}
+}
+
+func TestRecoverLostRegistry(t *testing.T) {
+	peers := []Peer{NewLocalPeer(), NewLocalPeer(), NewLocalPeer()}
+	pk, err := NewCoordinator(peers).Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	registry, err := NewFileStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadCoordinator(peers, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Sign(context.Background(), "client", []byte("lost")); !errors.Is(err, ErrUnknownClient) {
+		t.Errorf("expected an unknown client, got %v", err)
+	}
+
+	// one peer is offline, the other two are a threshold
+	c.(*CoordinatorImpl).peers[0] = absentPeer{peers[0]}
+	recovered, err := c.(*CoordinatorImpl).Recover(context.Background(), "client")
+	if err != nil {
+		t.Fatalf("recover failed: %v", err)
+	}
+	if recovered != pk {
+		t.Errorf("recovered a different public key")
+	}
+	message := []byte("recovered")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+
+	// the recovered committee is in the registry
+	restarted, err := LoadCoordinator(c.(*CoordinatorImpl).peers, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restartedPK, ok := restarted.GetPublicKey("client"); !ok || restartedPK != pk {
+		t.Errorf("recovered key is not in the registry")
+	}
+}
+
+// absentPeer doesn't answer for its public share
+type absentPeer struct {
+	Peer
+}
+
+func (p absentPeer) PublicShare(ctx context.Context, clientID string) (*PublicShare, error) {
+	return nil, errors.New("peer is offline")
+}
+
+func TestRecoverDetectsMismatch(t *testing.T) {
+	registry, err := NewFileStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []Peer{NewLocalPeer(), NewLocalPeer()}
+	c, err := LoadCoordinator(peers, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, clientID := range []string{"vasya", "petya"} {
+		if _, err := c.Keygen(context.Background(), clientID, 2, 2); err != nil {
+			t.Fatalf("keygen failed: %v", err)
+		}
+	}
+	if _, err := c.(*CoordinatorImpl).Recover(context.Background(), "nobody"); err == nil {
+		t.Errorf("recovered a client no peer has")
+	}
+
+	// the registry entry of vasya is replaced with the one of petya
+	values, err := registry.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Put(clientKeyPrefix+"vasya", values[clientKeyPrefix+"petya"]); err != nil {
+		t.Fatal(err)
+	}
+	tampered, err := LoadCoordinator(peers, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tampered.(*CoordinatorImpl).Recover(context.Background(), "vasya"); err == nil {
+		t.Errorf("recover accepted a registry that doesn't match the peers")
+	}
+}
+
+func TestRegistryNeedsKnownPeers(t *testing.T) {
+	registry, err := NewFileStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []Peer{NewLocalPeer(), NewLocalPeer()}
+	c, err := LoadCoordinator(peers, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if err := c.Reshare(context.Background(), "client", []Peer{peers[0], NewLocalPeer()}, 2); !errors.Is(err, ErrInvalidParameters) {
+		t.Errorf("expected reshare to an unknown peer to fail, got %v", err)
+	}
+
+	// a coordinator with one peer can't load a committee of two
+	if _, err := LoadCoordinator(peers[:1], registry); err == nil {
+		t.Errorf("loaded a registry with more peers than the coordinator has")
+	}
+}
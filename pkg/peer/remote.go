@@ -0,0 +1,470 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+	"github.com/dvshur/distributed-signature/pkg/peer/peerpb"
+	"github.com/dvshur/distributed-signature/pkg/pki"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// RemotePeer is a Peer served by another process over gRPC, see NewPeerServer
+type RemotePeer struct {
+	client peerpb.PeerClient
+	name   string
+	// conn is closed by Close for peers dialed by DialRemotePeers
+	conn io.Closer
+}
+
+// NewRemotePeer returns a peer calling the service on conn, the caller closes conn.
+// The name is the one the peer's certificate was issued to, the coordinator's metrics are labelled with it
+func NewRemotePeer(conn grpc.ClientConnInterface, name string) *RemotePeer {
+	return &RemotePeer{client: peerpb.NewPeerClient(conn), name: name}
+}
+
+// DialRemotePeers connects to every name@address over mutual TLS with the coordinator's certificate and key,
+// a peer has to present a certificate of the CA issued to its name. Close the peers when done.
+func DialRemotePeers(addrs []string, caFile, certFile, keyFile string) ([]*RemotePeer, error) {
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]*RemotePeer, 0, len(addrs))
+	closeAll := func() {
+		for _, p := range peers {
+			_ = p.Close()
+		}
+	}
+	for _, addr := range addrs {
+		parts := strings.SplitN(addr, "@", 2)
+		if len(parts) != 2 {
+			closeAll()
+			return nil, fmt.Errorf("peer %s is not name@address", addr)
+		}
+		config, err := pki.ClientConfig(caPEM, certPEM, keyPEM, parts[0])
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		conn, err := grpc.Dial(parts[1], grpc.WithTransportCredentials(credentials.NewTLS(config)), TraceDialOption())
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		p := NewRemotePeer(conn, parts[0])
+		p.conn = conn
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// Name ..
+func (p *RemotePeer) Name() string {
+	return p.name
+}
+
+// Close closes the connection of a peer dialed by DialRemotePeers, the caller of NewRemotePeer closes its own conn
+func (p *RemotePeer) Close() error {
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
+
+// BoxKey ..
+func (p *RemotePeer) BoxKey(ctx context.Context) (*[32]byte, error) {
+	resp, err := p.client.BoxKey(ctx, &peerpb.Empty{})
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	var key [32]byte
+	if len(resp.Key) != len(key) {
+		return nil, fmt.Errorf("invalid box key length %d", len(resp.Key))
+	}
+	copy(key[:], resp.Key)
+	return &key, nil
+}
+
+// Deal ..
+func (p *RemotePeer) Deal(ctx context.Context, clientID string, index int, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	d, err := p.client.Deal(ctx, &peerpb.DealRequest{
+		ClientId:     clientID,
+		Index:        int32(index),
+		Threshold:    int32(threshold),
+		Participants: encodeIndices(participants),
+		Keys:         encodeKeys(keys),
+	})
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return decodeDealing(d)
+}
+
+// Verify ..
+func (p *RemotePeer) Verify(ctx context.Context, clientID string, shares map[int]DealtShare) ([]int, error) {
+	req := &peerpb.VerifyRequest{ClientId: clientID, Shares: make(map[int32]*peerpb.DealtShare, len(shares))}
+	for j, s := range shares {
+		s := s
+		req.Shares[int32(j)] = &peerpb.DealtShare{Commitments: encodePoints(s.Commitments), SealedShare: s.Sealed}
+	}
+	resp, err := p.client.Verify(ctx, req)
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return decodeIndices(resp.Accused), nil
+}
+
+// Reveal ..
+func (p *RemotePeer) Reveal(ctx context.Context, clientID string, accusers []int) (map[int][32]byte, error) {
+	resp, err := p.client.Reveal(ctx, &peerpb.RevealRequest{ClientId: clientID, Accusers: encodeIndices(accusers)})
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return decodeScalars(resp.Shares)
+}
+
+// Finalize ..
+func (p *RemotePeer) Finalize(ctx context.Context, clientID string, qualified []int, revealed map[int][32]byte) (*cryptobase.ExtendedGroupElement, error) {
+	resp, err := p.client.Finalize(ctx, &peerpb.FinalizeRequest{
+		ClientId:  clientID,
+		Qualified: encodeIndices(qualified),
+		Revealed:  encodeScalars(revealed),
+	})
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return decodePoint(resp.Point)
+}
+
+// Refresh ..
+func (p *RemotePeer) Refresh(ctx context.Context, clientID string, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	d, err := p.client.Refresh(ctx, &peerpb.RefreshRequest{
+		ClientId:     clientID,
+		Participants: encodeIndices(participants),
+		Keys:         encodeKeys(keys),
+	})
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return decodeDealing(d)
+}
+
+// ApplyRefresh ..
+func (p *RemotePeer) ApplyRefresh(ctx context.Context, clientID string) error {
+	_, err := p.client.ApplyRefresh(ctx, &peerpb.ClientRequest{ClientId: clientID})
+	return remoteError(err)
+}
+
+// Confirm ..
+func (p *RemotePeer) Confirm(ctx context.Context, clientID string) error {
+	_, err := p.client.Confirm(ctx, &peerpb.ClientRequest{ClientId: clientID})
+	return remoteError(err)
+}
+
+// Rollback ..
+func (p *RemotePeer) Rollback(ctx context.Context, clientID string) error {
+	_, err := p.client.Rollback(ctx, &peerpb.ClientRequest{ClientId: clientID})
+	return remoteError(err)
+}
+
+// Join ..
+func (p *RemotePeer) Join(ctx context.Context, clientID string, index int, threshold int) error {
+	_, err := p.client.Join(ctx, &peerpb.JoinRequest{ClientId: clientID, Index: int32(index), Threshold: int32(threshold)})
+	return remoteError(err)
+}
+
+// Reshare ..
+func (p *RemotePeer) Reshare(ctx context.Context, clientID string, threshold int, participants []int, keys map[int][32]byte) (*Dealing, error) {
+	d, err := p.client.Reshare(ctx, &peerpb.ReshareRequest{
+		ClientId:     clientID,
+		Threshold:    int32(threshold),
+		Participants: encodeIndices(participants),
+		Keys:         encodeKeys(keys),
+	})
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return decodeDealing(d)
+}
+
+// Retire ..
+func (p *RemotePeer) Retire(ctx context.Context, clientID string) error {
+	_, err := p.client.Retire(ctx, &peerpb.ClientRequest{ClientId: clientID})
+	return remoteError(err)
+}
+
+// PublicShare ..
+func (p *RemotePeer) PublicShare(ctx context.Context, clientID string) (*PublicShare, error) {
+	resp, err := p.client.PublicShare(ctx, &peerpb.ClientRequest{ClientId: clientID})
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	Yi, err := decodePoint(resp.Yi)
+	if err != nil {
+		return nil, err
+	}
+	commitments, err := decodePoints(resp.Commitments)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicShare{Index: int(resp.Index), Yi: *Yi, Commitments: commitments}, nil
+}
+
+// Commit ..
+func (p *RemotePeer) Commit(ctx context.Context, clientID string, sessionID string, message []byte) (crypto.Digest, error) {
+	var commitment crypto.Digest
+	resp, err := p.client.Commit(ctx, &peerpb.CommitRequest{ClientId: clientID, SessionId: sessionID, Message: message})
+	if err != nil {
+		return commitment, remoteError(err)
+	}
+	if len(resp.Commitment) != len(commitment) {
+		return commitment, fmt.Errorf("invalid commitment length %d", len(resp.Commitment))
+	}
+	copy(commitment[:], resp.Commitment)
+	return commitment, nil
+}
+
+// Ri ..
+func (p *RemotePeer) Ri(ctx context.Context, clientID string, sessionID string, commitments map[int]crypto.Digest) (*cryptobase.ExtendedGroupElement, error) {
+	req := &peerpb.RiRequest{ClientId: clientID, SessionId: sessionID, Commitments: make(map[int32][]byte, len(commitments))}
+	for j, c := range commitments {
+		c := c
+		req.Commitments[int32(j)] = c[:]
+	}
+	resp, err := p.client.Ri(ctx, req)
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return decodePoint(resp.Point)
+}
+
+// Si ..
+func (p *RemotePeer) Si(ctx context.Context, clientID string, sessionID string, nonces map[int]cryptobase.ExtendedGroupElement, message []byte) (*[32]byte, error) {
+	req := &peerpb.SiRequest{ClientId: clientID, SessionId: sessionID, Nonces: make(map[int32][]byte, len(nonces)), Message: message}
+	for j, R := range nonces {
+		req.Nonces[int32(j)] = encodePoint(&R)
+	}
+	resp, err := p.client.Si(ctx, req)
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	s, err := decodeScalar(resp.Scalar)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Hold ..
+func (p *RemotePeer) Hold(ctx context.Context, req *SigningRequest) error {
+	_, err := p.client.Hold(ctx, &peerpb.HoldRequest{
+		RequestId: req.ID,
+		ClientId:  req.ClientID,
+		Message:   req.Message,
+		Expires:   req.Expires.Unix(),
+	})
+	return remoteError(err)
+}
+
+// Approve ..
+func (p *RemotePeer) Approve(ctx context.Context, clientID string, requestID string, approval Approval) (bool, error) {
+	resp, err := p.client.Approve(ctx, &peerpb.ApproveRequest{
+		ClientId:  clientID,
+		RequestId: requestID,
+		Approver:  approval.Approver[:],
+		Signature: approval.Signature[:],
+	})
+	if err != nil {
+		return false, remoteError(err)
+	}
+	return resp.Approved, nil
+}
+
+// Cancel ..
+func (p *RemotePeer) Cancel(ctx context.Context, clientID string, requestID string) error {
+	_, err := p.client.Cancel(ctx, &peerpb.CancelRequest{ClientId: clientID, RequestId: requestID})
+	return remoteError(err)
+}
+
+// remoteError strips the gRPC status from an error returned by the peer, a policy violation is returned as is
+func remoteError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if st, ok := status.FromError(err); ok {
+		for _, detail := range st.Details() {
+			if v, ok := detail.(*peerpb.PolicyViolation); ok {
+				return &policy.Violation{ClientID: v.ClientId, Rule: v.Rule, Reason: v.Reason}
+			}
+		}
+		return errors.New(st.Message())
+	}
+	return err
+}
+
+func encodeIndices(indices []int) []int32 {
+	res := make([]int32, len(indices))
+	for i, j := range indices {
+		res[i] = int32(j)
+	}
+	return res
+}
+
+func decodeIndices(indices []int32) []int {
+	res := make([]int, len(indices))
+	for i, j := range indices {
+		res[i] = int(j)
+	}
+	return res
+}
+
+func encodePoint(p *cryptobase.ExtendedGroupElement) []byte {
+	var b [32]byte
+	p.ToBytes(&b)
+	return b[:]
+}
+
+func decodePoint(b []byte) (*cryptobase.ExtendedGroupElement, error) {
+	var encoded [32]byte
+	if len(b) != len(encoded) {
+		return nil, fmt.Errorf("invalid point length %d", len(b))
+	}
+	copy(encoded[:], b)
+	var p cryptobase.ExtendedGroupElement
+	if !p.FromBytes(&encoded) {
+		return nil, fmt.Errorf("invalid point encoding")
+	}
+	return &p, nil
+}
+
+func encodePoints(points []cryptobase.ExtendedGroupElement) [][]byte {
+	res := make([][]byte, len(points))
+	for i := range points {
+		res[i] = encodePoint(&points[i])
+	}
+	return res
+}
+
+func decodePoints(encoded [][]byte) ([]cryptobase.ExtendedGroupElement, error) {
+	res := make([]cryptobase.ExtendedGroupElement, len(encoded))
+	for i, b := range encoded {
+		p, err := decodePoint(b)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = *p
+	}
+	return res, nil
+}
+
+func decodeScalar(b []byte) ([32]byte, error) {
+	var s [32]byte
+	if len(b) != len(s) {
+		return s, fmt.Errorf("invalid scalar length %d", len(b))
+	}
+	copy(s[:], b)
+	if !cryptobase.ScMinimal(&s) {
+		return s, fmt.Errorf("non-canonical scalar")
+	}
+	return s, nil
+}
+
+func encodeScalars(scalars map[int][32]byte) map[int32][]byte {
+	res := make(map[int32][]byte, len(scalars))
+	for j, s := range scalars {
+		s := s
+		res[int32(j)] = s[:]
+	}
+	return res
+}
+
+func decodeScalars(encoded map[int32][]byte) (map[int][32]byte, error) {
+	res := make(map[int][32]byte, len(encoded))
+	for j, b := range encoded {
+		s, err := decodeScalar(b)
+		if err != nil {
+			return nil, err
+		}
+		res[int(j)] = s
+	}
+	return res, nil
+}
+
+func encodeKeys(keys map[int][32]byte) map[int32][]byte {
+	res := make(map[int32][]byte, len(keys))
+	for j, key := range keys {
+		key := key
+		res[int32(j)] = key[:]
+	}
+	return res
+}
+
+func decodeKeys(encoded map[int32][]byte) (map[int][32]byte, error) {
+	res := make(map[int][32]byte, len(encoded))
+	for j, b := range encoded {
+		var key [32]byte
+		if len(b) != len(key) {
+			return nil, fmt.Errorf("invalid box key length %d", len(b))
+		}
+		copy(key[:], b)
+		res[int(j)] = key
+	}
+	return res, nil
+}
+
+func encodeDealing(d *Dealing) *peerpb.Dealing {
+	encoded := &peerpb.Dealing{
+		Commitments:  encodePoints(d.Commitments),
+		SealedShares: make(map[int32][]byte, len(d.Sealed)),
+	}
+	for j, sealed := range d.Sealed {
+		encoded.SealedShares[int32(j)] = sealed
+	}
+	// refresh and reshare dealings come without a proof
+	if d.Proof != (Proof{}) {
+		encoded.Proof = &peerpb.Proof{R: encodePoint(&d.Proof.R), Z: d.Proof.Z[:]}
+	}
+	return encoded
+}
+
+func decodeDealing(encoded *peerpb.Dealing) (*Dealing, error) {
+	var d Dealing
+	var err error
+	if d.Commitments, err = decodePoints(encoded.Commitments); err != nil {
+		return nil, err
+	}
+	if encoded.Proof != nil {
+		R, err := decodePoint(encoded.Proof.R)
+		if err != nil {
+			return nil, err
+		}
+		d.Proof.R = *R
+		if d.Proof.Z, err = decodeScalar(encoded.Proof.Z); err != nil {
+			return nil, err
+		}
+	}
+	d.Sealed = make(map[int][]byte, len(encoded.SealedShares))
+	for j, sealed := range encoded.SealedShares {
+		d.Sealed[int(j)] = sealed
+	}
+	return &d, nil
+}
@@ -0,0 +1,255 @@
+package peer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/peer/peerpb"
+	"github.com/dvshur/distributed-signature/pkg/pki"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// servePeer serves p in memory and returns a remote peer connected to it
+func servePeer(t *testing.T, p Peer, opts ...grpc.ServerOption) *RemotePeer {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(opts...)
+	peerpb.RegisterPeerServer(server, NewPeerServer(p))
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	dial := func(ctx context.Context, _ string) (net.Conn, error) { return listener.Dial() }
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dial), grpc.WithInsecure(), TraceDialOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return NewRemotePeer(conn, p.Name())
+}
+
+func TestRemotePeers(t *testing.T) {
+	peers := make([]Peer, 4)
+	for i := range peers {
+		peers[i] = servePeer(t, NewLocalPeer())
+	}
+	c := NewCoordinator(peers[:3])
+
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if err := c.Refresh(context.Background(), "client"); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if err := c.Reshare(context.Background(), "client", peers[1:], 2); err != nil {
+		t.Fatalf("reshare failed: %v", err)
+	}
+
+	message := []byte("remote")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+
+	// a new coordinator recovers the key from the public shares
+	recovered, err := NewCoordinator(peers[1:]).(*CoordinatorImpl).Recover(context.Background(), "client")
+	if err != nil {
+		t.Fatalf("recover failed: %v", err)
+	}
+	if recovered != pk {
+		t.Errorf("recovered a different public key")
+	}
+}
+
+func TestRemotePeerRelaysErrors(t *testing.T) {
+	p := servePeer(t, NewLocalPeer())
+	_, err := p.Commit(context.Background(), "unknown", "session", []byte("message"))
+	if err == nil || err.Error() != "client id unknown does not exist" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRemotePolicyViolation(t *testing.T) {
+	pol, err := policy.Parse([]byte(`{"default": {"hours": []}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []Peer{servePeer(t, NewLocalPeer(WithPolicy(pol))), servePeer(t, NewLocalPeer())}
+	c := NewCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	// the violation comes back from the peer's server as the same error
+	_, err = c.Sign(context.Background(), "client", []byte("message"))
+	var violation *policy.Violation
+	if !errors.As(err, &violation) || violation.ClientID != "client" || violation.Rule != policy.RuleHours {
+		t.Errorf("expected a violation of %s, got %v", policy.RuleHours, err)
+	}
+}
+
+// serveTLS serves p on a loopback port with config and returns the address
+func serveTLS(t *testing.T, p Peer, config *tls.Config) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(config)))
+	peerpb.RegisterPeerServer(server, NewPeerServer(p))
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func dialTLS(t *testing.T, addr string, config *tls.Config) *RemotePeer {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return NewRemotePeer(conn, config.ServerName)
+}
+
+func issue(t *testing.T, ca *pki.Authority, name string) (certPEM, keyPEM []byte) {
+	certPEM, keyPEM, err := ca.Issue(name, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPEM, keyPEM
+}
+
+func TestRemotePeersOverMutualTLS(t *testing.T) {
+	ca, err := pki.NewAuthority("test ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, _, err := ca.PEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	coordinatorCert, coordinatorKey := issue(t, ca, "coordinator")
+
+	names := []string{"peer1", "peer2", "peer3"}
+	addrs := make([]string, len(names))
+	peers := make([]Peer, len(names))
+	for i, name := range names {
+		certPEM, keyPEM := issue(t, ca, name)
+		serverConfig, err := pki.ServerConfig(caPEM, certPEM, keyPEM, []string{"coordinator"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs[i] = serveTLS(t, NewLocalPeer(), serverConfig)
+
+		clientConfig, err := pki.ClientConfig(caPEM, coordinatorCert, coordinatorKey, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peers[i] = dialTLS(t, addrs[i], clientConfig)
+	}
+
+	c := NewCoordinator(peers)
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	message := []byte("mtls")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+
+	// a peer's certificate doesn't let it call other peers
+	peerCert, peerKey := issue(t, ca, "peer2")
+	config, _ := pki.ClientConfig(caPEM, peerCert, peerKey, "peer1")
+	if _, err := dialTLS(t, addrs[0], config).Commit(context.Background(), "client", "session", message); err == nil {
+		t.Errorf("peer accepted a call from another peer")
+	}
+
+	// a certificate issued to the coordinator's name by another CA is not trusted
+	rogue, err := pki.NewAuthority("rogue ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rogueCert, rogueKey := issue(t, rogue, "coordinator")
+	config, _ = pki.ClientConfig(caPEM, rogueCert, rogueKey, "peer1")
+	if _, err := dialTLS(t, addrs[0], config).Commit(context.Background(), "client", "session", message); err == nil {
+		t.Errorf("peer accepted a certificate of another CA")
+	}
+
+	// the coordinator pins every peer's name, peer2 can't pose as peer1
+	config, _ = pki.ClientConfig(caPEM, coordinatorCert, coordinatorKey, "peer1")
+	if _, err := dialTLS(t, addrs[1], config).Commit(context.Background(), "client", "session", message); err == nil {
+		t.Errorf("coordinator accepted a peer with another name")
+	}
+}
+
+func TestDialRemotePeers(t *testing.T) {
+	ca, err := pki.NewAuthority("test ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, _, err := ca.PEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := tempDir(t)
+	coordinatorCert, coordinatorKey := issue(t, ca, "coordinator")
+	files := map[string][]byte{"ca.pem": caPEM, "coordinator.pem": coordinatorCert, "coordinator-key.pem": coordinatorKey}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var addrs []string
+	for _, name := range []string{"peer1", "peer2"} {
+		certPEM, keyPEM := issue(t, ca, name)
+		serverConfig, err := pki.ServerConfig(caPEM, certPEM, keyPEM, []string{"coordinator"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, name+"@"+serveTLS(t, NewLocalPeer(), serverConfig))
+	}
+
+	dial := func(addrs []string) ([]*RemotePeer, error) {
+		return DialRemotePeers(addrs, filepath.Join(dir, "ca.pem"), filepath.Join(dir, "coordinator.pem"), filepath.Join(dir, "coordinator-key.pem"))
+	}
+	remotes, err := dial(addrs)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	peers := make([]Peer, len(remotes))
+	for i, p := range remotes {
+		defer p.Close()
+		peers[i] = p
+	}
+	if remotes[0].Name() != "peer1" || remotes[1].Name() != "peer2" {
+		t.Errorf("peers are named %s and %s", remotes[0].Name(), remotes[1].Name())
+	}
+	c := NewCoordinator(peers)
+	if _, err := c.Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if _, err := c.Sign(context.Background(), "client", []byte("dialed")); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	if _, err := dial([]string{addrs[0], "peer2"}); err == nil {
+		t.Errorf("dialed a peer without a name")
+	}
+}
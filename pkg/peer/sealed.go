@@ -0,0 +1,271 @@
+package peer
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Values of a SealedStore are encrypted with XChaCha20-Poly1305 under a random data key,
+// the data key is kept in the same store encrypted under a key derived from the operator's
+// passphrase with Argon2id. Changing the passphrase re-encrypts only the data key.
+//
+// data key record: version || time || memory || threads || salt || nonce || sealed data key
+// value:           version || nonce || sealed value, the store key is authenticated with it
+
+const (
+	sealedVersion = 1
+	// sealedKeyName holds the data key, Load doesn't return it
+	sealedKeyName = "sealed/key"
+	saltSize      = 16
+	tagSize       = 16
+	// maxKDFMemory bounds the memory in KiB a data key record can ask for
+	maxKDFMemory = 4 * 1024 * 1024
+)
+
+// kdfParams are the Argon2id parameters of a passphrase, stored with the data key
+type kdfParams struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// defaultKDFParams follow the second recommendation of RFC 9106
+var defaultKDFParams = kdfParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// SealedStore encrypts the values of another ShareStore
+type SealedStore struct {
+	store   ShareStore
+	dataKey []byte
+	aead    cipher.AEAD
+}
+
+// OpenSealedStore unlocks store with the passphrase, an empty store gets a new random data key.
+// It fails if the passphrase is wrong or the store has values but no data key.
+func OpenSealedStore(store ShareStore, passphrase []byte) (*SealedStore, error) {
+	values, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	record, ok := values[sealedKeyName]
+	if !ok {
+		if len(values) > 0 {
+			return nil, fmt.Errorf("store has %d values but no data key, seal it first", len(values))
+		}
+		return newSealedStore(store, passphrase)
+	}
+	dataKey, err := openDataKey(record, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return sealedStoreWithKey(store, dataKey)
+}
+
+// ReadPassphrase reads the passphrase a store is sealed with from a file, or from the environment variable env
+// if no file is given
+func ReadPassphrase(file, env string) ([]byte, error) {
+	if file == "" {
+		passphrase := os.Getenv(env)
+		if passphrase == "" {
+			return nil, fmt.Errorf("no passphrase, set a passphrase file or $%s", env)
+		}
+		return []byte(passphrase), nil
+	}
+	passphrase, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(passphrase, "\r\n"), nil
+}
+
+// SealStore encrypts the plaintext values of store under a new data key,
+// it can be run again with the same passphrase if it was interrupted
+func SealStore(store ShareStore, passphrase []byte) (*SealedStore, error) {
+	values, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	var s *SealedStore
+	if record, ok := values[sealedKeyName]; ok {
+		dataKey, err := openDataKey(record, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		s, err = sealedStoreWithKey(store, dataKey)
+		if err != nil {
+			return nil, err
+		}
+	} else if s, err = newSealedStore(store, passphrase); err != nil {
+		return nil, err
+	}
+
+	for key, value := range values {
+		if key == sealedKeyName {
+			continue
+		}
+		if _, err := s.open(key, value); err == nil {
+			continue
+		}
+		if err := s.Put(key, value); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Load decrypts all values, a value that fails authentication is an error
+func (s *SealedStore) Load() (map[string][]byte, error) {
+	values, err := s.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	delete(values, sealedKeyName)
+	for key, value := range values {
+		if values[key], err = s.open(key, value); err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return values, nil
+}
+
+// Put encrypts value under a fresh nonce
+func (s *SealedStore) Put(key string, value []byte) error {
+	if key == sealedKeyName {
+		return fmt.Errorf("key %s is reserved", key)
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := append([]byte{sealedVersion}, nonce...)
+	sealed = s.aead.Seal(sealed, nonce, value, valueAD(key))
+	return s.store.Put(key, sealed)
+}
+
+// Delete ..
+func (s *SealedStore) Delete(key string) error {
+	if key == sealedKeyName {
+		return fmt.Errorf("key %s is reserved", key)
+	}
+	return s.store.Delete(key)
+}
+
+// Rotate encrypts the data key under a new passphrase, the values are not touched
+func (s *SealedStore) Rotate(passphrase []byte) error {
+	record, err := sealDataKey(s.dataKey, passphrase, defaultKDFParams)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(sealedKeyName, record)
+}
+
+func (s *SealedStore) open(key string, sealed []byte) ([]byte, error) {
+	if len(sealed) < 1+chacha20poly1305.NonceSizeX {
+		return nil, fmt.Errorf("sealed value is too short")
+	}
+	if sealed[0] != sealedVersion {
+		return nil, fmt.Errorf("unknown sealed value version %d", sealed[0])
+	}
+	nonce := sealed[1 : 1+chacha20poly1305.NonceSizeX]
+	value, err := s.aead.Open(nil, nonce, sealed[1+chacha20poly1305.NonceSizeX:], valueAD(key))
+	if err != nil {
+		return nil, fmt.Errorf("sealed value failed authentication")
+	}
+	return value, nil
+}
+
+// valueAD binds a sealed value to its key so values can't be swapped
+func valueAD(key string) []byte {
+	return append([]byte{sealedVersion}, key...)
+}
+
+func newSealedStore(store ShareStore, passphrase []byte) (*SealedStore, error) {
+	dataKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	s, err := sealedStoreWithKey(store, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Rotate(passphrase); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func sealedStoreWithKey(store ShareStore, dataKey []byte) (*SealedStore, error) {
+	aead, err := chacha20poly1305.NewX(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &SealedStore{store: store, dataKey: dataKey, aead: aead}, nil
+}
+
+// sealDataKey encrypts the data key under a key derived from the passphrase with a new salt
+func sealDataKey(dataKey, passphrase []byte, params kdfParams) ([]byte, error) {
+	header := make([]byte, 1+4+4+1+saltSize)
+	header[0] = sealedVersion
+	binary.BigEndian.PutUint32(header[1:], params.Time)
+	binary.BigEndian.PutUint32(header[5:], params.Memory)
+	header[9] = params.Threads
+	if _, err := rand.Read(header[10:]); err != nil {
+		return nil, err
+	}
+	aead, err := passphraseKey(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	record := append(append([]byte{}, header...), nonce...)
+	return aead.Seal(record, nonce, dataKey, header), nil
+}
+
+// openDataKey decrypts the data key, the passphrase is wrong if authentication fails
+func openDataKey(record, passphrase []byte) ([]byte, error) {
+	headerSize := 1 + 4 + 4 + 1 + saltSize
+	if len(record) != headerSize+chacha20poly1305.NonceSizeX+chacha20poly1305.KeySize+tagSize {
+		return nil, fmt.Errorf("data key record has %d bytes", len(record))
+	}
+	if record[0] != sealedVersion {
+		return nil, fmt.Errorf("unknown data key version %d", record[0])
+	}
+	header := record[:headerSize]
+	aead, err := passphraseKey(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+	nonce := record[headerSize : headerSize+chacha20poly1305.NonceSizeX]
+	dataKey, err := aead.Open(nil, nonce, record[headerSize+chacha20poly1305.NonceSizeX:], header)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return dataKey, nil
+}
+
+// passphraseKey derives the key encryption key with the parameters and the salt of the header
+func passphraseKey(passphrase, header []byte) (cipher.AEAD, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	params := kdfParams{
+		Time:    binary.BigEndian.Uint32(header[1:]),
+		Memory:  binary.BigEndian.Uint32(header[5:]),
+		Threads: header[9],
+	}
+	if params.Time == 0 || params.Memory == 0 || params.Memory > maxKDFMemory || params.Threads == 0 {
+		return nil, fmt.Errorf("invalid key derivation parameters %+v", params)
+	}
+	kek := argon2.IDKey(passphrase, header[10:], params.Time, params.Memory, params.Threads, chacha20poly1305.KeySize)
+	return chacha20poly1305.NewX(kek)
+}
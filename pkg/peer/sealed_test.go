@@ -0,0 +1,201 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fastKDF makes passphrase derivation cheap for the duration of a test
+func fastKDF(t *testing.T) {
+	params := defaultKDFParams
+	defaultKDFParams = kdfParams{Time: 1, Memory: 64, Threads: 1}
+	t.Cleanup(func() { defaultKDFParams = params })
+}
+
+func TestSealedStore(t *testing.T) {
+	fastKDF(t)
+	dir := tempDir(t)
+	files, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := OpenSealedStore(files, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret share of vasya")
+	if err := s.Put("share/vasya", secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("share/petya", []byte("secret share of petya")); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(files.path("share/vasya"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, secret) {
+		t.Errorf("value is stored in plaintext")
+	}
+
+	reopened, err := OpenSealedStore(files, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := reopened.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || !bytes.Equal(values["share/vasya"], secret) {
+		t.Errorf("loaded %q", values)
+	}
+
+	if _, err := OpenSealedStore(files, []byte("wrong horse")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("opened with a wrong passphrase: %v", err)
+	}
+	if _, err := OpenSealedStore(files, nil); err == nil {
+		t.Errorf("opened with an empty passphrase")
+	}
+
+	// a value moved to another key fails authentication
+	if err := files.Put("share/petya", raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Load(); err == nil {
+		t.Errorf("loaded a value stored under another key")
+	}
+}
+
+func TestSealedStoreRotate(t *testing.T) {
+	fastKDF(t)
+	files, err := NewFileStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenSealedStore(files, []byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("share/vasya", []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rotate([]byte("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenSealedStore(files, []byte("old")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("opened with the old passphrase: %v", err)
+	}
+	rotated, err := OpenSealedStore(files, []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := rotated.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(values["share/vasya"], []byte{1, 2, 3}) {
+		t.Errorf("loaded %v", values)
+	}
+}
+
+func TestSealStore(t *testing.T) {
+	fastKDF(t)
+	dir := tempDir(t)
+	files, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := files.Put("share/vasya", []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenSealedStore(files, []byte("passphrase")); err == nil {
+		t.Errorf("opened a plaintext store")
+	}
+	if _, err := SealStore(files, []byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	// sealing again doesn't encrypt twice
+	if _, err := SealStore(files, []byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SealStore(files, []byte("other")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("sealed with another passphrase: %v", err)
+	}
+
+	s, err := OpenSealedStore(files, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || !bytes.Equal(values["share/vasya"], []byte{1, 2, 3}) {
+		t.Errorf("loaded %v", values)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 2 {
+		t.Errorf("store has %d files, expected a value and the data key", len(names))
+	}
+}
+
+func TestSealedPeerRestart(t *testing.T) {
+	fastKDF(t)
+	files, err := NewFileStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenSealedStore(files, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadLocalPeer(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []Peer{p, NewLocalPeer()}
+	if _, err := NewCoordinator(peers).Keygen(context.Background(), "client", 2, 2); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	s, err = OpenSealedStore(files, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := LoadLocalPeer(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.keys["client"].SecretKey != p.keys["client"].SecretKey {
+		t.Errorf("share changed after restart")
+	}
+}
+
+func TestReadPassphrase(t *testing.T) {
+	file := filepath.Join(tempDir(t), "passphrase")
+	if err := ioutil.WriteFile(file, []byte("from file\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	const env = "DISTSIG_TEST_PASSPHRASE"
+	os.Setenv(env, "from env")
+	defer os.Unsetenv(env)
+
+	if passphrase, err := ReadPassphrase(file, env); err != nil || string(passphrase) != "from file" {
+		t.Errorf("read %q from the file: %v", passphrase, err)
+	}
+	if passphrase, err := ReadPassphrase("", env); err != nil || string(passphrase) != "from env" {
+		t.Errorf("read %q from the environment: %v", passphrase, err)
+	}
+	os.Unsetenv(env)
+	if _, err := ReadPassphrase("", env); err == nil {
+		t.Errorf("read an empty passphrase")
+	}
+}
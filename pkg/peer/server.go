@@ -0,0 +1,245 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+	"github.com/dvshur/distributed-signature/pkg/peer/peerpb"
+	"github.com/dvshur/distributed-signature/pkg/policy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// peerServer serves a Peer over gRPC to RemotePeer clients
+type peerServer struct {
+	peerpb.UnimplementedPeerServer
+	peer Peer
+}
+
+// NewPeerServer ..
+func NewPeerServer(p Peer) peerpb.PeerServer {
+	return &peerServer{peer: p}
+}
+
+func (s *peerServer) BoxKey(ctx context.Context, req *peerpb.Empty) (*peerpb.BoxKeyResponse, error) {
+	key, err := s.peer.BoxKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &peerpb.BoxKeyResponse{Key: key[:]}, nil
+}
+
+func (s *peerServer) Deal(ctx context.Context, req *peerpb.DealRequest) (*peerpb.Dealing, error) {
+	keys, err := decodeKeys(req.Keys)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.peer.Deal(ctx, req.ClientId, int(req.Index), int(req.Threshold), decodeIndices(req.Participants), keys)
+	if err != nil {
+		return nil, err
+	}
+	return encodeDealing(d), nil
+}
+
+func (s *peerServer) Verify(ctx context.Context, req *peerpb.VerifyRequest) (*peerpb.VerifyResponse, error) {
+	shares := make(map[int]DealtShare, len(req.Shares))
+	for j, encoded := range req.Shares {
+		commitments, err := decodePoints(encoded.Commitments)
+		if err != nil {
+			return nil, err
+		}
+		shares[int(j)] = DealtShare{Commitments: commitments, Sealed: encoded.SealedShare}
+	}
+	accused, err := s.peer.Verify(ctx, req.ClientId, shares)
+	if err != nil {
+		return nil, err
+	}
+	return &peerpb.VerifyResponse{Accused: encodeIndices(accused)}, nil
+}
+
+func (s *peerServer) Reveal(ctx context.Context, req *peerpb.RevealRequest) (*peerpb.Shares, error) {
+	revealed, err := s.peer.Reveal(ctx, req.ClientId, decodeIndices(req.Accusers))
+	if err != nil {
+		return nil, err
+	}
+	return &peerpb.Shares{Shares: encodeScalars(revealed)}, nil
+}
+
+func (s *peerServer) Finalize(ctx context.Context, req *peerpb.FinalizeRequest) (*peerpb.Point, error) {
+	revealed, err := decodeScalars(req.Revealed)
+	if err != nil {
+		return nil, err
+	}
+	Yi, err := s.peer.Finalize(ctx, req.ClientId, decodeIndices(req.Qualified), revealed)
+	if err != nil {
+		return nil, err
+	}
+	return &peerpb.Point{Point: encodePoint(Yi)}, nil
+}
+
+func (s *peerServer) Refresh(ctx context.Context, req *peerpb.RefreshRequest) (*peerpb.Dealing, error) {
+	keys, err := decodeKeys(req.Keys)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.peer.Refresh(ctx, req.ClientId, decodeIndices(req.Participants), keys)
+	if err != nil {
+		return nil, err
+	}
+	return encodeDealing(d), nil
+}
+
+func (s *peerServer) ApplyRefresh(ctx context.Context, req *peerpb.ClientRequest) (*peerpb.Empty, error) {
+	if err := s.peer.ApplyRefresh(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	return &peerpb.Empty{}, nil
+}
+
+func (s *peerServer) Confirm(ctx context.Context, req *peerpb.ClientRequest) (*peerpb.Empty, error) {
+	if err := s.peer.Confirm(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	return &peerpb.Empty{}, nil
+}
+
+func (s *peerServer) Rollback(ctx context.Context, req *peerpb.ClientRequest) (*peerpb.Empty, error) {
+	if err := s.peer.Rollback(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	return &peerpb.Empty{}, nil
+}
+
+func (s *peerServer) Join(ctx context.Context, req *peerpb.JoinRequest) (*peerpb.Empty, error) {
+	if err := s.peer.Join(ctx, req.ClientId, int(req.Index), int(req.Threshold)); err != nil {
+		return nil, err
+	}
+	return &peerpb.Empty{}, nil
+}
+
+func (s *peerServer) Reshare(ctx context.Context, req *peerpb.ReshareRequest) (*peerpb.Dealing, error) {
+	keys, err := decodeKeys(req.Keys)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.peer.Reshare(ctx, req.ClientId, int(req.Threshold), decodeIndices(req.Participants), keys)
+	if err != nil {
+		return nil, err
+	}
+	return encodeDealing(d), nil
+}
+
+func (s *peerServer) Retire(ctx context.Context, req *peerpb.ClientRequest) (*peerpb.Empty, error) {
+	if err := s.peer.Retire(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	return &peerpb.Empty{}, nil
+}
+
+func (s *peerServer) PublicShare(ctx context.Context, req *peerpb.ClientRequest) (*peerpb.PublicShareResponse, error) {
+	share, err := s.peer.PublicShare(ctx, req.ClientId)
+	if err != nil {
+		return nil, err
+	}
+	return &peerpb.PublicShareResponse{
+		Index:       int32(share.Index),
+		Yi:          encodePoint(&share.Yi),
+		Commitments: encodePoints(share.Commitments),
+	}, nil
+}
+
+func (s *peerServer) Commit(ctx context.Context, req *peerpb.CommitRequest) (*peerpb.CommitResponse, error) {
+	commitment, err := s.peer.Commit(ctx, req.ClientId, req.SessionId, req.Message)
+	if err != nil {
+		return nil, policyError(err)
+	}
+	return &peerpb.CommitResponse{Commitment: commitment[:]}, nil
+}
+
+func (s *peerServer) Ri(ctx context.Context, req *peerpb.RiRequest) (*peerpb.Point, error) {
+	commitments := make(map[int]crypto.Digest, len(req.Commitments))
+	for j, b := range req.Commitments {
+		var c crypto.Digest
+		if len(b) != len(c) {
+			return nil, fmt.Errorf("invalid commitment length %d", len(b))
+		}
+		copy(c[:], b)
+		commitments[int(j)] = c
+	}
+	Ri, err := s.peer.Ri(ctx, req.ClientId, req.SessionId, commitments)
+	if err != nil {
+		return nil, policyError(err)
+	}
+	return &peerpb.Point{Point: encodePoint(Ri)}, nil
+}
+
+func (s *peerServer) Si(ctx context.Context, req *peerpb.SiRequest) (*peerpb.Scalar, error) {
+	nonces := make(map[int]cryptobase.ExtendedGroupElement, len(req.Nonces))
+	for j, b := range req.Nonces {
+		R, err := decodePoint(b)
+		if err != nil {
+			return nil, err
+		}
+		nonces[int(j)] = *R
+	}
+	Si, err := s.peer.Si(ctx, req.ClientId, req.SessionId, nonces, req.Message)
+	if err != nil {
+		return nil, policyError(err)
+	}
+	return &peerpb.Scalar{Scalar: Si[:]}, nil
+}
+
+func (s *peerServer) Hold(ctx context.Context, req *peerpb.HoldRequest) (*peerpb.Empty, error) {
+	err := s.peer.Hold(ctx, &SigningRequest{
+		ID:       req.RequestId,
+		ClientID: req.ClientId,
+		Message:  req.Message,
+		Expires:  time.Unix(req.Expires, 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &peerpb.Empty{}, nil
+}
+
+func (s *peerServer) Approve(ctx context.Context, req *peerpb.ApproveRequest) (*peerpb.ApproveResponse, error) {
+	var approval Approval
+	if len(req.Approver) != len(approval.Approver) || len(req.Signature) != len(approval.Signature) {
+		return nil, fmt.Errorf("invalid approver or signature length")
+	}
+	copy(approval.Approver[:], req.Approver)
+	copy(approval.Signature[:], req.Signature)
+	approved, err := s.peer.Approve(ctx, req.ClientId, req.RequestId, approval)
+	if err != nil {
+		return nil, err
+	}
+	return &peerpb.ApproveResponse{Approved: approved}, nil
+}
+
+func (s *peerServer) Cancel(ctx context.Context, req *peerpb.CancelRequest) (*peerpb.Empty, error) {
+	if err := s.peer.Cancel(ctx, req.ClientId, req.RequestId); err != nil {
+		return nil, err
+	}
+	return &peerpb.Empty{}, nil
+}
+
+// policyError attaches a policy violation to the status, so that RemotePeer returns it as a *policy.Violation
+func policyError(err error) error {
+	var violation *policy.Violation
+	if !errors.As(err, &violation) {
+		return err
+	}
+	st, detailsErr := status.New(codes.PermissionDenied, violation.Error()).WithDetails(&peerpb.PolicyViolation{
+		ClientId: violation.ClientID,
+		Rule:     violation.Rule,
+		Reason:   violation.Reason,
+	})
+	if detailsErr != nil {
+		return err
+	}
+	return st.Err()
+}
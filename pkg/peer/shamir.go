@@ -0,0 +1,146 @@
+package peer
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+)
+
+// scalars are canonical 32 byte little-endian integers modulo the group order, see cryptobase.ScAdd
+
+var scOne = [32]byte{1}
+
+func scalarFromInt(i int) [32]byte {
+	var s [32]byte
+	binary.LittleEndian.PutUint64(s[:], uint64(i))
+	return s
+}
+
+func randomScalar() ([32]byte, error) {
+	var s [32]byte
+	var random [64]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return s, err
+	}
+	cryptobase.ScReduce(&s, &random)
+	return s, nil
+}
+
+// polynomial holds coefficients over scalars, constant term first
+type polynomial [][32]byte
+
+// newRandomPolynomial returns a random polynomial of the given degree with f(0) = secret
+func newRandomPolynomial(secret [32]byte, degree int) (polynomial, error) {
+	f := make(polynomial, degree+1)
+	f[0] = secret
+	for i := 1; i <= degree; i++ {
+		c, err := randomScalar()
+		if err != nil {
+			return nil, err
+		}
+		f[i] = c
+	}
+	return f, nil
+}
+
+// evaluate returns f(x) using Horner's rule
+func (f polynomial) evaluate(x int) [32]byte {
+	xs := scalarFromInt(x)
+	var res [32]byte
+	for i := len(f) - 1; i >= 0; i-- {
+		cryptobase.ScMulAdd(&res, &res, &xs, &f[i])
+	}
+	return res
+}
+
+// shares evaluates f for every participant
+func (f polynomial) shares(participants []int) map[int][32]byte {
+	res := make(map[int][32]byte, len(participants))
+	for _, j := range participants {
+		res[j] = f.evaluate(j)
+	}
+	return res
+}
+
+// lagrangeCoefficient returns the coefficient of participant i
+// for interpolating at zero over the given set of participants
+func lagrangeCoefficient(i int, participants []int) [32]byte {
+	num, den := scOne, scOne
+	xi := scalarFromInt(i)
+	for _, j := range participants {
+		if j == i {
+			continue
+		}
+		xj := scalarFromInt(j)
+		cryptobase.ScMul(&num, &num, &xj)
+		var diff [32]byte
+		cryptobase.ScSub(&diff, &xj, &xi)
+		cryptobase.ScMul(&den, &den, &diff)
+	}
+	var lambda [32]byte
+	cryptobase.ScInvert(&lambda, &den)
+	cryptobase.ScMul(&lambda, &lambda, &num)
+	return lambda
+}
+
+func geEqual(a, b *cryptobase.ExtendedGroupElement) bool {
+	var aBytes, bBytes [32]byte
+	a.ToBytes(&aBytes)
+	b.ToBytes(&bBytes)
+	return aBytes == bBytes
+}
+
+// commit returns Feldman commitments f_k·B to every coefficient of f
+func (f polynomial) commit() []cryptobase.ExtendedGroupElement {
+	commitments := make([]cryptobase.ExtendedGroupElement, len(f))
+	for k := range f {
+		cryptobase.GeScalarMultBase(&commitments[k], &f[k])
+	}
+	return commitments
+}
+
+// evaluateCommitments returns f(x)·B given Feldman commitments to f
+func evaluateCommitments(commitments []cryptobase.ExtendedGroupElement, x int) cryptobase.ExtendedGroupElement {
+	xs := scalarFromInt(x)
+	var res cryptobase.ExtendedGroupElement
+	res.Zero()
+	for k := len(commitments) - 1; k >= 0; k-- {
+		cryptobase.GeScalarMult(&res, &xs, &res)
+		cryptobase.GeAdd(&res, &res, &commitments[k])
+	}
+	return res
+}
+
+// verifyShare checks share·B == f(x)·B against Feldman commitments to f
+func verifyShare(share *[32]byte, x int, commitments []cryptobase.ExtendedGroupElement) bool {
+	var S cryptobase.ExtendedGroupElement
+	cryptobase.GeScalarMultBase(&S, share)
+	expected := evaluateCommitments(commitments, x)
+	return geEqual(&S, &expected)
+}
+
+// scaleCommitments multiplies every commitment by lambda
+func scaleCommitments(lambda *[32]byte, commitments []cryptobase.ExtendedGroupElement) []cryptobase.ExtendedGroupElement {
+	res := make([]cryptobase.ExtendedGroupElement, len(commitments))
+	for k := range commitments {
+		cryptobase.GeScalarMult(&res[k], lambda, &commitments[k])
+	}
+	return res
+}
+
+// sumCommitments adds commitment vectors of the same length coefficient-wise
+func sumCommitments(vectors [][]cryptobase.ExtendedGroupElement) []cryptobase.ExtendedGroupElement {
+	if len(vectors) == 0 {
+		return nil
+	}
+	res := make([]cryptobase.ExtendedGroupElement, len(vectors[0]))
+	for k := range res {
+		terms := make([]cryptobase.ExtendedGroupElement, len(vectors))
+		for i, v := range vectors {
+			terms[i] = v[k]
+		}
+		res[k] = sumGeSlice(terms)
+	}
+	return res
+}
@@ -0,0 +1,161 @@
+package peer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dvshur/distributed-signature/pkg/cryptobase"
+)
+
+// ShareStore persists the secrets of a peer, a value has to be durable once Put returns
+type ShareStore interface {
+	Load() (map[string][]byte, error)
+	Put(key string, value []byte) error
+	Delete(key string) error
+}
+
+// keys of the store, the same client id may have both a threshold share and a musig key pair.
+// A share that is not confirmed yet has the share it replaced under the previous key, empty for a new key.
+const (
+	shareKeyPrefix    = "share/"
+	previousKeyPrefix = "previous/"
+	musigKeyPrefix    = "musig/"
+	// boxKeyName holds the secret key shares dealt to the peer are sealed to
+	boxKeyName = "box/key"
+)
+
+// FileStore keeps every value in its own file, a value is written to a temporary file,
+// synced and renamed over the old one, so a crash leaves either the old or the new value
+type FileStore struct {
+	dir string
+}
+
+const tempFilePrefix = ".tmp-"
+
+// NewFileStore opens a store in dir, creating it if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Load reads all values, removing temporary files left by an interrupted Put
+func (s *FileStore) Load() (map[string][]byte, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(files))
+	for _, f := range files {
+		path := filepath.Join(s.dir, f.Name())
+		if strings.HasPrefix(f.Name(), tempFilePrefix) {
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		key, err := hex.DecodeString(f.Name())
+		if err != nil {
+			return nil, fmt.Errorf("unexpected file %s in store", path)
+		}
+		value, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		values[string(key)] = value
+	}
+	return values, nil
+}
+
+// Put atomically replaces the value of key
+func (s *FileStore) Put(key string, value []byte) error {
+	f, err := ioutil.TempFile(s.dir, tempFilePrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(value); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), s.path(key)); err != nil {
+		return err
+	}
+	return s.syncDir()
+}
+
+// Delete removes key, a missing key is not an error
+func (s *FileStore) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.syncDir()
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, hex.EncodeToString([]byte(key)))
+}
+
+// syncDir makes a rename or a removal in the directory durable
+func (s *FileStore) syncDir() error {
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// MarshalBinary encodes the share as index || secret key || number of commitments || commitments
+func (ks keyShare) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 4+32+2+32*len(ks.Commitments))
+	binary.BigEndian.PutUint32(data, uint32(ks.Index))
+	copy(data[4:], ks.SecretKey[:])
+	binary.BigEndian.PutUint16(data[36:], uint16(len(ks.Commitments)))
+	for i := range ks.Commitments {
+		var b [32]byte
+		ks.Commitments[i].ToBytes(&b)
+		copy(data[38+32*i:], b[:])
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a share encoded by MarshalBinary, Yi is recomputed from the secret key
+func (ks *keyShare) UnmarshalBinary(data []byte) error {
+	if len(data) < 38 {
+		return fmt.Errorf("key share is too short")
+	}
+	n := int(binary.BigEndian.Uint16(data[36:]))
+	if len(data) != 38+32*n {
+		return fmt.Errorf("key share has %d bytes, expected %d", len(data), 38+32*n)
+	}
+	ks.Index = int(binary.BigEndian.Uint32(data))
+	copy(ks.SecretKey[:], data[4:36])
+	if !cryptobase.ScMinimal(&ks.SecretKey) {
+		return fmt.Errorf("key share secret is not canonical")
+	}
+	ks.Commitments = make([]cryptobase.ExtendedGroupElement, n)
+	for i := range ks.Commitments {
+		var b [32]byte
+		copy(b[:], data[38+32*i:])
+		if !ks.Commitments[i].FromBytes(&b) {
+			return fmt.Errorf("commitment %d is not a valid point", i)
+		}
+	}
+	cryptobase.GeScalarMultBase(&ks.Yi, &ks.SecretKey)
+	return nil
+}
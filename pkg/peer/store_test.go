@@ -0,0 +1,136 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestFileStore(t *testing.T) {
+	dir := tempDir(t)
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put("share/vasya", []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("share/petya", []byte{4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("share/vasya", []byte{5, 6}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("share/petya"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("share/unknown"); err != nil {
+		t.Errorf("deleting a missing key failed: %v", err)
+	}
+
+	// a write interrupted before the rename is discarded
+	if err := ioutil.WriteFile(filepath.Join(dir, tempFilePrefix+"1"), []byte{7}, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := reopened.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || !bytes.Equal(values["share/vasya"], []byte{5, 6}) {
+		t.Errorf("loaded %v", values)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("%d files left in the store", len(files))
+	}
+}
+
+func TestPeerRestart(t *testing.T) {
+	dirs := []string{tempDir(t), tempDir(t), tempDir(t)}
+	load := func() []Peer {
+		peers := make([]Peer, len(dirs))
+		for i, dir := range dirs {
+			s, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := LoadLocalPeer(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			peers[i] = p
+		}
+		return peers
+	}
+
+	c := NewCoordinator(load())
+	pk, err := c.Keygen(context.Background(), "client", 2, 3)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if err := c.Refresh(context.Background(), "client"); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	// every peer restarts and loads its refreshed share
+	members := c.(*CoordinatorImpl).committees["client"].members
+	for i, p := range load() {
+		members[i].peer = p
+	}
+
+	message := []byte("restart")
+	sig, err := c.Sign(context.Background(), "client", message)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !crypto.Verify(pk, sig, message) {
+		t.Errorf("signature is not valid")
+	}
+}
+
+func TestMuSigKeyPersisted(t *testing.T) {
+	s, err := NewFileStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadLocalPeer(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Ai, err := p.MuSigKey(context.Background(), "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := LoadLocalPeer(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restartedAi, err := restarted.MuSigKey(context.Background(), "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !geEqual(Ai, restartedAi) {
+		t.Errorf("musig key changed after restart")
+	}
+}
@@ -0,0 +1,98 @@
+package peer
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const instrumentationName = "github.com/dvshur/distributed-signature/pkg/peer"
+
+// traceContext carries the trace over gRPC metadata as W3C traceparent and tracestate
+var traceContext = propagation.TraceContext{}
+
+// WithTracer makes the coordinator trace its operations and every call to a peer with tracers of tp
+func WithTracer(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+// startOperation starts the span of an operation on the client key
+func (o options) startOperation(ctx context.Context, name, clientID string) (context.Context, trace.Span) {
+	return o.tracer.Start(ctx, name, trace.WithAttributes(attribute.String("client.id", clientID)))
+}
+
+// peerCall starts the span of a call to the peer with the index in the committee, the returned func observes the call
+// under the peer's name and ends the span
+func (o options) peerCall(ctx context.Context, index int, p interface{ Name() string }, call string) (context.Context, func(error)) {
+	name := p.Name()
+	ctx, span := o.tracer.Start(ctx, "Peer."+call, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("peer.index", index), attribute.String("peer.name", name)))
+	return ctx, func(err error) {
+		o.metrics.PeerCall(name, call, err)
+		endSpan(span, err)
+	}
+}
+
+// endSpan ends the span, marking it failed if err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceDialOption passes the trace of every call on the connection to the peer, use it to dial RemotePeer connections
+func TraceDialOption() grpc.DialOption {
+	return grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		md = md.Copy()
+		traceContext.Inject(ctx, metadataCarrier(md))
+		return invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+	})
+}
+
+// TraceServerOption continues the coordinator's trace in a span of tp for every call to the peer server
+func TraceServerOption(tp trace.TracerProvider) grpc.ServerOption {
+	tracer := tp.Tracer(instrumentationName)
+	return grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = traceContext.Extract(ctx, metadataCarrier(md))
+		method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+		ctx, span := tracer.Start(ctx, "Peer."+method, trace.WithSpanKind(trace.SpanKindServer))
+		resp, err := handler(ctx, req)
+		endSpan(span, err)
+		return resp, err
+	})
+}
+
+// metadataCarrier is a propagation.TextMapCarrier over gRPC metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
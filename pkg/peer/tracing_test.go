@@ -0,0 +1,104 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/tracing"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceCoversPeers(t *testing.T) {
+	tp, spans := tracing.NewInMemory()
+	peerTP, peerSpans := tracing.NewInMemory()
+	peers := make([]Peer, 3)
+	for i := range peers {
+		peers[i] = servePeer(t, NewLocalPeer(), TraceServerOption(peerTP))
+	}
+	c := NewCoordinator(peers, WithTracer(tp))
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	spans.Reset()
+	peerSpans.Reset()
+
+	if _, err := c.Sign(context.Background(), "client", []byte("message")); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	var sign tracetest.SpanStub
+	for _, s := range spans.GetSpans() {
+		if s.Name == "Sign" {
+			sign = s
+		}
+	}
+	if !sign.SpanContext.IsValid() {
+		t.Fatalf("no Sign span")
+	}
+	calls := make(map[trace.SpanID]string)
+	for _, s := range spans.GetSpans() {
+		if s.SpanContext.TraceID() != sign.SpanContext.TraceID() {
+			t.Errorf("span %s is not in the trace of Sign", s.Name)
+		}
+		if strings.HasPrefix(s.Name, "Peer.") {
+			calls[s.SpanContext.SpanID()] = s.Name
+			if s.Parent.SpanID() != sign.SpanContext.SpanID() {
+				t.Errorf("span %s is not a child of Sign", s.Name)
+			}
+		}
+	}
+
+	// every call shows up on its peer as a child of the coordinator's span of the call
+	served := make(map[string]int)
+	for _, s := range peerSpans.GetSpans() {
+		if s.SpanContext.TraceID() != sign.SpanContext.TraceID() {
+			t.Errorf("peer span %s is not in the trace of Sign", s.Name)
+		}
+		if name, ok := calls[s.Parent.SpanID()]; !ok || name != s.Name {
+			t.Errorf("peer span %s is not a child of a coordinator call", s.Name)
+		}
+		served[s.Name]++
+	}
+	if served["Peer.Ri"] != 2 || served["Peer.Si"] != 2 {
+		t.Errorf("peers served %v, expected 2 Ri and 2 Si", served)
+	}
+}
+
+func TestTraceCoversApprovalsAndRecover(t *testing.T) {
+	tp, spans := tracing.NewInMemory()
+	alice, bob := newApprover(t, "alice"), newApprover(t, "bob")
+	_, peers := approvalPeers(t, alice, bob)
+	c := NewCoordinator(peers, WithApprovals(time.Minute), WithTracer(tp)).(*CoordinatorImpl)
+	if _, err := c.Keygen(context.Background(), "client", 2, 3); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	_, err := c.Sign(context.Background(), "client", []byte("message"))
+	var pending *PendingApprovalError
+	if !errors.As(err, &pending) {
+		t.Fatalf("expected a pending request, got %v", err)
+	}
+	if _, err := c.Approve(context.Background(), pending.Request.ID, alice.approve(t, pending.Request)); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+	if err := c.Cancel(context.Background(), pending.Request.ID); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	if _, err := c.Recover(context.Background(), "client"); err != nil {
+		t.Fatalf("recover failed: %v", err)
+	}
+
+	calls := make(map[string]int)
+	for _, s := range spans.GetSpans() {
+		calls[s.Name]++
+	}
+	for _, call := range []string{"Peer.Hold", "Peer.Approve", "Peer.Cancel", "Peer.PublicShare"} {
+		if calls[call] != 3 {
+			t.Errorf("%d spans of %s, expected 3", calls[call], call)
+		}
+	}
+}
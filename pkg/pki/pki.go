@@ -0,0 +1,180 @@
+// Package pki issues certificates for mutual TLS between the coordinator and peers.
+// Every party is identified by the name in its certificate: peers accept calls only from
+// the names they are configured with, the coordinator pins the name of every peer it dials.
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Authority is a certificate authority trusted by the coordinator and peers
+type Authority struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// NewAuthority generates a self-signed CA certificate
+func NewAuthority(name string, validFor time.Duration) (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template, err := newTemplate(name, validFor)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{Cert: cert, Key: key}, nil
+}
+
+// LoadAuthority parses a CA certificate and its key in PEM
+func LoadAuthority(certPEM, keyPEM []byte) (*Authority, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in CA certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in CA key")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{Cert: cert, Key: key}, nil
+}
+
+// PEM returns the CA certificate and key in PEM
+func (a *Authority) PEM() (certPEM, keyPEM []byte, err error) {
+	return encode(a.Cert.Raw, a.Key)
+}
+
+// Issue returns a certificate and a key in PEM for the named party,
+// the certificate is valid for both sides of a connection
+func (a *Authority) Issue(name string, validFor time.Duration) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := newTemplate(name, validFor)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.DNSNames = []string{name}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.Cert, &key.PublicKey, a.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encode(der, key)
+}
+
+// ServerConfig returns the TLS config of a peer, only clients with a certificate
+// issued by the CA to one of the allowed names can connect
+func ServerConfig(caPEM, certPEM, keyPEM []byte, allowed []string) (*tls.Config, error) {
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("no allowed clients")
+	}
+	pool, cert, err := load(caPEM, certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates:          []tls.Certificate{cert},
+		ClientCAs:             pool,
+		ClientAuth:            tls.RequireAndVerifyClientCert,
+		MinVersion:            tls.VersionTLS12,
+		VerifyPeerCertificate: allowNames(allowed),
+	}, nil
+}
+
+// ClientConfig returns the TLS config for dialing a peer, the peer has to present
+// a certificate issued by the CA to name
+func ClientConfig(caPEM, certPEM, keyPEM []byte, name string) (*tls.Config, error) {
+	pool, cert, err := load(caPEM, certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   name,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// allowNames accepts a verified chain only if its leaf certificate is issued to one of the names
+func allowNames(names []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(_ [][]byte, chains [][]*x509.Certificate) error {
+		for _, chain := range chains {
+			for _, name := range names {
+				if len(chain) > 0 && chain[0].VerifyHostname(name) == nil {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("client certificate is not issued to an allowed name")
+	}
+}
+
+func newTemplate(name string, validFor time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(validFor),
+	}, nil
+}
+
+func encode(der []byte, key *ecdsa.PrivateKey) (certPEM, keyPEM []byte, err error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func load(caPEM, certPEM, keyPEM []byte) (*x509.CertPool, tls.Certificate, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, tls.Certificate{}, fmt.Errorf("no CA certificates")
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+	return pool, cert, nil
+}
@@ -0,0 +1,53 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssue(t *testing.T) {
+	ca, err := NewAuthority("test ca", time.Hour)
+	require.NoError(t, err)
+	caCert, caKey, err := ca.PEM()
+	require.NoError(t, err)
+
+	// the CA survives a round trip through PEM
+	loaded, err := LoadAuthority(caCert, caKey)
+	require.NoError(t, err)
+	certPEM, _, err := loaded.Issue("peer1", time.Hour)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	_, err = cert.Verify(x509.VerifyOptions{
+		DNSName:   "peer1",
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, allowNames([]string{"coordinator", "peer1"})(nil, [][]*x509.Certificate{{cert}}))
+	assert.Error(t, allowNames([]string{"coordinator"})(nil, [][]*x509.Certificate{{cert}}))
+}
+
+func TestServerConfigRequiresAllowedClients(t *testing.T) {
+	ca, err := NewAuthority("test ca", time.Hour)
+	require.NoError(t, err)
+	caCert, _, err := ca.PEM()
+	require.NoError(t, err)
+	certPEM, keyPEM, err := ca.Issue("peer1", time.Hour)
+	require.NoError(t, err)
+
+	_, err = ServerConfig(caCert, certPEM, keyPEM, nil)
+	assert.Error(t, err)
+}
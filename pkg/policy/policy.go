@@ -0,0 +1,328 @@
+// Package policy holds the rules a peer checks on its own before it releases a nonce or a partial signature,
+// so that a compromised coordinator can't get a message signed that the peer's operator did not allow.
+// Policies are declared per client in a JSON file:
+//
+//	{
+//	  "clients": {
+//	    "vasya": {
+//	      "messagePrefixes": ["Jg"],
+//	      "maxAmounts": {"WAVES": 100000000},
+//	      "recipients": ["3P..."],
+//	      "hours": [{"from": "09:00", "to": "18:00"}],
+//	      "timezone": "Europe/Moscow",
+//	      "approvers": ["<base58 public key>", "<base58 public key>"],
+//	      "approvals": 1
+//	    }
+//	  },
+//	  "default": {"hours": [{"from": "09:00", "to": "18:00"}]}
+//	}
+//
+// A client without rules of its own gets the default ones, a client with neither is not restricted.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/dvshur/distributed-signature/pkg/crypto"
+	"github.com/mr-tron/base58/base58"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+// Rule names reported in a Violation
+const (
+	RuleMessagePrefixes = "messagePrefixes"
+	RuleMaxAmounts      = "maxAmounts"
+	RuleRecipients      = "recipients"
+	RuleHours           = "hours"
+	RuleApprovals       = "approvals"
+)
+
+// Violation is returned for a message the policy of the client does not allow
+type Violation struct {
+	ClientID string
+	Rule     string
+	Reason   string
+}
+
+func (e *Violation) Error() string {
+	return fmt.Sprintf("client id %s: policy %s: %s", e.ClientID, e.Rule, e.Reason)
+}
+
+// Rules is what the policy file declares for a client, every rule that is set has to pass.
+// MessagePrefixes are base58, a message has to start with one of them.
+// MaxAmounts limits the amount of Waves transfer transactions per asset, WAVES or an asset id in base58,
+// transfers of other assets are refused. Recipients is the allowlist of addresses and aliases transfers can go to.
+// Hours are the windows of the day, in Timezone or UTC, messages can be signed in, a window can pass midnight.
+// With a transfer rule set only messages that are the body of a transfer transaction, version 1 or 2, can be signed,
+// any other message is refused.
+// Approvals of the Approvers, Waves public keys in base58, are needed to sign a message, see Policy.Approvers.
+type Rules struct {
+	MessagePrefixes []string          `json:"messagePrefixes,omitempty"`
+	MaxAmounts      map[string]uint64 `json:"maxAmounts,omitempty"`
+	Recipients      []string          `json:"recipients,omitempty"`
+	Hours           []Window          `json:"hours,omitempty"`
+	Timezone        string            `json:"timezone,omitempty"`
+	Approvers       []string          `json:"approvers,omitempty"`
+	Approvals       int               `json:"approvals,omitempty"`
+}
+
+// Window is a time of day range [From, To) as "15:04"
+type Window struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Policy is a parsed policy file
+type Policy struct {
+	clients  map[string]*rules
+	fallback *rules
+}
+
+type rules struct {
+	prefixes   [][]byte
+	maxAmounts map[string]uint64
+	recipients map[string]bool
+	windows    []window
+	location   *time.Location
+	approvers  []crypto.PublicKey
+	approvals  int
+}
+
+// window in minutes since midnight
+type window struct {
+	from, to int
+}
+
+// Load reads a policy file
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses a policy file, refusing unknown fields so that a misspelled rule doesn't go unenforced
+func Parse(data []byte) (*Policy, error) {
+	var file struct {
+		Clients map[string]Rules `json:"clients"`
+		Default *Rules           `json:"default"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	p := &Policy{clients: make(map[string]*rules, len(file.Clients))}
+	for clientID, r := range file.Clients {
+		compiled, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("client id %s: %v", clientID, err)
+		}
+		p.clients[clientID] = compiled
+	}
+	if file.Default != nil {
+		compiled, err := compile(*file.Default)
+		if err != nil {
+			return nil, fmt.Errorf("default: %v", err)
+		}
+		p.fallback = compiled
+	}
+	return p, nil
+}
+
+func compile(r Rules) (*rules, error) {
+	// a rule set to an empty list allows nothing
+	c := &rules{location: time.UTC}
+	if r.MessagePrefixes != nil {
+		c.prefixes = make([][]byte, 0, len(r.MessagePrefixes))
+	}
+	if r.Hours != nil {
+		c.windows = make([]window, 0, len(r.Hours))
+	}
+	for _, prefix := range r.MessagePrefixes {
+		b, err := base58.Decode(prefix)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("%s: %q is not base58", RuleMessagePrefixes, prefix)
+		}
+		c.prefixes = append(c.prefixes, b)
+	}
+	if r.MaxAmounts != nil {
+		c.maxAmounts = make(map[string]uint64, len(r.MaxAmounts))
+		for asset, amount := range r.MaxAmounts {
+			a, err := proto.NewOptionalAssetFromString(asset)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not an asset id", RuleMaxAmounts, asset)
+			}
+			c.maxAmounts[a.String()] = amount
+		}
+	}
+	if r.Recipients != nil {
+		c.recipients = make(map[string]bool, len(r.Recipients))
+		for _, recipient := range r.Recipients {
+			c.recipients[recipient] = true
+		}
+	}
+	for _, w := range r.Hours {
+		from, err := minutes(w.From)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", RuleHours, err)
+		}
+		to, err := minutes(w.To)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", RuleHours, err)
+		}
+		c.windows = append(c.windows, window{from, to})
+	}
+	for _, approver := range r.Approvers {
+		pk, err := crypto.NewPublicKeyFromBase58(approver)
+		if err != nil {
+			return nil, fmt.Errorf("approvers: %q is not a public key", approver)
+		}
+		c.approvers = append(c.approvers, pk)
+	}
+	if r.Approvals < 0 || r.Approvals > len(r.Approvers) || (r.Approvals == 0) != (len(r.Approvers) == 0) {
+		return nil, fmt.Errorf("%s: %d of %d approvers", RuleApprovals, r.Approvals, len(r.Approvers))
+	}
+	c.approvals = r.Approvals
+	if r.Timezone != "" {
+		location, err := time.LoadLocation(r.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		c.location = location
+	}
+	return c, nil
+}
+
+func minutes(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Approvers returns the keys that can approve signing for the client and how many approvals are needed,
+// none if the client's messages need no approval. Approvals are checked by the caller of Check.
+func (p *Policy) Approvers(clientID string) ([]crypto.PublicKey, int) {
+	r := p.rules(clientID)
+	if r == nil {
+		return nil, 0
+	}
+	return r.approvers, r.approvals
+}
+
+func (p *Policy) rules(clientID string) *rules {
+	if r, ok := p.clients[clientID]; ok {
+		return r
+	}
+	return p.fallback
+}
+
+// Check returns a *Violation if the client's policy does not allow signing the message at the time now
+func (p *Policy) Check(clientID string, message []byte, now time.Time) error {
+	r := p.rules(clientID)
+	if r == nil {
+		return nil
+	}
+	violation := func(rule, format string, args ...interface{}) error {
+		return &Violation{ClientID: clientID, Rule: rule, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if r.prefixes != nil && !hasPrefix(message, r.prefixes) {
+		return violation(RuleMessagePrefixes, "message does not start with an allowed prefix")
+	}
+	if r.windows != nil && !inWindow(now.In(r.location), r.windows) {
+		return violation(RuleHours, "signing is not allowed at %s", now.In(r.location).Format("15:04 MST"))
+	}
+
+	// a message that decodes as more than one transfer has to pass the rules as each of them
+	decoded := transfers(message)
+	if len(decoded) == 0 {
+		if r.maxAmounts != nil {
+			return violation(RuleMaxAmounts, "message is not a transfer")
+		}
+		if r.recipients != nil {
+			return violation(RuleRecipients, "message is not a transfer")
+		}
+	}
+	for _, tr := range decoded {
+		if r.maxAmounts != nil {
+			asset := tr.AmountAsset.String()
+			max, ok := r.maxAmounts[asset]
+			if !ok {
+				return violation(RuleMaxAmounts, "transfers of %s are not allowed", asset)
+			}
+			if tr.Amount > max {
+				return violation(RuleMaxAmounts, "amount %d of %s is more than %d", tr.Amount, asset, max)
+			}
+		}
+		if r.recipients != nil && !r.recipients[tr.Recipient.String()] {
+			return violation(RuleRecipients, "recipient %s is not allowed", tr.Recipient.String())
+		}
+	}
+	return nil
+}
+
+func hasPrefix(message []byte, prefixes [][]byte) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(message, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func inWindow(t time.Time, windows []window) bool {
+	m := t.Hour()*60 + t.Minute()
+	for _, w := range windows {
+		if w.from <= w.to && w.from <= m && m < w.to {
+			return true
+		}
+		if w.from > w.to && (m >= w.from || m < w.to) {
+			return true
+		}
+	}
+	return false
+}
+
+// transfers decodes the message as the body of a transfer transaction. The body of version 1 has no version
+// byte, so a message can decode both ways, all the decodings that span the whole message are returned.
+func transfers(message []byte) []proto.Transfer {
+	if len(message) < 2 || proto.TransactionType(message[0]) != proto.TransferTransaction {
+		return nil
+	}
+	var res []proto.Transfer
+	if tr, ok := decodeTransfer(message[1:]); ok {
+		res = append(res, tr)
+	}
+	if message[1] >= 2 {
+		if tr, ok := decodeTransfer(message[2:]); ok {
+			res = append(res, tr)
+		}
+	}
+	return res
+}
+
+func decodeTransfer(data []byte) (tr proto.Transfer, ok bool) {
+	// the decoder doesn't check every length and panics on some truncated bodies
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	if err := tr.UnmarshalBinary(data); err != nil {
+		return tr, false
+	}
+	return tr, tr.BinarySize() == len(data)
+}
@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mr-tron/base58/base58"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+var (
+	sender, _   = crypto.NewPublicKeyFromBase58("7a8TjbyT6E4tusdKA3s2TWaYR8ZKHG1swuNKPoy1DHoz")
+	allowed, _  = proto.NewAddressFromPublicKey(proto.MainNetScheme, crypto.PublicKey{1})
+	stranger, _ = proto.NewAddressFromPublicKey(proto.MainNetScheme, crypto.PublicKey{2})
+	noon        = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func transfer(t *testing.T, version byte, amount uint64, recipient proto.Address) []byte {
+	var body []byte
+	var err error
+	if version == 1 {
+		tx := proto.NewUnsignedTransferWithSig(sender, proto.OptionalAsset{}, proto.OptionalAsset{}, 1, amount, 100000, proto.NewRecipientFromAddress(recipient), &proto.LegacyAttachment{})
+		body, err = tx.BodyMarshalBinary()
+	} else {
+		tx := proto.NewUnsignedTransferWithProofs(version, sender, proto.OptionalAsset{}, proto.OptionalAsset{}, 1, amount, 100000, proto.NewRecipientFromAddress(recipient), &proto.LegacyAttachment{})
+		body, err = tx.BodyMarshalBinary()
+	}
+	require.NoError(t, err)
+	return body
+}
+
+func rule(t *testing.T, err error) string {
+	var violation *Violation
+	require.True(t, errors.As(err, &violation), "expected a violation, got %v", err)
+	assert.Equal(t, "vasya", violation.ClientID)
+	return violation.Rule
+}
+
+func TestTransferRules(t *testing.T) {
+	p, err := Parse([]byte(`{"clients": {"vasya": {
+		"maxAmounts": {"WAVES": 1000},
+		"recipients": ["` + allowed.String() + `"]
+	}}}`))
+	require.NoError(t, err)
+
+	for _, version := range []byte{1, 2} {
+		assert.NoError(t, p.Check("vasya", transfer(t, version, 1000, allowed), noon))
+		assert.Equal(t, RuleMaxAmounts, rule(t, p.Check("vasya", transfer(t, version, 1001, allowed), noon)))
+		assert.Equal(t, RuleRecipients, rule(t, p.Check("vasya", transfer(t, version, 1, stranger), noon)))
+	}
+
+	// rules of one client don't apply to another
+	assert.NoError(t, p.Check("petya", transfer(t, 2, 1001, stranger), noon))
+	// a message that is not a transfer can't slip past them
+	assert.Equal(t, RuleMaxAmounts, rule(t, p.Check("vasya", []byte("message"), noon)))
+	// a truncated transfer doesn't crash the peer
+	body := transfer(t, 2, 1001, stranger)
+	for i := 2; i < len(body); i++ {
+		_ = p.Check("vasya", body[:i], noon)
+	}
+
+	p, err = Parse([]byte(`{"clients": {"vasya": {"recipients": ["` + allowed.String() + `"]}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, RuleRecipients, rule(t, p.Check("vasya", []byte("message"), noon)))
+}
+
+func TestMessagePrefixes(t *testing.T) {
+	p, err := Parse([]byte(`{"default": {"messagePrefixes": ["` + base58.Encode([]byte{4, 2}) + `"]}}`))
+	require.NoError(t, err)
+
+	assert.NoError(t, p.Check("vasya", transfer(t, 2, 1, allowed), noon))
+	assert.Equal(t, RuleMessagePrefixes, rule(t, p.Check("vasya", transfer(t, 1, 1, allowed), noon)))
+	assert.Equal(t, RuleMessagePrefixes, rule(t, p.Check("vasya", []byte("message"), noon)))
+
+	// an empty allowlist allows nothing
+	p, err = Parse([]byte(`{"default": {"messagePrefixes": []}}`))
+	require.NoError(t, err)
+	assert.Error(t, p.Check("vasya", transfer(t, 2, 1, allowed), noon))
+}
+
+func TestHours(t *testing.T) {
+	p, err := Parse([]byte(`{"clients": {"vasya": {
+		"hours": [{"from": "09:00", "to": "18:00"}, {"from": "22:00", "to": "01:00"}],
+		"timezone": "Etc/GMT-3"
+	}}}`))
+	require.NoError(t, err)
+
+	assert.NoError(t, p.Check("vasya", nil, noon))
+	assert.NoError(t, p.Check("vasya", nil, time.Date(2020, 6, 1, 21, 30, 0, 0, time.UTC)))
+	assert.Equal(t, RuleHours, rule(t, p.Check("vasya", nil, time.Date(2020, 6, 1, 15, 0, 0, 0, time.UTC))))
+	assert.Equal(t, RuleHours, rule(t, p.Check("vasya", nil, time.Date(2020, 6, 1, 22, 0, 0, 0, time.UTC))))
+}
+
+func TestParseRefusesUnknownRules(t *testing.T) {
+	_, err := Parse([]byte(`{"clients": {"vasya": {"maxAmount": 1000}}}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`{"clients": {"vasya": {"hours": [{"from": "9am", "to": "18:00"}]}}}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`{"clients": {"vasya": {"maxAmounts": {"not an asset": 1}}}}`))
+	assert.Error(t, err)
+}
+
+func TestApprovers(t *testing.T) {
+	p, err := Parse([]byte(`{"clients": {"vasya": {"approvers": ["` + sender.String() + `"], "approvals": 1}}}`))
+	require.NoError(t, err)
+	approvers, quorum := p.Approvers("vasya")
+	assert.Equal(t, 1, quorum)
+	assert.Equal(t, sender[:], approvers[0][:])
+	_, quorum = p.Approvers("petya")
+	assert.Zero(t, quorum)
+
+	// the quorum has to be reachable and set with approvers
+	_, err = Parse([]byte(`{"clients": {"vasya": {"approvers": ["` + sender.String() + `"], "approvals": 2}}}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`{"clients": {"vasya": {"approvers": ["` + sender.String() + `"]}}}`))
+	assert.Error(t, err)
+}